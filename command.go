@@ -0,0 +1,150 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/command.go
+ */
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gpt-zmide-server/helper/mockupstream"
+	"gpt-zmide-server/models"
+)
+
+const commandUsage = `Usage:
+  gpt-zmide-server                   start the server
+  gpt-zmide-server migrate status    show database migration status
+  gpt-zmide-server migrate up        apply pending migrations
+  gpt-zmide-server migrate down [n]  roll back the last n migrations (default 1)
+  gpt-zmide-server mock-upstream [-addr 127.0.0.1:8092] [-latency ms] [-script file]
+                                     serve a mock OpenAI compatible upstream for offline development`
+
+// 执行命令行子命令，返回进程退出码
+func runCommand(name string, args []string) int {
+	switch name {
+	case "migrate":
+		return migrateCommand(args)
+	case "mock-upstream":
+		return mockUpstreamCommand(args)
+	case "help", "-h", "--help":
+		fmt.Println(commandUsage)
+		return 0
+	}
+	fmt.Fprintln(os.Stderr, "unknown command "+name+"\n\n"+commandUsage)
+	return 2
+}
+
+// 数据库迁移命令
+func migrateCommand(args []string) int {
+	// 不处理 http 请求，关闭路由调试输出
+	gin.SetMode(gin.ReleaseMode)
+	app, err := newApp(true)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+	defer app.Close()
+	if app.DB == nil {
+		fmt.Fprintln(os.Stderr, "the application is not installed, please finish the installation first")
+		return 1
+	}
+
+	action := "status"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	switch action {
+	case "status":
+		list, err := models.MigrationStatus(app.DB)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT\tERROR")
+		for _, state := range list {
+			appliedAt := "-"
+			if state.AppliedAt != nil && !state.AppliedAt.IsZero() {
+				appliedAt = state.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", state.Version, state.Name, state.Status, appliedAt, state.Error)
+		}
+		w.Flush()
+		return 0
+	case "up":
+		applied, err := models.MigrateUp(app.DB)
+		for _, migration := range applied {
+			fmt.Printf("applied %d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+		return 0
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				fmt.Fprintln(os.Stderr, "invalid steps "+args[1])
+				return 2
+			}
+			steps = n
+		}
+		reverted, err := models.MigrateDown(app.DB, steps)
+		for _, migration := range reverted {
+			fmt.Printf("reverted %d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+		if len(reverted) == 0 {
+			fmt.Println("no applied migrations")
+		}
+		return 0
+	}
+	fmt.Fprintln(os.Stderr, "unknown migrate action "+action+"\n\n"+commandUsage)
+	return 2
+}
+
+// 启动模拟上游服务
+func mockUpstreamCommand(args []string) int {
+	flags := flag.NewFlagSet("mock-upstream", flag.ContinueOnError)
+	addr := flags.String("addr", "127.0.0.1:8092", "listen address")
+	latency := flags.Int("latency", 0, "response latency in milliseconds, between chunks for streams")
+	scriptPath := flags.String("script", "", "YAML script file of scripted responses")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	opts := mockupstream.Options{Latency: time.Duration(*latency) * time.Millisecond}
+	if *scriptPath != "" {
+		script, err := mockupstream.LoadScript(*scriptPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+		opts.Models, opts.Rules = script.Models, script.Rules
+	}
+
+	fmt.Println("mock upstream listening on http://" + *addr)
+	if err := http.ListenAndServe(*addr, mockupstream.New(opts)); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+	return 0
+}
@@ -6,20 +6,25 @@
 package apis
 
 import (
+	"errors"
 	"gpt-zmide-server/helper"
+	"gpt-zmide-server/helper/filter"
 	"gpt-zmide-server/models"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type Application struct {
 	Controller
+	Store *models.Stores
 }
 
 func (ctl *Application) Index(c *gin.Context) {
-	var apps []models.Application
-	if err := models.DB.Find(&apps).Error; err != nil {
+	apps, err := ctl.Store.Apps.List()
+	if err != nil {
 		ctl.Fail(c, err.Error())
 		return
 	}
@@ -34,7 +39,7 @@ func (ctl *Application) Create(c *gin.Context) {
 		return
 	}
 
-	app, err := models.CreateApplication(name)
+	app, err := models.CreateApplication(ctl.Store.Apps, name)
 	if err != nil {
 		// 创建失败
 		ctl.Fail(c, err.Error())
@@ -50,16 +55,37 @@ func (ctl *Application) Update(c *gin.Context) {
 		return
 	}
 
-	name, p_status, fix_long_msg := c.PostForm("name"),
-		c.PostForm("status"),
-		c.PostForm("fix_long_msg")
-	if name == "" && p_status == "" && fix_long_msg == "" {
+	name, p_status := c.PostForm("name"),
+		c.PostForm("status")
+
+	// 应用模型配置等允许清空的字段，需按列更新零值
+	columns := map[string]interface{}{}
+	if provider, ok := c.GetPostForm("provider"); ok {
+		if provider != "" && !helper.HasProvider(provider) {
+			ctl.Fail(c, "上游服务提供方不存在")
+			return
+		}
+		columns["provider"] = provider
+	}
+	if action, ok := c.GetPostForm("sensitive_action"); ok {
+		if action != "" && !filter.IsAction(action) {
+			ctl.Fail(c, "敏感词处理方式错误")
+			return
+		}
+		columns["sensitive_action"] = action
+	}
+	if err := ctl.profileColumns(c, columns); err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+
+	if name == "" && p_status == "" && len(columns) < 1 {
 		ctl.Fail(c, "参数异常")
 		return
 	}
 
-	app := models.Application{ID: uint(id)}
-	if err = models.DB.First(&app).Error; err != nil {
+	app, err := ctl.Store.Apps.Get(uint(id))
+	if err != nil {
 		ctl.Fail(c, err.Error())
 		return
 	}
@@ -71,18 +97,11 @@ func (ctl *Application) Update(c *gin.Context) {
 		}
 	}
 
-	if fix_long_msg != "" {
-		fixLongMsg, err := strconv.Atoi(fix_long_msg)
-		if err == nil {
-			app.EnableFixLongMsg = uint(fixLongMsg)
-		}
-	}
-
 	if name != "" {
 		app.Name = name
 	}
 
-	if err = models.DB.Updates(app).Error; err != nil {
+	if err = ctl.Store.Apps.Update(app, columns); err != nil {
 		ctl.Fail(c, err.Error())
 		return
 	}
@@ -90,6 +109,210 @@ func (ctl *Application) Update(c *gin.Context) {
 	ctl.Success(c, app)
 }
 
+// 解析应用模型及限流配置参数
+func (ctl *Application) profileColumns(c *gin.Context, columns map[string]interface{}) error {
+	if model, ok := c.GetPostForm("default_model"); ok {
+		columns["default_model"] = strings.TrimSpace(model)
+	}
+
+	if allowed, ok := c.GetPostForm("allowed_models"); ok {
+		profile := models.ApplicationProfile{AllowedModels: allowed}
+		columns["allowed_models"] = strings.Join(profile.AllowedModelList(), ",")
+	}
+
+	if p_temperature, ok := c.GetPostForm("temperature"); ok {
+		temperature, err := strconv.ParseFloat(p_temperature, 64)
+		if p_temperature == "" {
+			temperature, err = 0, nil
+		}
+		if err != nil || temperature < 0 || temperature > 2 {
+			return errors.New("temperature 取值范围为 0 ~ 2")
+		}
+		columns["temperature"] = temperature
+	}
+
+	if p_top_p, ok := c.GetPostForm("top_p"); ok {
+		topP, err := strconv.ParseFloat(p_top_p, 64)
+		if p_top_p == "" {
+			topP, err = 0, nil
+		}
+		if err != nil || topP < 0 || topP > 1 {
+			return errors.New("top_p 取值范围为 0 ~ 1")
+		}
+		columns["top_p"] = topP
+	}
+
+	if p_max_tokens, ok := c.GetPostForm("max_tokens"); ok {
+		maxTokens, err := strconv.Atoi(p_max_tokens)
+		if p_max_tokens == "" {
+			maxTokens, err = 0, nil
+		}
+		if err != nil || maxTokens < 0 {
+			return errors.New("max_tokens 参数错误")
+		}
+		columns["max_tokens"] = maxTokens
+	}
+
+	if prompt, ok := c.GetPostForm("system_prompt"); ok {
+		columns["system_prompt"] = prompt
+	}
+
+	if strategy, ok := c.GetPostForm("context_strategy"); ok {
+		if strategy != "" && !models.IsContextStrategy(strategy) {
+			return errors.New("上下文策略错误")
+		}
+		columns["context_strategy"] = strategy
+	}
+
+	if p_last_n, ok := c.GetPostForm("context_last_n"); ok {
+		lastN, err := strconv.Atoi(p_last_n)
+		if p_last_n == "" {
+			lastN, err = 0, nil
+		}
+		if err != nil || lastN < 0 {
+			return errors.New("context_last_n 参数错误")
+		}
+		columns["context_last_n"] = lastN
+	}
+
+	if p_iterations, ok := c.GetPostForm("max_tool_iterations"); ok {
+		iterations, err := strconv.Atoi(p_iterations)
+		if p_iterations == "" {
+			iterations, err = 0, nil
+		}
+		if err != nil || iterations < 0 {
+			return errors.New("max_tool_iterations 参数错误")
+		}
+		columns["max_tool_iterations"] = iterations
+	}
+
+	// 限流及图片限制配置，0 为不限制或使用默认值
+	for _, field := range []string{"rate_limit_rpm", "rate_limit_tpm", "max_concurrent_streams", "max_images", "max_image_size"} {
+		if p_value, ok := c.GetPostForm(field); ok {
+			value, err := strconv.ParseInt(p_value, 10, 64)
+			if p_value == "" {
+				value, err = 0, nil
+			}
+			if err != nil || value < 0 {
+				return errors.New(field + " 参数错误")
+			}
+			columns[field] = value
+		}
+	}
+
+	// 预算配置，0 为不限制
+	for _, field := range []string{"daily_token_budget", "monthly_token_budget"} {
+		if p_value, ok := c.GetPostForm(field); ok {
+			value, err := strconv.ParseInt(p_value, 10, 64)
+			if p_value == "" {
+				value, err = 0, nil
+			}
+			if err != nil || value < 0 {
+				return errors.New(field + " 参数错误")
+			}
+			columns[field] = value
+		}
+	}
+	for _, field := range []string{"daily_cost_budget", "monthly_cost_budget"} {
+		if p_value, ok := c.GetPostForm(field); ok {
+			value, err := strconv.ParseFloat(p_value, 64)
+			if p_value == "" {
+				value, err = 0, nil
+			}
+			if err != nil || value < 0 {
+				return errors.New(field + " 参数错误")
+			}
+			columns[field] = value
+		}
+	}
+	if p_percent, ok := c.GetPostForm("budget_alert_percent"); ok {
+		percent, err := strconv.Atoi(p_percent)
+		if p_percent == "" {
+			percent, err = 0, nil
+		}
+		if err != nil || percent < 0 || percent > 100 {
+			return errors.New("budget_alert_percent 取值范围为 0 ~ 100")
+		}
+		columns["budget_alert_percent"] = percent
+	}
+
+	return nil
+}
+
+// 查看应用当前周期预算用量
+func (ctl *Application) Budget(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+
+	app, err := ctl.Store.Apps.Get(uint(id))
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+
+	now := time.Now()
+	daily, err := ctl.Store.PeriodUsage(app, models.BudgetPeriodDaily, now)
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+	monthly, err := ctl.Store.PeriodUsage(app, models.BudgetPeriodMonthly, now)
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+
+	ctl.Success(c, gin.H{
+		"budget":   app.ApplicationBudget,
+		"daily":    daily,
+		"monthly":  monthly,
+		"exceeded": ctl.Store.CheckBudget(app) != nil,
+	})
+}
+
+// 重置应用当前周期预算用量
+func (ctl *Application) ResetBudget(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+
+	app, err := ctl.Store.Apps.Get(uint(id))
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+
+	if err = ctl.Store.ResetBudget(app); err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+
+	ctl.Success(c, "ok")
+}
+
+// 查看预算告警记录
+func (ctl *Application) BudgetAlerts(c *gin.Context) {
+	var appID uint64
+	if p_app_id := c.Query("app_id"); p_app_id != "" {
+		var err error
+		if appID, err = strconv.ParseUint(p_app_id, 10, 32); err != nil {
+			ctl.Fail(c, err.Error())
+			return
+		}
+	}
+	alerts, err := ctl.Store.Budgets.ListAlerts(uint(appID), 100)
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+	ctl.Success(c, alerts)
+}
+
 func (ctl *Application) RestApiKey(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
@@ -97,15 +320,15 @@ func (ctl *Application) RestApiKey(c *gin.Context) {
 		return
 	}
 
-	app := models.Application{ID: uint(id)}
-	if err = models.DB.First(&app).Error; err != nil {
+	app, err := ctl.Store.Apps.Get(uint(id))
+	if err != nil {
 		ctl.Fail(c, err.Error())
 		return
 	}
 
 	app.ApiKey = "sk-" + helper.RandomStr(48)
 
-	if err = models.DB.Updates(app).Error; err != nil {
+	if err = ctl.Store.Apps.Update(app, nil); err != nil {
 		ctl.Fail(c, err.Error())
 		return
 	}
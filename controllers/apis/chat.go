@@ -7,13 +7,14 @@ package apis
 
 import (
 	"gpt-zmide-server/models"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
 type Chat struct {
 	Controller
+	Store *models.Stores
 }
 
 func (ctl *Chat) Index(c *gin.Context) {
@@ -27,18 +28,15 @@ func (ctl *Chat) Index(c *gin.Context) {
 		c.ShouldBindJSON(&pageForm)
 	}
 
-	var chats []models.Chat
-
 	// 获取分页数据
-	pageForm, pageOffset, pageTotal := models.ModelPaginate(&chats, pageForm)
+	total, err := ctl.Store.Chats.Count()
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+	pageOffset, pageTotal := models.Paginate(pageForm, total)
 
-	err := models.DB.Limit(pageForm.Limit).
-		Offset(pageOffset).
-		Preload("Application",
-			func(query *gorm.DB) *gorm.DB {
-				return query.Model(models.Application{})
-			}).
-		Find(&chats).Error
+	chats, err := ctl.Store.Chats.List(pageOffset, pageForm.Limit)
 	if err != nil {
 		ctl.Fail(c, err.Error())
 		return
@@ -59,9 +57,25 @@ func (ctl *Chat) Index(c *gin.Context) {
 		newChat.CreatedAt = chat.CreatedAt
 		newChat.UpdatedAt = chat.UpdatedAt
 
-		models.DB.Model(&models.Message{}).Where("chat_id = ?", chat.ID).Count(&newChat.MessagesCount)
+		newChat.MessagesCount, _ = ctl.Store.Messages.CountByChat(chat.ID)
 		chatsList = append(chatsList, *newChat)
 	}
 
 	ctl.SuccessList(c, chatsList, pageForm, pageTotal)
 }
+
+// 会话消息记录，包含工具调用步骤
+func (ctl *Chat) Messages(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+
+	messages, err := ctl.Store.Messages.ListByChat(uint(id))
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+	ctl.Success(c, messages)
+}
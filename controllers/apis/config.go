@@ -11,17 +11,20 @@ import (
 	"errors"
 	"fmt"
 	"gpt-zmide-server/helper"
+	"gpt-zmide-server/helper/filter"
 	"gpt-zmide-server/helper/logger"
 	"gpt-zmide-server/models"
 	"net/url"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type Config struct {
 	Controller
+	Store *models.Stores
 }
 
 // 修改密码
@@ -35,7 +38,7 @@ func (ctl *Config) UpdatePassword(c *gin.Context) {
 	}
 
 	old_pwd := fmt.Sprintf("%x", md5.Sum([]byte(old_password)))
-	if old_pwd != helper.Config.AdminUser.Password {
+	if old_pwd != ctl.Store.Config.AdminUser.Password {
 		ctl.Fail(c, "旧密码错误")
 		return
 	}
@@ -46,54 +49,80 @@ func (ctl *Config) UpdatePassword(c *gin.Context) {
 	}
 
 	new_pwd := fmt.Sprintf("%x", md5.Sum([]byte(new_password)))
-	helper.Config.AdminUser.Password = new_pwd
-	helper.Config.SaveConfig()
+	ctl.Store.Config.AdminUser.Password = new_pwd
+	ctl.Store.Config.SaveConfig()
 
 	ctl.Success(c, "ok")
 }
 
 func (ctl *Config) SystemInfo(c *gin.Context) {
 	// 获取应用程序数量
-	var applicationCount int64 = 0
-	models.DB.Model(&models.Application{}).Count(&applicationCount)
+	applicationCount, _ := ctl.Store.Apps.Count()
 
 	// 获取会话数量
-	var chatCount int64 = 0
-	models.DB.Model(&models.Chat{}).Count(&chatCount)
+	chatCount, _ := ctl.Store.Chats.Count()
 
 	// 统计接口调用次数
-	var messageCount int64 = 0
-	models.DB.Model(&models.Message{}).Count(&messageCount)
+	messageCount, _ := ctl.Store.Messages.Count()
+
+	// 统计时间范围，格式 2006-01-02，结束日期包含当天
+	var start, end time.Time
+	if date := c.Query("start_date"); date != "" {
+		t, err := time.ParseInLocation("2006-01-02", date, time.Local)
+		if err != nil {
+			ctl.Fail(c, "start_date 格式异常")
+			return
+		}
+		start = t
+	}
+	if date := c.Query("end_date"); date != "" {
+		t, err := time.ParseInLocation("2006-01-02", date, time.Local)
+		if err != nil {
+			ctl.Fail(c, "end_date 格式异常")
+			return
+		}
+		end = t.AddDate(0, 0, 1)
+	}
 
-	// 计算预计扣费
-	var assistantMessages []models.Message
-	models.DB.Model(&models.Message{}).Where("role = ?", "assistant").Find(&assistantMessages)
-	assistantMessageWordCount := 0
-	for _, item := range assistantMessages {
-		assistantMessageWordCount = assistantMessageWordCount + len(item.Content)
+	// 按消息写入时的价格统计费用
+	usageTotal, err := ctl.Store.Usage.Total(start, end)
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+	usageByModel, err := ctl.Store.Usage.ByModel(start, end)
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+	usageByApp, err := ctl.Store.Usage.ByApp(start, end)
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
 	}
 
-	estimatedCost := float64(assistantMessageWordCount) / 1000 * 0.002
+	var estimatedCost float64
+	for _, item := range usageTotal {
+		if item.Currency == models.DefaultCurrency {
+			estimatedCost += item.Cost
+		}
+	}
 
 	ctl.Success(c, gin.H{
 		"app_count":      applicationCount,
 		"chat_count":     chatCount,
 		"use_api_count":  messageCount,
 		"estimated_cost": estimatedCost,
+		"usage_total":    usageTotal,
+		"usage_by_model": usageByModel,
+		"usage_by_app":   usageByApp,
 	})
 }
 
 func (ctl *Config) PingOpenAI(c *gin.Context) {
 
-	status := false
-	callback := ""
-
-	secret_key := helper.Config.OpenAI.SecretKey
-	if secret_key != "" {
-		proxy_host := helper.Config.OpenAI.HttpProxyHost
-		proxy_port := helper.Config.OpenAI.HttpProxyPort
-		status, callback = helper.PingOpenAI(secret_key, proxy_host, proxy_port)
-	}
+	// 检查当前配置的上游服务提供方
+	status, callback := helper.PingProvider(ctl.Store.Config, "")
 
 	ctl.Success(c, gin.H{
 		"status":   status,
@@ -102,7 +131,7 @@ func (ctl *Config) PingOpenAI(c *gin.Context) {
 }
 
 func (ctl *Config) ConfigInfo(c *gin.Context) {
-	systemConfig := helper.Config
+	systemConfig := ctl.Store.Config
 	openAiConfig := systemConfig.OpenAI
 
 	ctl.Success(c, gin.H{
@@ -117,6 +146,22 @@ func (ctl *Config) ConfigInfo(c *gin.Context) {
 			"openai_proxy_host": openAiConfig.HttpProxyHost,
 			"openai_proxy_port": openAiConfig.HttpProxyPort,
 		},
+		"azure_config": gin.H{
+			"azure_enable":      systemConfig.Provider == helper.AzureProviderName,
+			"azure_endpoint":    systemConfig.Azure.Endpoint,
+			"azure_api_key":     systemConfig.Azure.ApiKey,
+			"azure_api_version": systemConfig.GetAzureApiVersion(),
+			"azure_proxy_host":  systemConfig.Azure.HttpProxyHost,
+			"azure_proxy_port":  systemConfig.Azure.HttpProxyPort,
+			"azure_deployments": systemConfig.Azure.Deployments,
+		},
+		"ollama_config": gin.H{
+			"ollama_base_url": systemConfig.Ollama.BaseUrl,
+		},
+		"filter_config": gin.H{
+			"filter_action": systemConfig.Filter.Action,
+		},
+		"providers": helper.ProviderNames(),
 	})
 }
 
@@ -134,6 +179,12 @@ func (ctl *Config) ConfigInfoSave(c *gin.Context) {
 		err = ctl.siteConfig(data)
 	case "openai":
 		err = ctl.openaiConfig(data)
+	case "azure":
+		err = ctl.azureConfig(data)
+	case "ollama":
+		err = ctl.ollamaConfig(data)
+	case "filter":
+		err = ctl.filterConfig(data)
 	}
 	if err != nil {
 		ctl.Fail(c, err.Error())
@@ -183,11 +234,11 @@ func (ctl *Config) siteConfig(data string) error {
 		return errors.New("应用端口错误")
 	}
 
-	helper.Config.SiteName = config.SiteName
-	helper.Config.DomainName = config.DomainName
-	helper.Config.Port = port
+	ctl.Store.Config.SiteName = config.SiteName
+	ctl.Store.Config.DomainName = config.DomainName
+	ctl.Store.Config.Port = port
 
-	if err := helper.Config.SaveConfig(); err != nil {
+	if err := ctl.Store.Config.SaveConfig(); err != nil {
 		return err
 	}
 
@@ -212,17 +263,132 @@ func (ctl *Config) openaiConfig(data string) error {
 		return errors.New("OpenAI SecretKey 填写错误")
 	}
 
-	status, callback := helper.PingOpenAI(config.SecretKey, config.ProxyHost, config.ProxyPort)
+	status, callback := ctl.Store.Config.PingOpenAI(config.SecretKey, config.ProxyHost, config.ProxyPort)
 	if !status {
 		return errors.New("OpenAI 服务器连接失败，" + callback)
 	}
 
-	helper.Config.OpenAI.SecretKey = config.SecretKey
-	helper.Config.OpenAI.HttpProxyHost = config.ProxyHost
-	helper.Config.OpenAI.HttpProxyPort = config.ProxyPort
-	helper.Config.OpenAI.Model = config.Model
+	ctl.Store.Config.OpenAI.SecretKey = config.SecretKey
+	ctl.Store.Config.OpenAI.HttpProxyHost = config.ProxyHost
+	ctl.Store.Config.OpenAI.HttpProxyPort = config.ProxyPort
+	ctl.Store.Config.OpenAI.Model = config.Model
+
+	if err := ctl.Store.Config.SaveConfig(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// 配置 Azure OpenAI
+func (ctl *Config) azureConfig(data string) error {
+	type AzureConfig struct {
+		Enable      bool              `json:"azure_enable"`
+		Endpoint    string            `json:"azure_endpoint"`
+		ApiKey      string            `json:"azure_api_key"`
+		ApiVersion  string            `json:"azure_api_version"`
+		ProxyHost   string            `json:"azure_proxy_host"`
+		ProxyPort   string            `json:"azure_proxy_port"`
+		Deployments map[string]string `json:"azure_deployments"`
+	}
+
+	var config AzureConfig
+	if err := json.Unmarshal([]byte(data), &config); err != nil {
+		return errors.New("参数填写错误")
+	}
+
+	endpoint, err := url.Parse(config.Endpoint)
+	if config.Endpoint == "" || err != nil || endpoint.Host == "" {
+		return errors.New("Azure Endpoint 填写错误")
+	}
+
+	if config.ApiKey == "" {
+		return errors.New("Azure ApiKey 填写错误")
+	}
+
+	tmpConfig := &helper.DefaultConfig{}
+	tmpConfig.SetHttpClient(ctl.Store.Config.HttpClient())
+	tmpConfig.Azure.Endpoint = config.Endpoint
+	tmpConfig.Azure.ApiKey = config.ApiKey
+	tmpConfig.Azure.ApiVersion = config.ApiVersion
+	tmpConfig.Azure.HttpProxyHost = config.ProxyHost
+	tmpConfig.Azure.HttpProxyPort = config.ProxyPort
+	status, callback := helper.PingProvider(tmpConfig, helper.AzureProviderName)
+	if !status {
+		return errors.New("Azure OpenAI 服务器连接失败，" + callback)
+	}
+
+	ctl.Store.Config.Azure.Endpoint = config.Endpoint
+	ctl.Store.Config.Azure.ApiKey = config.ApiKey
+	ctl.Store.Config.Azure.ApiVersion = config.ApiVersion
+	ctl.Store.Config.Azure.HttpProxyHost = config.ProxyHost
+	ctl.Store.Config.Azure.HttpProxyPort = config.ProxyPort
+	ctl.Store.Config.Azure.Deployments = config.Deployments
+
+	if config.Enable {
+		ctl.Store.Config.Provider = helper.AzureProviderName
+	} else if ctl.Store.Config.Provider == helper.AzureProviderName {
+		ctl.Store.Config.Provider = helper.DefaultProviderName
+	}
+
+	if err := ctl.Store.Config.SaveConfig(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// 配置本地推理服务
+func (ctl *Config) ollamaConfig(data string) error {
+	type OllamaConfig struct {
+		BaseUrl string `json:"ollama_base_url"`
+	}
+
+	var config OllamaConfig
+	if err := json.Unmarshal([]byte(data), &config); err != nil {
+		return errors.New("参数填写错误")
+	}
+
+	baseUrl, err := url.Parse(config.BaseUrl)
+	if config.BaseUrl == "" || err != nil || baseUrl.Host == "" {
+		return errors.New("Ollama 服务地址填写错误")
+	}
+
+	tmpConfig := &helper.DefaultConfig{}
+	tmpConfig.SetHttpClient(ctl.Store.Config.HttpClient())
+	tmpConfig.Ollama.BaseUrl = config.BaseUrl
+	status, callback := helper.PingProvider(tmpConfig, helper.OllamaProviderName)
+	if !status {
+		return errors.New("Ollama 服务器连接失败，" + callback)
+	}
+
+	ctl.Store.Config.Ollama.BaseUrl = config.BaseUrl
+
+	if err := ctl.Store.Config.SaveConfig(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// 配置敏感词过滤
+func (ctl *Config) filterConfig(data string) error {
+	type FilterConfig struct {
+		Action string `json:"filter_action"`
+	}
+
+	var config FilterConfig
+	if err := json.Unmarshal([]byte(data), &config); err != nil {
+		return errors.New("参数填写错误")
+	}
+
+	if !filter.IsAction(config.Action) {
+		return errors.New("敏感词处理方式错误")
+	}
+
+	ctl.Store.Config.Filter.Action = config.Action
 
-	if err := helper.Config.SaveConfig(); err != nil {
+	if err := ctl.Store.Config.SaveConfig(); err != nil {
 		return err
 	}
 
@@ -6,6 +6,7 @@
 package apis
 
 import (
+	"errors"
 	"gpt-zmide-server/models"
 	"net/http"
 
@@ -27,6 +28,31 @@ func (ctl *Controller) Fail(c *gin.Context, massage string) {
 	c.JSON(http.StatusOK, gin.H{"status": "fail", "code": 400, "data": nil, "msg": massage})
 }
 
+// 统一请求失败回调数据结构，指定 HTTP 状态码并中断后续处理
+func (ctl *Controller) FailStatus(c *gin.Context, httpStatus int, massage string) {
+	c.AbortWithStatusJSON(httpStatus, gin.H{"status": "fail", "code": httpStatus, "data": nil, "msg": massage})
+}
+
+// 业务错误对应的响应代码，应用预算用尽时为 402，超出限流时为 429
+func errorCode(err error) int {
+	if errors.Is(err, models.ErrBudgetExceeded) {
+		return http.StatusPaymentRequired
+	}
+	if errors.Is(err, models.ErrRateLimited) {
+		return http.StatusTooManyRequests
+	}
+	return http.StatusBadRequest
+}
+
+// 统一业务错误回调，应用预算用尽时返回 402，超出限流时返回 429
+func (ctl *Controller) FailError(c *gin.Context, err error) {
+	if code := errorCode(err); code != http.StatusBadRequest {
+		ctl.FailStatus(c, code, err.Error())
+		return
+	}
+	ctl.Fail(c, err.Error())
+}
+
 // 统一请求成功分页列表数据回调数据结构
 func (ctl *Controller) SuccessList(c *gin.Context, list interface{}, pageForm *models.PaginateForm, pageTotal int) {
 	ctl.Success(c, gin.H{
@@ -0,0 +1,174 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/controllers/apis/embedding.go
+ */
+package apis
+
+import (
+	"encoding/json"
+	"errors"
+	"gpt-zmide-server/helper"
+	"gpt-zmide-server/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 解析向量请求，兼容加密数据及表单提交
+func bindEmbeddingRequest(c *gin.Context) (req *helper.EmbeddingRequest, err error) {
+	req = &helper.EmbeddingRequest{}
+	if bodyMap := c.GetStringMap(helper.PostBodyKey); bodyMap != nil {
+		body, err := json.Marshal(bodyMap)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(body, req)
+		return req, err
+	}
+
+	if c.ContentType() == gin.MIMEPOSTForm || c.ContentType() == gin.MIMEMultipartPOSTForm {
+		req.Model = c.PostForm("model")
+		req.EncodingFormat = c.PostForm("encoding_format")
+		if input := c.PostFormArray("input"); len(input) == 1 {
+			req.Input = input[0]
+		} else if len(input) > 1 {
+			req.Input = input
+		}
+		return req, nil
+	}
+
+	err = c.ShouldBindJSON(req)
+	return req, err
+}
+
+// 调用上游向量接口并记录用量，失败时返回对应的 HTTP 状态码
+func createEmbedding(c *gin.Context, store *models.Stores, app *models.Application, req *helper.EmbeddingRequest) (*helper.EmbeddingResponse, int, error) {
+	texts, tokens, err := helper.EmbeddingInputs(req.Input)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if len(texts) < 1 && tokens < 1 {
+		return nil, http.StatusBadRequest, errors.New("input 不能为空")
+	}
+
+	// 未指定模型时使用默认向量模型，并校验应用允许调用的模型
+	if req.Model == "" {
+		req.Model = helper.DefaultEmbeddingModel
+	}
+	model, err := store.ResolveModel(app, req.Model)
+	if err != nil {
+		return nil, http.StatusForbidden, err
+	}
+	req.Model = model
+
+	// 应用预算用尽时拒绝请求
+	if err = store.CheckBudget(app); err != nil {
+		return nil, http.StatusPaymentRequired, err
+	}
+
+	// 文本输入敏感词过滤
+	if len(texts) > 0 {
+		for i, text := range texts {
+			if texts[i], err = store.FilterContent(app, text, "user"); err != nil {
+				return nil, http.StatusBadRequest, err
+			}
+			tokens += helper.CountTokens(model, texts[i])
+		}
+		if _, ok := req.Input.(string); ok {
+			req.Input = texts[0]
+		} else {
+			req.Input = texts
+		}
+	}
+
+	req.Provider = app.Provider
+	startAt := time.Now()
+	res, err := store.Config.Embed(*req)
+	if err != nil {
+		return nil, http.StatusBadGateway, err
+	}
+
+	// 记录用量，上游未返回用量时本地计算
+	record := &models.UsageRecord{
+		AppID:        app.ID,
+		Kind:         models.UsageKindEmbedding,
+		Remark:       c.Request.URL.Path,
+		Model:        res.Model,
+		RequestID:    res.RequestID,
+		PromptTokens: res.Usage.PromptTokens,
+		TotalTokens:  res.Usage.TotalTokens,
+		LatencyMs:    time.Since(startAt).Milliseconds(),
+	}
+	if record.Model == "" {
+		record.Model = model
+	}
+	if record.TotalTokens == 0 {
+		record.UsageEstimated = true
+		record.PromptTokens = tokens
+		record.TotalTokens = tokens
+	}
+	store.CalcRecordCost(record, time.Now(), record.Model, model)
+	if err = store.Usage.Record(record); err != nil {
+		store.Log().Error("usage record create error " + err.Error())
+	}
+	store.RecordUsage(app, record.TotalTokens, record.Cost, record.Currency)
+	c.Set(helper.UsageTokensKey, record.TotalTokens)
+
+	if res.Object == "" {
+		res.Object = "list"
+	}
+	return res, http.StatusOK, nil
+}
+
+// 获取文本向量
+func (ctl *Open) Embeddings(c *gin.Context) {
+	app, ok := c.MustGet(helper.MiddlewareAuthAppKey).(*models.Application)
+	if !ok || app == nil || app.Status != 1 {
+		ctl.Fail(c, "应用异常")
+		return
+	}
+
+	req, err := bindEmbeddingRequest(c)
+	if err != nil {
+		ctl.Fail(c, "请求参数异常")
+		return
+	}
+
+	res, _, err := createEmbedding(c, ctl.Store, app, req)
+	if err != nil {
+		ctl.FailError(c, err)
+		return
+	}
+	ctl.Success(c, res)
+}
+
+// 获取文本向量，请求及响应格式与 OpenAI 一致
+func (ctl *Gateway) Embeddings(c *gin.Context) {
+	app := gatewayApp(c)
+	if app == nil || app.Status != 1 {
+		OpenAIError(c, http.StatusUnauthorized, "invalid_request_error", "invalid_api_key", "Incorrect API key provided.")
+		return
+	}
+
+	req := &helper.EmbeddingRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		OpenAIError(c, http.StatusBadRequest, "invalid_request_error", "", "We could not parse the JSON body of your request.")
+		return
+	}
+
+	res, status, err := createEmbedding(c, ctl.Store, app, req)
+	if err != nil {
+		switch status {
+		case http.StatusBadGateway:
+			OpenAIError(c, status, "upstream_error", "", err.Error())
+		case http.StatusForbidden:
+			OpenAIError(c, status, "invalid_request_error", "model_not_found", err.Error())
+		default:
+			openAIFailError(c, err)
+		}
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,437 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/controllers/apis/gateway.go
+ */
+package apis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"gpt-zmide-server/helper"
+	"gpt-zmide-server/helper/filter"
+	"gpt-zmide-server/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 兼容 OpenAI 协议的网关接口，OpenAI SDK 修改 base url 即可接入
+type Gateway struct {
+	Controller
+	Store *models.Stores
+}
+
+// 按 OpenAI 格式返回错误并中断后续处理
+func OpenAIError(c *gin.Context, httpStatus int, errType string, code string, message string) {
+	var errCode interface{}
+	if code != "" {
+		errCode = code
+	}
+	c.AbortWithStatusJSON(httpStatus, gin.H{
+		"error": gin.H{
+			"message": message,
+			"type":    errType,
+			"param":   nil,
+			"code":    errCode,
+		},
+	})
+}
+
+// 将业务错误转换为 OpenAI 格式错误
+func openAIFailError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrBudgetExceeded):
+		OpenAIError(c, http.StatusPaymentRequired, "insufficient_quota", "insufficient_quota", err.Error())
+	case errors.Is(err, models.ErrSensitiveContent):
+		OpenAIError(c, http.StatusBadRequest, "invalid_request_error", "content_filter", err.Error())
+	default:
+		OpenAIError(c, http.StatusBadRequest, "invalid_request_error", "", err.Error())
+	}
+}
+
+// 解析上游返回的错误信息
+func upstreamErrorMessage(raw string) string {
+	var body struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal([]byte(raw), &body) == nil && body.Error.Message != "" {
+		return body.Error.Message
+	}
+	return "upstream response error"
+}
+
+func gatewayApp(c *gin.Context) *models.Application {
+	app, _ := c.MustGet(helper.MiddlewareAuthAppKey).(*models.Application)
+	return app
+}
+
+// 可用模型列表
+func (ctl *Gateway) Models(c *gin.Context) {
+	app := gatewayApp(c)
+	if app == nil {
+		OpenAIError(c, http.StatusUnauthorized, "invalid_request_error", "invalid_api_key", "Incorrect API key provided.")
+		return
+	}
+
+	var list []*helper.ProviderModel
+	if allowed := app.AllowedModelList(); len(allowed) > 0 {
+		for _, id := range allowed {
+			list = append(list, &helper.ProviderModel{ID: id, OwnedBy: ctl.Store.Config.SiteName})
+		}
+	} else if provider, err := ctl.Store.Config.GetProvider(app.Provider); err == nil {
+		if list, err = provider.ListModels(); err != nil {
+			ctl.Store.Log().Warn("gateway list models error " + err.Error())
+		}
+	}
+
+	// 上游获取失败时返回默认模型
+	if len(list) < 1 {
+		model, _ := ctl.Store.ResolveModel(app, "")
+		list = append(list, &helper.ProviderModel{ID: model, OwnedBy: ctl.Store.Config.SiteName})
+	}
+	for _, item := range list {
+		item.Object = "model"
+	}
+
+	c.JSON(http.StatusOK, gin.H{"object": "list", "data": list})
+}
+
+// 对话补全，请求及响应格式与 OpenAI 一致
+func (ctl *Gateway) ChatCompletions(c *gin.Context) {
+	app := gatewayApp(c)
+	if app == nil || app.Status != 1 {
+		OpenAIError(c, http.StatusUnauthorized, "invalid_request_error", "invalid_api_key", "Incorrect API key provided.")
+		return
+	}
+
+	// bodyMap 用于原样转发未识别的参数
+	rawBody, err := c.GetRawData()
+	var bodyMap map[string]interface{}
+	if err == nil {
+		err = json.Unmarshal(rawBody, &bodyMap)
+	}
+	var req helper.ChatRequest
+	if err == nil {
+		err = json.Unmarshal(rawBody, &req)
+	}
+	if err != nil || bodyMap == nil {
+		OpenAIError(c, http.StatusBadRequest, "invalid_request_error", "", "We could not parse the JSON body of your request.")
+		return
+	}
+	if len(req.Messages) < 1 {
+		OpenAIError(c, http.StatusBadRequest, "invalid_request_error", "", "messages is required.")
+		return
+	}
+
+	// 校验应用允许调用的模型
+	model, err := ctl.Store.ResolveModel(app, req.Model)
+	if err != nil {
+		OpenAIError(c, http.StatusForbidden, "invalid_request_error", "model_not_found", err.Error())
+		return
+	}
+
+	// 应用预算用尽时拒绝请求
+	if err = ctl.Store.CheckBudget(app); err != nil {
+		openAIFailError(c, err)
+		return
+	}
+
+	// 用户消息敏感词过滤，内容被替换时重写请求消息
+	filtered := false
+	for _, item := range req.Messages {
+		if item.Role != "user" {
+			continue
+		}
+		content, err := ctl.Store.FilterContent(app, item.Content, "user")
+		if err != nil {
+			openAIFailError(c, err)
+			return
+		}
+		if content == item.Content {
+			continue
+		}
+		item.Content = content
+		filtered = true
+		// 多模态消息逐个替换文本片段
+		for _, part := range item.Parts {
+			if part.Type == "text" {
+				part.Text, _ = ctl.Store.SensitiveMatcher(app.ID).Mask(part.Text)
+			}
+		}
+	}
+	if filtered {
+		bodyMap["messages"] = req.Messages
+	}
+
+	// 应用系统提示词及默认参数
+	if app.SystemPrompt != "" {
+		systemMsg := &helper.ChatMessage{Role: "system", Content: app.SystemPrompt}
+		req.Messages = append([]*helper.ChatMessage{systemMsg}, req.Messages...)
+		if messages, ok := bodyMap["messages"].([]interface{}); ok {
+			bodyMap["messages"] = append([]interface{}{systemMsg}, messages...)
+		} else {
+			bodyMap["messages"] = req.Messages
+		}
+	}
+	defaults := map[string]interface{}{}
+	if app.Temperature != 0 {
+		defaults["temperature"] = app.Temperature
+	}
+	if app.TopP != 0 {
+		defaults["top_p"] = app.TopP
+	}
+	if app.MaxTokens != 0 {
+		defaults["max_tokens"] = app.MaxTokens
+	}
+	for key, value := range defaults {
+		if _, ok := bodyMap[key]; !ok {
+			bodyMap[key] = value
+		}
+	}
+	bodyMap["model"] = model
+	bodyMap["stream"] = req.Stream
+
+	// 客户端是否要求返回流式用量
+	includeUsage := req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+	provider, err := ctl.Store.Config.GetProvider(app.Provider)
+	if err != nil {
+		OpenAIError(c, http.StatusInternalServerError, "server_error", "", err.Error())
+		return
+	}
+	if usageProvider, ok := provider.(helper.StreamUsageProvider); ok && req.Stream && usageProvider.IncludeStreamUsage() {
+		bodyMap["stream_options"] = &helper.StreamOptions{IncludeUsage: true}
+	}
+
+	reqBody, err := json.Marshal(bodyMap)
+	if err != nil {
+		OpenAIError(c, http.StatusBadRequest, "invalid_request_error", "", err.Error())
+		return
+	}
+
+	// 记录请求会话，便于后台查看及用量统计
+	chat := &models.Chat{AppID: app.ID, Model: model, Remark: c.Request.URL.Path}
+	if err = ctl.Store.Chats.Create(chat); err != nil {
+		OpenAIError(c, http.StatusInternalServerError, "server_error", "", "chat 处理异常")
+		return
+	}
+	if last := req.Messages[len(req.Messages)-1]; last.Role == "user" || last.Role == "tool" {
+		ctl.Store.Messages.Create(&models.Message{ChatID: chat.ID, Role: last.Role, Content: last.Content, Name: last.Name, ToolCallID: last.ToolCallID})
+	}
+
+	chatReq := helper.ChatRequest{
+		Model:    model,
+		RawBody:  reqBody,
+		Provider: app.Provider,
+		Context:  c.Request.Context(), // 客户端断开时取消上游请求
+	}
+	promptTokens := helper.CountChatTokens(model, req.Messages) + helper.CountToolsTokens(model, req.Tools)
+
+	if req.Stream {
+		ctl.chatStream(c, app, chat, chatReq, promptTokens, includeUsage)
+		return
+	}
+
+	startAt := time.Now()
+	res, err := ctl.Store.Config.ChatGptAsk(chatReq)
+	if errors.Is(err, context.Canceled) {
+		// 客户端已断开，无需返回错误
+		ctl.Store.Log().Info("gateway chat#" + strconv.Itoa(int(chat.ID)) + " cancelled by client")
+		return
+	}
+	if err != nil {
+		OpenAIError(c, http.StatusBadGateway, "upstream_error", "", err.Error())
+		return
+	}
+	if len(res.Choices) < 1 || res.Choices[0].Message == nil {
+		ctl.Store.Log().Warn("gateway upstream response unusual " + res.Raw)
+		OpenAIError(c, http.StatusBadGateway, "upstream_error", "", upstreamErrorMessage(res.Raw))
+		return
+	}
+
+	choiceFirst := res.Choices[0]
+	msg := &models.Message{
+		ChatID:    chat.ID,
+		Raw:       res.Raw,
+		Role:      choiceFirst.Message.Role,
+		Content:   choiceFirst.Message.Content,
+		ToolCalls: choiceFirst.Message.ToolCalls,
+	}
+	msg.SetUsage(res, model, promptTokens, startAt, time.Time{})
+	ctl.Store.CalcCost(msg, time.Now(), msg.Model, model)
+	ctl.Store.RecordUsage(app, msg.TotalTokens, msg.Cost, msg.Currency)
+	c.Set(helper.UsageTokensKey, msg.TotalTokens)
+
+	// 回复敏感词过滤，拒绝时按 OpenAI 方式返回 content_filter
+	if content, err := ctl.Store.FilterContent(app, msg.Content, "assistant"); err != nil {
+		msg.Content = ""
+		msg.FinishReason = "content_filter"
+	} else {
+		msg.Content = content
+	}
+	choiceFirst.Message.Content = msg.Content
+	choiceFirst.FinishReason = msg.FinishReason
+
+	if err = ctl.Store.Messages.Create(msg); err != nil {
+		ctl.Store.Log().Error("message create error " + err.Error())
+	}
+
+	if res.Object == "" {
+		res.Object = "chat.completion"
+	}
+	if res.Model == "" {
+		res.Model = model
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// 流式对话补全
+func (ctl *Gateway) chatStream(c *gin.Context, app *models.Application, chat *models.Chat, chatReq helper.ChatRequest, promptTokens int64, includeUsage bool) {
+	// 回复内容敏感词过滤
+	var sensitive *filter.Stream
+	action := filter.ActionLog
+	if m := ctl.Store.SensitiveMatcher(app.ID); !m.Empty() {
+		action = ctl.Store.SensitiveAction(app)
+		sensitive = m.NewStream(action == filter.ActionMask)
+	}
+	rejected := false
+
+	wrote := false
+	writeChunk := func(data interface{}) {
+		if !wrote {
+			// 设置流式响应头
+			c.Header("Content-Type", "text/event-stream;charset=utf-8")
+			c.Header("Cache-Control", "no-cache")
+			c.Header("Connection", "keep-alive")
+			c.Header("X-Accel-Buffering", "no") // 禁用nginx缓冲
+			wrote = true
+		}
+		jsonStr, _ := json.Marshal(data)
+		c.Writer.WriteString("data: " + string(jsonStr) + "\n\n")
+		c.Writer.Flush()
+	}
+
+	var last *helper.OpenAIResponseStream
+	startAt := time.Now()
+	var firstTokenAt time.Time
+
+	res, err := ctl.Store.Config.ChatGptAsk(chatReq, func(line *helper.OpenAIResponseStream) {
+		if firstTokenAt.IsZero() {
+			firstTokenAt = time.Now()
+		}
+		last = line
+		if rejected {
+			return
+		}
+		if line.Object == "" {
+			line.Object = "chat.completion.chunk"
+		}
+		line.Usage = nil
+
+		choice := line.Choices[0]
+		if sensitive != nil {
+			var matches []filter.Match
+			choice.Delta.Content, matches = sensitive.Write(choice.Delta.Content)
+			if len(matches) > 0 {
+				ctl.Store.LogSensitive(app, "assistant", action, matches)
+				if action == filter.ActionReject {
+					// 命中后不再推送后续内容
+					rejected = true
+					choice.Delta = helper.ChatStreamDelta{}
+					choice.FinishReason = "content_filter"
+					writeChunk(line)
+					return
+				}
+			}
+			// 结束前输出过滤器中暂存的剩余内容
+			if choice.FinishReason != "" {
+				choice.Delta.Content += sensitive.Flush()
+			}
+		}
+		writeChunk(line)
+	})
+
+	if errors.Is(err, context.Canceled) && !wrote {
+		ctl.Store.Log().Info("gateway chat#" + strconv.Itoa(int(chat.ID)) + " cancelled by client")
+		return
+	}
+	if err != nil && !wrote {
+		OpenAIError(c, http.StatusBadGateway, "upstream_error", "", err.Error())
+		return
+	}
+	// 已开始输出后上游出错时按 OpenAI 方式输出错误分片
+	if err != nil && !errors.Is(err, context.Canceled) {
+		ctl.Store.Log().Warn("gateway stream error " + err.Error())
+		writeChunk(gin.H{"error": gin.H{"message": err.Error(), "type": "upstream_error", "param": nil, "code": nil}})
+	}
+	if res == nil || len(res.Choices) < 1 {
+		if !wrote {
+			message := "upstream response error"
+			if res != nil {
+				message = upstreamErrorMessage(res.Raw)
+			}
+			OpenAIError(c, http.StatusBadGateway, "upstream_error", "", message)
+			return
+		}
+		c.Writer.WriteString("data: [DONE]\n\n")
+		return
+	}
+
+	msg := &models.Message{
+		ChatID:    chat.ID,
+		Raw:       res.Raw,
+		Role:      res.Choices[0].Message.Role,
+		Content:   res.Choices[0].Message.Content,
+		ToolCalls: res.Choices[0].Message.ToolCalls,
+	}
+	msg.SetUsage(res, chatReq.Model, promptTokens, startAt, firstTokenAt)
+	ctl.Store.CalcCost(msg, time.Now(), msg.Model, chatReq.Model)
+	ctl.Store.RecordUsage(app, msg.TotalTokens, msg.Cost, msg.Currency)
+	c.Set(helper.UsageTokensKey, msg.TotalTokens)
+
+	// 上游未返回结束分片时补充输出暂存内容
+	if sensitive != nil && !rejected {
+		if content := sensitive.Flush(); content != "" && last != nil {
+			writeChunk(&helper.OpenAIResponseStream{
+				ID:      last.ID,
+				Model:   last.Model,
+				Object:  "chat.completion.chunk",
+				Created: last.Created,
+				Choices: []*helper.ChatStreamChoice{{Delta: helper.ChatStreamDelta{Content: content}}},
+			})
+		}
+	}
+
+	if rejected {
+		msg.Content = ""
+		msg.FinishReason = "content_filter"
+	} else if sensitive != nil && action == filter.ActionMask {
+		msg.Content, _ = sensitive.Matcher().Mask(msg.Content)
+	}
+	if err = ctl.Store.Messages.Create(msg); err != nil {
+		ctl.Store.Log().Error("message create error " + err.Error())
+	}
+
+	// 按客户端要求在最后输出用量
+	if includeUsage && last != nil {
+		writeChunk(&helper.OpenAIResponseStream{
+			ID:      last.ID,
+			Model:   last.Model,
+			Object:  "chat.completion.chunk",
+			Created: last.Created,
+			Choices: []*helper.ChatStreamChoice{},
+			Usage: &helper.ChatUsage{
+				PromptTokens:     msg.PromptTokens,
+				CompletionTokens: msg.CompletionTokens,
+				TotalTokens:      msg.TotalTokens,
+			},
+		})
+	}
+	c.Writer.WriteString("data: [DONE]\n\n")
+	c.Writer.Flush()
+}
@@ -0,0 +1,151 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/controllers/apis/model_price.go
+ */
+package apis
+
+import (
+	"gpt-zmide-server/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ModelPrice struct {
+	Controller
+	Store *models.Stores
+}
+
+// 解析价格表单，字段为空时保持原值
+func bindModelPrice(c *gin.Context, price *models.ModelPrice) error {
+	if model, ok := c.GetPostForm("model"); ok {
+		price.Model = model
+	}
+	if currency, ok := c.GetPostForm("currency"); ok {
+		price.Currency = currency
+	}
+	if p, ok := c.GetPostForm("input_price"); ok {
+		value, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return err
+		}
+		price.InputPrice = value
+	}
+	if p, ok := c.GetPostForm("output_price"); ok {
+		value, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return err
+		}
+		price.OutputPrice = value
+	}
+
+	parseTime := func(key string) (*models.LocalTime, bool, error) {
+		value, ok := c.GetPostForm(key)
+		if !ok {
+			return nil, false, nil
+		}
+		// 传空值表示清除
+		if value == "" {
+			return nil, true, nil
+		}
+		t, err := time.ParseInLocation("2006-01-02 15:04:05", value, time.Local)
+		if err != nil {
+			return nil, true, err
+		}
+		return &models.LocalTime{Time: t}, true, nil
+	}
+	if t, ok, err := parseTime("effective_from"); err != nil {
+		return err
+	} else if ok {
+		price.EffectiveFrom = t
+	}
+	if t, ok, err := parseTime("effective_to"); err != nil {
+		return err
+	} else if ok {
+		price.EffectiveTo = t
+	}
+	return price.Validate()
+}
+
+// 查看模型价格表
+func (ctl *ModelPrice) Index(c *gin.Context) {
+	list, err := ctl.Store.ModelPrices.List()
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+	ctl.Success(c, list)
+}
+
+// 添加模型价格
+func (ctl *ModelPrice) Create(c *gin.Context) {
+	price := &models.ModelPrice{}
+	if err := bindModelPrice(c, price); err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+
+	if err := ctl.Store.ModelPrices.Create(price); err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+	ctl.Store.ReloadModelPrices()
+
+	ctl.Success(c, price)
+}
+
+// 修改模型价格，仅影响之后写入的消息
+func (ctl *ModelPrice) Update(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+
+	price, err := ctl.Store.ModelPrices.Get(uint(id))
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+
+	if err = bindModelPrice(c, price); err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+
+	// 价格允许为 0，生效时间允许清空，按字段更新
+	err = ctl.Store.ModelPrices.Update(price, map[string]interface{}{
+		"model":          price.Model,
+		"currency":       price.Currency,
+		"input_price":    price.InputPrice,
+		"output_price":   price.OutputPrice,
+		"effective_from": price.EffectiveFrom,
+		"effective_to":   price.EffectiveTo,
+	})
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+	ctl.Store.ReloadModelPrices()
+
+	ctl.Success(c, price)
+}
+
+// 删除模型价格
+func (ctl *ModelPrice) Delete(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+
+	if err = ctl.Store.ModelPrices.Delete(uint(id)); err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+	ctl.Store.ReloadModelPrices()
+
+	ctl.Success(c, "ok")
+}
@@ -6,16 +6,21 @@
 package apis
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"gpt-zmide-server/helper"
 	"gpt-zmide-server/models"
+	"io"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type Open struct {
 	Controller
+	Store *models.Stores
 }
 
 func (ctl *Open) Index(c *gin.Context) {
@@ -39,10 +44,13 @@ func (ctl *Open) Query(c *gin.Context) {
 		return
 	}
 
-	var content, p_chat_id, p_remark, model string
+	var content, p_chat_id, p_remark, model, role, toolCallID, name string
 
 	if bodyMap != nil {
-		content = bodyMap["content"].(string)
+		content, _ = bodyMap["content"].(string)
+		role, _ = bodyMap["role"].(string)
+		toolCallID, _ = bodyMap["tool_call_id"].(string)
+		name, _ = bodyMap["name"].(string)
 
 		if chatID, ok := bodyMap["chat_id"].(string); ok {
 			p_chat_id = chatID
@@ -60,69 +68,54 @@ func (ctl *Open) Query(c *gin.Context) {
 		p_chat_id = c.PostForm("chat_id")
 		p_remark = c.PostForm("remark")
 		model = c.PostForm("model")
+		role = c.PostForm("role")
+		toolCallID = c.PostForm("tool_call_id")
+		name = c.PostForm("name")
 	}
 
-	// content 参数为必传
-	if content == "" {
-		ctl.Fail(c, "参数异常1")
+	// content 为内容片段数组时解析其中的文本及图片
+	text, images, err := bindMessageImages(c)
+	if err != nil {
+		ctl.Fail(c, err.Error())
 		return
 	}
-
-	// 当 model 不存在时，使用配置的默认 model
-	if model == "" {
-		model = helper.Config.OpenAI.Model
-	}
-
-	chat := &models.Chat{}
-
-	chat.Model = model
-
-	if p_chat_id != "" {
-		if id, err := strconv.Atoi(p_chat_id); err == nil && id != 0 {
-			// 当 chat_id 合法时，去数据库查找 chat
-			chat.ID = uint(id)
-			if err := models.DB.First(chat).Error; err != nil || chat.AppID != app.ID {
-				ctl.Fail(c, "chat_id 不合法")
-				return
-			}
-			chat.AppID = app.ID
-		}
+	if text != "" {
+		content = text
 	}
 
-	if chat.AppID == 0 {
-		chat.AppID = app.ID
-		if err := models.DB.Create(chat).Error; err != nil {
-			ctl.Fail(c, "chat 处理异常")
-			return
-		}
+	params := &chatParams{
+		Content:    content,
+		ChatID:     p_chat_id,
+		Remark:     p_remark,
+		Model:      model,
+		Role:       role,
+		ToolCallID: toolCallID,
+		Name:       name,
+		Images:     images,
 	}
-
-	// 当 remark 参数存在时更新 chat remark
-	if p_remark != "" {
-		chat.Remark = p_remark
-		models.DB.Updates(chat)
-	}
-
-	message := &models.Message{
-		ChatID:  chat.ID,
-		Role:    "user",
-		Content: content,
-		Raw:     "",
+	if params.Tools, params.ToolChoice, err = bindChatTools(c); err != nil {
+		ctl.Fail(c, err.Error())
+		return
 	}
 
-	if err := models.DB.Create(message).Error; err != nil {
-		ctl.Fail(c, "消息处理失败")
+	chat, err := prepareChat(ctl.Store, app, params)
+	if err != nil {
+		ctl.FailError(c, err)
 		return
 	}
 
-	// 刷新 chat Messages
-	models.DB.Preload("Messages").Find(chat)
-
+	chat.Context = c.Request.Context()
 	callback, err := chat.QueryChatGPT(false)
+	if errors.Is(err, context.Canceled) {
+		// 客户端已断开，无需返回错误
+		ctl.Store.Log().Info("chat#" + strconv.Itoa(int(chat.ID)) + " cancelled by client")
+		return
+	}
 	if err != nil {
-		ctl.Fail(c, err.Error())
+		ctl.FailError(c, err)
 		return
 	}
+	c.Set(helper.UsageTokensKey, callback.TotalTokens)
 
 	ctl.Success(c, callback)
 }
@@ -147,89 +140,339 @@ func (ctl *Open) Chat(c *gin.Context) {
 	p_chat_id := c.DefaultPostForm("chat_id", bodyMap["chat_id"])
 	p_remark := c.DefaultPostForm("remark", bodyMap["remark"])
 	model := c.DefaultPostForm("model", bodyMap["model"])
+	role := c.DefaultPostForm("role", bodyMap["role"])
+	toolCallID := c.DefaultPostForm("tool_call_id", bodyMap["tool_call_id"])
+	name := c.DefaultPostForm("name", bodyMap["name"])
+
+	// content 为内容片段数组时解析其中的文本及图片
+	text, images, err := bindMessageImages(c)
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+	if text != "" {
+		content = text
+	}
 
-	// content 参数为必传
-	if content == "" {
-		ctl.Fail(c, "参数异常")
+	params := &chatParams{
+		Content:    content,
+		ChatID:     p_chat_id,
+		Remark:     p_remark,
+		Model:      model,
+		Role:       role,
+		ToolCallID: toolCallID,
+		Name:       name,
+		Images:     images,
+	}
+	if params.Tools, params.ToolChoice, err = bindChatTools(c); err != nil {
+		ctl.Fail(c, err.Error())
 		return
-		// content = "你好"
 	}
 
-	// 当 model 不存在时，使用配置的默认 model
-	if model == "" {
-		model = helper.Config.OpenAI.Model
+	chat, err := prepareChat(ctl.Store, app, params)
+	if err != nil {
+		ctl.FailError(c, err)
+		return
+	}
+
+	// 客户端断开时取消上游请求
+	chat.Context = c.Request.Context()
+	chat.MessageChan = make(chan *models.Message)
+	result := make(chan chatResult, 1)
+	go func() {
+		msg, err := chat.QueryChatGPT(true)
+		result <- chatResult{msg, err}
+	}()
+
+	// 仅由当前 goroutine 写入响应，QueryChatGPT 返回前会关闭 MessageChan
+	w := newSSEWriter(c)
+	w.start()
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	messages := chat.MessageChan
+	for {
+		select {
+		case data, ok := <-messages:
+			if !ok {
+				messages = nil
+				continue
+			}
+			w.Message(data)
+		case <-heartbeat.C:
+			w.Heartbeat()
+		case res := <-result:
+			if errors.Is(res.err, context.Canceled) {
+				ctl.Store.Log().Info("chat#" + strconv.Itoa(int(chat.ID)) + " cancelled by client")
+				return
+			}
+			if res.err != nil {
+				w.Error(res.err)
+				w.Done()
+				return
+			}
+			c.Set(helper.UsageTokensKey, res.msg.TotalTokens)
+
+			//最后一次输出不需要输出完整内容
+			res.msg.Content = ""
+			w.Message(res.msg)
+			w.Done()
+			return
+		}
+	}
+}
+
+type chatResult struct {
+	msg *models.Message
+	err error
+}
+
+// 对话请求参数
+type chatParams struct {
+	Content    string
+	ChatID     string
+	Remark     string
+	Model      string
+	Role       string
+	ToolCallID string
+	Name       string
+	Images     []*helper.ImageInput
+	Tools      []*helper.Tool
+	ToolChoice interface{}
+}
+
+// 校验对话参数并保存消息，返回已加载历史消息的 chat，chat_id 为空或 0 时创建新对话
+func prepareChat(store *models.Stores, app *models.Application, params *chatParams) (*models.Chat, error) {
+	// content 参数为必传，tool 消息需指定 tool_call_id
+	if err := checkMessageParams(params.Content != "" || len(params.Images) > 0, params.Role, params.ToolCallID, params.ChatID); err != nil {
+		return nil, err
+	}
+
+	// 当 model 不存在时，使用应用或全局配置的默认 model
+	model, err := store.ResolveModel(app, params.Model)
+	if err != nil {
+		return nil, err
+	}
+
+	// 校验应用图片限制
+	if err = app.CheckImages(params.Images); err != nil {
+		return nil, err
+	}
+
+	// 应用预算用尽时拒绝请求
+	if err := store.CheckBudget(app); err != nil {
+		return nil, err
+	}
+
+	// 用户消息敏感词过滤，工具返回结果不做过滤
+	role, content := params.Role, params.Content
+	if role != "tool" {
+		role = "user"
+		if content, err = store.FilterContent(app, content, "user"); err != nil {
+			return nil, err
+		}
 	}
 
 	chat := &models.Chat{}
 
 	chat.Model = model
 
-	if p_chat_id != "" {
-		if id, err := strconv.Atoi(p_chat_id); err == nil && id != 0 {
+	if params.ChatID != "" {
+		if id, err := strconv.Atoi(params.ChatID); err == nil && id != 0 {
 			// 当 chat_id 合法时，去数据库查找 chat
-			chat.ID = uint(id)
-			if err := models.DB.First(chat).Error; err != nil || chat.AppID != app.ID {
-				ctl.Fail(c, "chat_id 不合法")
-				return
+			exists, err := store.Chats.Get(uint(id))
+			if err != nil || exists.AppID != app.ID {
+				return nil, errors.New("chat_id 不合法")
 			}
-			chat.AppID = app.ID
+			chat = exists
 		}
 	}
 
 	if chat.AppID == 0 {
 		chat.AppID = app.ID
-		if err := models.DB.Create(chat).Error; err != nil {
-			ctl.Fail(c, "chat 处理异常")
-			return
+		if err := store.Chats.Create(chat); err != nil {
+			return nil, errors.New("chat 处理异常")
 		}
 	}
 
 	// 当 remark 参数存在时更新 chat remark
-	if p_remark != "" {
-		chat.Remark = p_remark
-		models.DB.Updates(chat)
+	if params.Remark != "" {
+		chat.Remark = params.Remark
+		store.Chats.Update(chat)
 	}
 
 	message := &models.Message{
-		ChatID:  chat.ID,
-		Role:    "user",
-		Content: content,
-		Raw:     "",
+		ChatID:     chat.ID,
+		Role:       role,
+		Content:    content,
+		Name:       params.Name,
+		ToolCallID: params.ToolCallID,
+		Raw:        "",
 	}
 
-	if err := models.DB.Create(message).Error; err != nil {
-		ctl.Fail(c, "消息处理失败")
-		return
+	// 图片保存到本地，消息中仅记录路径
+	for _, img := range params.Images {
+		ref, err := img.Save(store.Config.GetUploadPath())
+		if err != nil {
+			store.Log().Error("save message image error " + err.Error())
+			return nil, errors.New("图片保存失败")
+		}
+		message.Images = append(message.Images, ref)
+	}
+
+	if err := store.Messages.Create(message); err != nil {
+		return nil, errors.New("消息处理失败")
 	}
 
 	// 刷新 chat Messages
-	models.DB.Preload("Messages").Find(chat)
+	if chat.Messages, err = store.Messages.ListByChat(chat.ID); err != nil {
+		return nil, errors.New("消息处理失败")
+	}
+	chat.Tools, chat.ToolChoice = params.Tools, params.ToolChoice
+	chat.Application = app
+	chat.Store = store
+	return chat, nil
+}
 
-	// 设置流式响应头
-	c.Header("Content-Type", "text/event-stream;charset=utf-8")
-	c.Header("Cache-Control", "no-cache")
-	c.Header("Connection", "keep-alive")
-	c.Header("X-Accel-Buffering", "no") // 禁用nginx缓冲
+// 校验消息参数，role 为 user 或 tool，tool 消息需指定 tool_call_id 及 chat_id
+func checkMessageParams(hasContent bool, role, toolCallID, chatID string) error {
+	switch role {
+	case "", "user":
+		if !hasContent {
+			return errors.New("参数异常")
+		}
+	case "tool":
+		if toolCallID == "" || chatID == "" {
+			return errors.New("tool 消息需指定 tool_call_id 及 chat_id")
+		}
+	default:
+		return errors.New("role 参数异常")
+	}
+	return nil
+}
 
-	go func() {
-		for data := range chat.MessageChan {
-			jsonStr, _ := json.Marshal(gin.H{"status": "ok", "code": 200, "data": data})
-			c.Writer.WriteString("data: " + string(jsonStr) + "\n")
-			c.Writer.Flush()
+// 解析消息图片，来源为 content 内容片段中的 image_url、images 参数（http 地址或 base64 data URL）及上传的 images 文件
+// content 为内容片段数组时 text 为其中的文本内容
+func bindMessageImages(c *gin.Context) (text string, images []*helper.ImageInput, err error) {
+	if bodyMap := c.GetStringMap(helper.PostBodyKey); bodyMap != nil {
+		return bodyMessageImages(bodyMap)
+	}
+
+	if form, err := c.MultipartForm(); err == nil && form != nil {
+		for _, file := range form.File["images"] {
+			f, err := file.Open()
+			if err != nil {
+				return "", nil, err
+			}
+			data, err := io.ReadAll(f)
+			f.Close()
+			if err != nil {
+				return "", nil, err
+			}
+			img, err := helper.NewImageInput(data)
+			if err != nil {
+				return "", nil, err
+			}
+			images = append(images, img)
 		}
-	}()
+	}
 
-	callback, err := chat.QueryChatGPT(true)
-	if err != nil {
-		ctl.Fail(c, err.Error())
-		return
+	for _, url := range c.PostFormArray("images") {
+		img, err := helper.ParseImageURL(url)
+		if err != nil {
+			return "", nil, err
+		}
+		images = append(images, img)
+	}
+	return "", images, nil
+}
+
+// 解析 JSON 请求体中的消息图片
+func bodyMessageImages(bodyMap map[string]interface{}) (text string, images []*helper.ImageInput, err error) {
+	var urls []string
+	if rawParts, ok := bodyMap["content"].([]interface{}); ok {
+		var parts []*helper.ContentPart
+		data, _ := json.Marshal(rawParts)
+		if err = json.Unmarshal(data, &parts); err != nil {
+			return "", nil, errors.New("content 参数异常")
+		}
+		text = helper.PartsText(parts)
+		for _, part := range parts {
+			if part.Type == "image_url" && part.ImageURL != nil {
+				urls = append(urls, part.ImageURL.URL)
+			}
+		}
+	}
+	switch value := bodyMap["images"].(type) {
+	case string:
+		urls = append(urls, value)
+	case []interface{}:
+		for _, item := range value {
+			if url, ok := item.(string); ok {
+				urls = append(urls, url)
+			}
+		}
 	}
 
-	//最后一次输出不需要输出完整内容
-	callback.Content = ""
-	jsonStr, _ := json.Marshal(gin.H{"status": "ok", "code": 200, "data": callback})
-	c.Writer.WriteString("data: " + string(jsonStr) + "\n")
-	c.Writer.WriteString("data: " + "[DONE]" + "\n")
+	for _, url := range urls {
+		img, err := helper.ParseImageURL(url)
+		if err != nil {
+			return "", nil, err
+		}
+		images = append(images, img)
+	}
+	return text, images, nil
+}
+
+// 解析工具参数，tools 及 tool_choice 可为 JSON 字符串或结构化数据
+func bindChatTools(c *gin.Context) (tools []*helper.Tool, toolChoice interface{}, err error) {
+	var rawTools, rawChoice interface{}
+	if bodyMap := c.GetStringMap(helper.PostBodyKey); bodyMap != nil {
+		rawTools, rawChoice = bodyMap["tools"], bodyMap["tool_choice"]
+	} else {
+		if value := c.PostForm("tools"); value != "" {
+			rawTools = value
+		}
+		if value := c.PostForm("tool_choice"); value != "" {
+			rawChoice = value
+		}
+	}
+	return parseChatTools(rawTools, rawChoice)
+}
+
+// 解析工具参数，rawTools 及 rawChoice 为 JSON 字符串或解码后的数据
+func parseChatTools(rawTools, rawChoice interface{}) (tools []*helper.Tool, toolChoice interface{}, err error) {
+	if rawTools != nil {
+		data, ok := rawTools.(string)
+		if !ok {
+			bytes, _ := json.Marshal(rawTools)
+			data = string(bytes)
+		}
+		if err = json.Unmarshal([]byte(data), &tools); err != nil {
+			return nil, nil, errors.New("tools 参数异常")
+		}
+		for _, tool := range tools {
+			if tool == nil || tool.Function.Name == "" {
+				return nil, nil, errors.New("tools 参数异常")
+			}
+			if tool.Type == "" {
+				tool.Type = "function"
+			}
+		}
+	}
+
+	// tool_choice 为 none、auto、required 或 JSON 对象
+	if data, ok := rawChoice.(string); ok {
+		var choice map[string]interface{}
+		if json.Unmarshal([]byte(data), &choice) == nil {
+			toolChoice = choice
+		} else {
+			toolChoice = data
+		}
+	} else if rawChoice != nil {
+		toolChoice = rawChoice
+	}
+	return tools, toolChoice, nil
 }
 
 // 按 openai 原格式
@@ -276,28 +519,67 @@ func (ctl *Open) ChatRaw(c *gin.Context) {
 		delete(bodyMap, "token")
 	}
 
+	// 校验应用允许调用的模型
+	p_model, _ := bodyMap["model"].(string)
+	model, err := ctl.Store.ResolveModel(app, p_model)
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+	bodyMap["model"] = model
+
+	// 应用预算用尽时拒绝请求
+	if err := ctl.Store.CheckBudget(app); err != nil {
+		ctl.FailError(c, err)
+		return
+	}
+
 	reqBody, err = json.Marshal(bodyMap)
 
 	chatReq := &helper.ChatRequest{
-		RawBody: reqBody,
-		Raw:     true, // 指定结果原样返回
+		RawBody:  reqBody,
+		Raw:      true, // 指定结果原样返回
+		Provider: app.Provider,
+		Context:  c.Request.Context(), // 客户端断开时取消上游请求
 	}
 
 	// 设置流式响应头
-	c.Header("Content-Type", "text/event-stream;charset=utf-8")
-	c.Header("Cache-Control", "no-cache")
-	c.Header("Connection", "keep-alive")
-	c.Header("X-Accel-Buffering", "no") // 禁用nginx缓冲
 	c.Header("Access-Control-Allow-Origin", "*")
+	w := newSSEWriter(c)
+	w.start()
 
 	// 以 stream 模式进行请求
-	_, err = helper.ChatGptAsk(*chatReq, func(line *helper.OpenAIResponseStream) {
+	startAt := time.Now()
+	var firstTokenAt time.Time
+	res, err := ctl.Store.Config.ChatGptAsk(*chatReq, func(line *helper.OpenAIResponseStream) {
+		if firstTokenAt.IsZero() {
+			firstTokenAt = time.Now()
+		}
 		c.Writer.WriteString(line.Raw)
 		c.Writer.Flush()
 	})
 
-	if err != nil {
-		ctl.Fail(c, "请求参数异常")
+	// 响应头已发送，以错误事件返回；客户端断开时仍需记录已产生的用量
+	if err != nil && !errors.Is(err, context.Canceled) {
+		w.Error(err)
+		w.Done()
 		return
 	}
+
+	// 优先使用上游返回的用量，未返回时按请求消息及已接收的回复计算
+	if res == nil {
+		res = &helper.OpenAIResponse{}
+	}
+	usage := &models.Message{}
+	if len(res.Choices) > 0 && res.Choices[0].Message != nil {
+		usage.Role = res.Choices[0].Message.Role
+		usage.Content = res.Choices[0].Message.Content
+		usage.ToolCalls = res.Choices[0].Message.ToolCalls
+	}
+	var rawReq helper.ChatRequest
+	json.Unmarshal(reqBody, &rawReq)
+	usage.SetUsage(res, model, helper.CountChatTokens(model, rawReq.Messages), startAt, firstTokenAt)
+	ctl.Store.CalcCost(usage, time.Now(), usage.Model, model)
+	c.Set(helper.UsageTokensKey, usage.TotalTokens)
+	ctl.Store.RecordUsage(app, usage.TotalTokens, usage.Cost, usage.Currency)
 }
@@ -0,0 +1,136 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/controllers/apis/open_test.go
+ */
+package apis_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gpt-zmide-server/helper"
+	"gpt-zmide-server/models"
+	"gpt-zmide-server/routers"
+)
+
+const testConfig = `
+site_name: test
+provider: mock
+admin_user:
+    user: admin
+    password: 21232f297a57a5a743894a0e4a801fc3
+openai:
+    model: gpt-4o-mini
+    base_url: mock://
+`
+
+type response struct {
+	Code int             `json:"code"`
+	Msg  string          `json:"msg"`
+	Data json.RawMessage `json:"data"`
+}
+
+// 使用内存存储的路由，无需数据库
+func newMemoryRouter(t *testing.T) (*gin.Engine, *models.Stores) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	config, err := helper.LoadConfig(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := models.NewMemoryStores()
+	store.Config = config
+	return routers.BuildRouter(gin.New(), store, nil), store
+}
+
+func request(t *testing.T, r *gin.Engine, req *http.Request, data interface{}) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var res response
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("decode response %q: %v", w.Body.String(), err)
+	}
+	if res.Code != 200 {
+		t.Fatalf("%s %s code %d msg %q", req.Method, req.URL.Path, res.Code, res.Msg)
+	}
+	if err := json.Unmarshal(res.Data, data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func postOpen(t *testing.T, r *gin.Engine, app *models.Application, path string, form url.Values, data interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+app.ApiKey)
+	request(t, r, req, data)
+}
+
+func TestOpenOnMemoryStores(t *testing.T) {
+	r, store := newMemoryRouter(t)
+	app, err := models.CreateApplication(store.Apps, "memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 首次请求创建对话，携带 chat_id 继续对话
+	var first, second models.Message
+	postOpen(t, r, app, "/api/open/query", url.Values{"content": {"hello"}}, &first)
+	if first.Role != "assistant" || !strings.Contains(first.Content, "hello") || first.ChatID == 0 {
+		t.Fatalf("first reply %+v", first)
+	}
+	chatID := strconv.Itoa(int(first.ChatID))
+	postOpen(t, r, app, "/api/open/query", url.Values{"content": {"again"}, "chat_id": {chatID}}, &second)
+	if second.ChatID != first.ChatID || !strings.Contains(second.Content, "again") {
+		t.Fatalf("second reply %+v", second)
+	}
+
+	messages, err := store.Messages.ListByChat(first.ChatID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 4 || messages[0].Role != "user" || messages[0].Content != "hello" || messages[3].ID != second.ID {
+		t.Fatalf("chat messages %+v", messages)
+	}
+
+	// 向量请求只记录用量，不创建对话
+	var embedding helper.EmbeddingResponse
+	postOpen(t, r, app, "/api/open/embeddings", url.Values{"input": {"hello"}}, &embedding)
+	if len(embedding.Data) != 1 {
+		t.Fatalf("embedding data %+v", embedding.Data)
+	}
+	if count, _ := store.Chats.Count(); count != 1 {
+		t.Fatalf("chat count %d", count)
+	}
+	byApp, err := store.Usage.ByApp(time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byApp) != 1 || byApp[0].AppID != app.ID || byApp[0].Requests != 3 {
+		t.Fatalf("usage by app %+v", byApp)
+	}
+
+	// 后台对话列表
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/chat/", nil)
+	req.SetBasicAuth("admin", "admin")
+	var page struct {
+		List []struct {
+			ID            uint  `json:"id"`
+			MessagesCount int64 `json:"massages_count"`
+		} `json:"list"`
+	}
+	request(t, r, req, &page)
+	if len(page.List) != 1 || page.List[0].ID != first.ChatID || page.List[0].MessagesCount != 4 {
+		t.Fatalf("admin chat list %+v", page.List)
+	}
+}
@@ -0,0 +1,89 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/controllers/apis/sensitive_word.go
+ */
+package apis
+
+import (
+	"gpt-zmide-server/models"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SensitiveWord struct {
+	Controller
+	Store *models.Stores
+}
+
+// 敏感词列表，app_id 为 0 时查询全局敏感词
+func (ctl *SensitiveWord) Index(c *gin.Context) {
+	var appIDs []uint
+	if p_app_id := c.Query("app_id"); p_app_id != "" {
+		appID, err := strconv.ParseUint(p_app_id, 10, 32)
+		if err != nil {
+			ctl.Fail(c, err.Error())
+			return
+		}
+		appIDs = append(appIDs, uint(appID))
+	}
+	words, err := ctl.Store.SensitiveWords.List(appIDs...)
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+	ctl.Success(c, words)
+}
+
+// 添加敏感词，多个敏感词以换行或英文逗号分隔
+func (ctl *SensitiveWord) Create(c *gin.Context) {
+	p_words := c.PostForm("words")
+	if p_words == "" {
+		ctl.Fail(c, "参数异常")
+		return
+	}
+
+	var appID uint64
+	if p_app_id := c.PostForm("app_id"); p_app_id != "" {
+		var err error
+		if appID, err = strconv.ParseUint(p_app_id, 10, 32); err != nil {
+			ctl.Fail(c, err.Error())
+			return
+		}
+		if appID != 0 {
+			if _, err = ctl.Store.Apps.Get(uint(appID)); err != nil {
+				ctl.Fail(c, "应用不存在")
+				return
+			}
+		}
+	}
+
+	words := strings.FieldsFunc(p_words, func(r rune) bool {
+		return r == '\n' || r == '\r' || r == ','
+	})
+
+	list, err := models.CreateSensitiveWords(ctl.Store, uint(appID), words)
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+	ctl.Success(c, list)
+}
+
+func (ctl *SensitiveWord) Delete(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+
+	if err = ctl.Store.SensitiveWords.Delete(uint(id)); err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+	ctl.Store.ReloadSensitiveWords()
+
+	ctl.Success(c, "ok")
+}
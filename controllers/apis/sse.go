@@ -0,0 +1,95 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/controllers/apis/sse.go
+ */
+package apis
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SSE 事件类型
+const (
+	SSEEventMessage = "message"
+	SSEEventError   = "error"
+	SSEEventDone    = "done"
+)
+
+// 无消息时发送心跳注释的间隔，避免代理断开空闲连接
+const sseHeartbeatInterval = 15 * time.Second
+
+// SSE 响应写入器，非并发安全，需由处理请求的 goroutine 单独写入
+type sseWriter struct {
+	c       *gin.Context
+	id      int
+	started bool
+}
+
+func newSSEWriter(c *gin.Context) *sseWriter {
+	return &sseWriter{c: c}
+}
+
+// 写入响应头，首次写入事件前调用
+func (w *sseWriter) start() {
+	if w.started {
+		return
+	}
+	w.started = true
+	w.c.Header("Content-Type", "text/event-stream;charset=utf-8")
+	w.c.Header("Cache-Control", "no-cache")
+	w.c.Header("Connection", "keep-alive")
+	w.c.Header("X-Accel-Buffering", "no") // 禁用nginx缓冲
+	w.c.Status(http.StatusOK)
+}
+
+// 写入事件，data 为字符串时原样写入，否则按 JSON 编码
+func (w *sseWriter) Event(event string, data interface{}) error {
+	w.start()
+	payload, ok := data.(string)
+	if !ok {
+		bytes, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		payload = string(bytes)
+	}
+
+	w.id++
+	frame := "id: " + strconv.Itoa(w.id) + "\nevent: " + event + "\ndata: " + payload + "\n\n"
+	if _, err := w.c.Writer.WriteString(frame); err != nil {
+		return err
+	}
+	w.c.Writer.Flush()
+	return nil
+}
+
+// 写入统一格式的消息事件
+func (w *sseWriter) Message(data interface{}) error {
+	return w.Event(SSEEventMessage, gin.H{"status": "ok", "code": 200, "data": data})
+}
+
+// 写入错误事件，格式与接口失败响应一致
+func (w *sseWriter) Error(err error) error {
+	return w.Event(SSEEventError, gin.H{"status": "fail", "code": errorCode(err), "data": nil, "msg": err.Error()})
+}
+
+// 写入结束事件，data 与 OpenAI 一致为 [DONE]
+func (w *sseWriter) Done() error {
+	return w.Event(SSEEventDone, "[DONE]")
+}
+
+// 写入心跳注释，客户端会忽略
+func (w *sseWriter) Heartbeat() error {
+	w.start()
+	if _, err := w.c.Writer.WriteString(": ping\n\n"); err != nil {
+		return err
+	}
+	w.c.Writer.Flush()
+	return nil
+}
@@ -0,0 +1,134 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/controllers/apis/tool.go
+ */
+package apis
+
+import (
+	"gpt-zmide-server/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Tool struct {
+	Controller
+	Store *models.Stores
+}
+
+// 解析工具表单，字段为空时保持原值
+func bindTool(c *gin.Context, tool *models.Tool) error {
+	if name, ok := c.GetPostForm("name"); ok {
+		tool.Name = name
+	}
+	if description, ok := c.GetPostForm("description"); ok {
+		tool.Description = description
+	}
+	if parameters, ok := c.GetPostForm("parameters"); ok {
+		tool.Parameters = parameters
+	}
+	if url, ok := c.GetPostForm("url"); ok {
+		tool.URL = url
+	}
+	if allowed, ok := c.GetPostForm("allowed_apps"); ok {
+		tool.AllowedApps = allowed
+	}
+	if p_timeout, ok := c.GetPostForm("timeout"); ok {
+		timeout, err := strconv.Atoi(p_timeout)
+		if p_timeout == "" {
+			timeout, err = 0, nil
+		}
+		if err != nil {
+			return err
+		}
+		tool.Timeout = timeout
+	}
+	if p_status, ok := c.GetPostForm("status"); ok {
+		status, err := strconv.Atoi(p_status)
+		if err != nil {
+			return err
+		}
+		tool.Status = uint(status)
+	}
+	return tool.Validate()
+}
+
+// 服务端工具列表
+func (ctl *Tool) Index(c *gin.Context) {
+	list, err := ctl.Store.Tools.List()
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+	ctl.Success(c, list)
+}
+
+// 添加服务端工具，默认启用
+func (ctl *Tool) Create(c *gin.Context) {
+	tool := &models.Tool{Status: 1}
+	if err := bindTool(c, tool); err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+
+	if err := ctl.Store.Tools.Create(tool); err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+
+	ctl.Success(c, tool)
+}
+
+// 修改服务端工具
+func (ctl *Tool) Update(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+
+	tool, err := ctl.Store.Tools.Get(uint(id))
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+
+	if err = bindTool(c, tool); err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+
+	// 允许清空描述、参数及应用限制，按字段更新
+	err = ctl.Store.Tools.Update(tool, map[string]interface{}{
+		"name":         tool.Name,
+		"description":  tool.Description,
+		"parameters":   tool.Parameters,
+		"url":          tool.URL,
+		"timeout":      tool.Timeout,
+		"allowed_apps": tool.AllowedApps,
+		"status":       tool.Status,
+	})
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+
+	ctl.Success(c, tool)
+}
+
+// 删除服务端工具
+func (ctl *Tool) Delete(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+
+	if err = ctl.Store.Tools.Delete(uint(id)); err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+
+	ctl.Success(c, "ok")
+}
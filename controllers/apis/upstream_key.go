@@ -0,0 +1,151 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/controllers/apis/upstream_key.go
+ */
+package apis
+
+import (
+	"gpt-zmide-server/helper"
+	"gpt-zmide-server/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UpstreamKey struct {
+	Controller
+	Store *models.Stores
+}
+
+type upstreamKeyItem struct {
+	models.UpstreamKey
+	SecretKey string `json:"secret_key"`
+	Cooling   bool   `json:"cooling"`
+}
+
+func newUpstreamKeyItem(key *models.UpstreamKey) upstreamKeyItem {
+	return upstreamKeyItem{
+		UpstreamKey: *key,
+		SecretKey:   key.MaskSecretKey(),
+		Cooling:     key.IsCooling(time.Now()),
+	}
+}
+
+// 查看上游密钥池
+func (ctl *UpstreamKey) Index(c *gin.Context) {
+	keys, err := ctl.Store.UpstreamKeys.List(c.Query("provider"))
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+
+	list := []upstreamKeyItem{}
+	for _, key := range keys {
+		list = append(list, newUpstreamKeyItem(key))
+	}
+	ctl.Success(c, list)
+}
+
+// 添加上游密钥
+func (ctl *UpstreamKey) Create(c *gin.Context) {
+	provider := c.DefaultPostForm("provider", helper.DefaultProviderName)
+	name := c.PostForm("name")
+	secretKey := c.PostForm("secret_key")
+	weight, _ := strconv.Atoi(c.DefaultPostForm("weight", "1"))
+	if secretKey == "" {
+		ctl.Fail(c, "参数异常")
+		return
+	}
+
+	if !helper.HasProvider(provider) {
+		ctl.Fail(c, "上游服务提供方不存在")
+		return
+	}
+
+	key, err := models.CreateUpstreamKey(ctl.Store, provider, name, secretKey, weight)
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+	ctl.Success(c, newUpstreamKeyItem(key))
+}
+
+// 修改上游密钥名称、权重及状态
+func (ctl *UpstreamKey) Update(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+
+	name, p_weight, p_status := c.PostForm("name"),
+		c.PostForm("weight"),
+		c.PostForm("status")
+	if name == "" && p_weight == "" && p_status == "" {
+		ctl.Fail(c, "参数异常")
+		return
+	}
+
+	key, err := ctl.Store.UpstreamKeys.Get(uint(id))
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+
+	if name != "" {
+		key.Name = name
+	}
+
+	if p_weight != "" {
+		weight, err := strconv.Atoi(p_weight)
+		if err == nil && weight > 0 {
+			key.Weight = weight
+		}
+	}
+
+	if p_status != "" {
+		status, err := strconv.Atoi(p_status)
+		if err == nil {
+			key.Status = uint(status)
+		}
+	}
+
+	if err = ctl.Store.UpstreamKeys.Update(key, nil); err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+	ctl.Store.ReloadUpstreamKeys()
+
+	ctl.Success(c, newUpstreamKeyItem(key))
+}
+
+// 清除上游密钥错误计数及冷却
+func (ctl *UpstreamKey) Reset(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+
+	key, err := ctl.Store.UpstreamKeys.Get(uint(id))
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+
+	err = ctl.Store.UpstreamKeys.Update(key, map[string]interface{}{
+		"error_count":        0,
+		"consecutive_errors": 0,
+		"last_error":         "",
+		"cooldown_until":     nil,
+	})
+	if err != nil {
+		ctl.Fail(c, err.Error())
+		return
+	}
+	ctl.Store.ReloadUpstreamKeys()
+
+	ctl.Success(c, newUpstreamKeyItem(key))
+}
@@ -0,0 +1,270 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/controllers/apis/ws.go
+ */
+package apis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"gpt-zmide-server/helper"
+	"gpt-zmide-server/models"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+// WebSocket 帧类型
+const (
+	WSFrameMessage = "message" // 客户端发送消息，服务端推送增量内容
+	WSFrameStop    = "stop"    // 客户端取消当前回复
+	WSFramePing    = "ping"
+	WSFramePong    = "pong"
+	WSFrameDone    = "done"  // 回复完成，data 为完整消息（不含内容）
+	WSFrameError   = "error" // 处理失败，连接保持
+)
+
+// 服务端推送帧
+type wsFrame struct {
+	Type string      `json:"type"`
+	Code int         `json:"code,omitempty"`
+	Data interface{} `json:"data,omitempty"`
+	Msg  string      `json:"msg,omitempty"`
+}
+
+// WebSocket 对话连接，同一时间仅处理一条消息
+type wsSession struct {
+	conn   *websocket.Conn
+	store  *models.Stores
+	app    *models.Application
+	ctx    context.Context
+	chatID uint // 当前对话，消息未指定 chat_id 时使用
+
+	sendMu sync.Mutex
+
+	mu     sync.Mutex
+	cancel context.CancelFunc // 当前回复的取消函数，为 nil 时空闲
+	wg     sync.WaitGroup
+}
+
+// WebSocket 对话，连接建立后可连续发送多轮消息
+func (ctl *Open) WebSocket(c *gin.Context) {
+	app, ok := c.MustGet(helper.MiddlewareAuthAppKey).(*models.Application)
+	if !ok || app == nil || app.Status != 1 {
+		ctl.Fail(c, "应用异常")
+		return
+	}
+
+	server := websocket.Server{
+		Handshake: checkOrigin(ctl.Store.Config.DomainName),
+		Handler: func(conn *websocket.Conn) {
+			ctx, cancel := context.WithCancel(c.Request.Context())
+			defer cancel()
+
+			session := &wsSession{conn: conn, store: ctl.Store, app: app, ctx: ctx}
+			session.serve()
+
+			// 连接断开后取消未完成的回复并等待保存
+			cancel()
+			session.wg.Wait()
+		},
+	}
+	// 每条消息单独计入应用限流，连接关闭时不再扣减用量
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// 浏览器跨站发起连接时会携带缓存的凭据及 Cookie，仅允许站点域名发起；
+// 非浏览器客户端不发送 Origin，按 token 认证
+func checkOrigin(domainName string) func(*websocket.Config, *http.Request) error {
+	return func(_ *websocket.Config, req *http.Request) error {
+		origin := req.Header.Get("Origin")
+		if origin == "" {
+			return nil
+		}
+		originURL, err := url.Parse(origin)
+		if err != nil {
+			return err
+		}
+		siteURL, err := url.Parse(domainName)
+		if err != nil || domainName == "" ||
+			!strings.EqualFold(originURL.Scheme, siteURL.Scheme) || !strings.EqualFold(originURL.Host, siteURL.Host) {
+			return errors.New("websocket origin not allowed " + origin)
+		}
+		return nil
+	}
+}
+
+// 读取客户端帧直至连接断开
+func (s *wsSession) serve() {
+	for {
+		var data []byte
+		if err := websocket.Message.Receive(s.conn, &data); err != nil {
+			return
+		}
+
+		var frame map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&frame); err != nil {
+			s.error(errors.New("消息格式错误"))
+			continue
+		}
+
+		frameType, _ := frame["type"].(string)
+		switch frameType {
+		case WSFrameMessage:
+			s.message(frame)
+		case WSFrameStop:
+			s.mu.Lock()
+			if s.cancel != nil {
+				s.cancel()
+			}
+			s.mu.Unlock()
+		case WSFramePing:
+			s.send(&wsFrame{Type: WSFramePong})
+		default:
+			s.error(errors.New("type 参数异常"))
+		}
+	}
+}
+
+// 处理消息帧，校验通过后在后台请求回复
+func (s *wsSession) message(frame map[string]interface{}) {
+	s.mu.Lock()
+	busy := s.cancel != nil
+	s.mu.Unlock()
+	if busy {
+		s.error(errors.New("上一条消息尚未回复完成"))
+		return
+	}
+
+	// 每条消息按应用限流检查请求数及 token 余量
+	if _, err := s.store.TakeRequest(s.app); err != nil {
+		s.error(err)
+		return
+	}
+	if _, err := s.store.CheckTokens(s.app); err != nil {
+		s.error(err)
+		return
+	}
+
+	params := &chatParams{}
+	params.Remark, _ = frame["remark"].(string)
+	params.Model, _ = frame["model"].(string)
+	params.Role, _ = frame["role"].(string)
+	params.ToolCallID, _ = frame["tool_call_id"].(string)
+	params.Name, _ = frame["name"].(string)
+	params.Content, _ = frame["content"].(string)
+
+	// 未指定 chat_id 时继续当前对话，chat_id 为 0 时创建新对话
+	switch value := frame["chat_id"].(type) {
+	case json.Number:
+		params.ChatID = value.String()
+	case string:
+		params.ChatID = value
+	case nil:
+		if s.chatID != 0 {
+			params.ChatID = strconv.Itoa(int(s.chatID))
+		}
+	}
+
+	text, images, err := bodyMessageImages(frame)
+	if err != nil {
+		s.error(err)
+		return
+	}
+	if text != "" {
+		params.Content = text
+	}
+	params.Images = images
+
+	if params.Tools, params.ToolChoice, err = parseChatTools(frame["tools"], frame["tool_choice"]); err != nil {
+		s.error(err)
+		return
+	}
+
+	chat, err := prepareChat(s.store, s.app, params)
+	if err != nil {
+		s.error(err)
+		return
+	}
+	s.chatID = chat.ID
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.mu.Lock()
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer cancel()
+		s.generate(ctx, chat, func() {
+			s.mu.Lock()
+			s.cancel = nil
+			s.mu.Unlock()
+		})
+	}()
+}
+
+// 请求回复并推送增量内容，取消时保存已生成的内容。
+// release 在推送最终帧之前调用，客户端收到 done / error 后即可发送下一条消息
+func (s *wsSession) generate(ctx context.Context, chat *models.Chat, release func()) {
+	chat.Context = ctx
+	chat.MessageChan = make(chan *models.Message)
+	result := make(chan chatResult, 1)
+	go func() {
+		msg, err := chat.QueryChatGPT(true)
+		result <- chatResult{msg, err}
+	}()
+
+	// QueryChatGPT 返回前会关闭 MessageChan
+	for data := range chat.MessageChan {
+		s.send(&wsFrame{Type: WSFrameMessage, Code: http.StatusOK, Data: data})
+	}
+
+	res := <-result
+	if res.msg != nil {
+		s.store.ChargeTokens(s.app, res.msg.TotalTokens)
+	}
+	release()
+
+	if errors.Is(res.err, context.Canceled) {
+		s.store.Log().Info("chat#" + strconv.Itoa(int(chat.ID)) + " cancelled by client")
+		if res.msg != nil && s.ctx.Err() == nil {
+			// 客户端主动停止，返回已保存的部分回复
+			res.msg.Content = ""
+			s.send(&wsFrame{Type: WSFrameDone, Code: http.StatusOK, Data: res.msg})
+		}
+		return
+	}
+	if res.err != nil {
+		s.error(res.err)
+		return
+	}
+
+	//最后一次输出不需要输出完整内容
+	res.msg.Content = ""
+	s.send(&wsFrame{Type: WSFrameDone, Code: http.StatusOK, Data: res.msg})
+}
+
+func (s *wsSession) send(frame *wsFrame) {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	if err := websocket.JSON.Send(s.conn, frame); err != nil {
+		s.store.Log().Debug("websocket send error " + err.Error())
+	}
+}
+
+// 推送错误帧，格式与接口失败响应一致
+func (s *wsSession) error(err error) {
+	s.send(&wsFrame{Type: WSFrameError, Code: errorCode(err), Msg: err.Error()})
+}
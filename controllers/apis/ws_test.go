@@ -0,0 +1,139 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/controllers/apis/ws_test.go
+ */
+package apis_test
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"gpt-zmide-server/models"
+)
+
+type wsFrame struct {
+	Type string          `json:"type"`
+	Code int             `json:"code"`
+	Msg  string          `json:"msg"`
+	Data *models.Message `json:"data"`
+}
+
+func dialWebSocket(serverURL, origin, apiKey string) (*websocket.Conn, error) {
+	config, err := websocket.NewConfig("ws"+strings.TrimPrefix(serverURL, "http")+"/api/open/ws", origin)
+	if err != nil {
+		return nil, err
+	}
+	config.Header.Set("Authorization", "Bearer "+apiKey)
+	return websocket.DialConfig(config)
+}
+
+// 收到 done 后立即发送下一条消息，不应提示上一条消息尚未回复完成
+func TestWebSocketBackToBackTurns(t *testing.T) {
+	r, store := newMemoryRouter(t)
+	app, err := models.CreateApplication(store.Apps, "ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(r)
+	defer server.Close()
+	store.Config.DomainName = server.URL
+
+	conn, err := dialWebSocket(server.URL, server.URL, app.ApiKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	var chatID uint
+	for i := 0; i < 50; i++ {
+		content := "turn " + strconv.Itoa(i)
+		if err := websocket.JSON.Send(conn, map[string]string{"type": "message", "content": content}); err != nil {
+			t.Fatal(err)
+		}
+
+		var reply strings.Builder
+		for {
+			var frame wsFrame
+			if err := websocket.JSON.Receive(conn, &frame); err != nil {
+				t.Fatal(err)
+			}
+			if frame.Type == "error" {
+				t.Fatalf("turn %d error frame %d %q", i, frame.Code, frame.Msg)
+			}
+			if frame.Type == "message" && frame.Data != nil {
+				reply.WriteString(frame.Data.Content)
+			}
+			if frame.Type == "done" {
+				if chatID == 0 {
+					chatID = frame.Data.ChatID
+				}
+				if frame.Data.ChatID != chatID {
+					t.Fatalf("turn %d chat %d, want %d", i, frame.Data.ChatID, chatID)
+				}
+				break
+			}
+		}
+		if !strings.Contains(reply.String(), content) {
+			t.Fatalf("turn %d reply %q", i, reply.String())
+		}
+	}
+
+	messages, err := store.Messages.ListByChat(chatID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 100 {
+		t.Fatalf("chat messages %d", len(messages))
+	}
+}
+
+// 仅允许站点域名或不携带 Origin 的客户端建立连接
+func TestWebSocketOrigin(t *testing.T) {
+	r, store := newMemoryRouter(t)
+	app, err := models.CreateApplication(store.Apps, "ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(r)
+	defer server.Close()
+	store.Config.DomainName = server.URL + "/"
+
+	if conn, err := dialWebSocket(server.URL, "https://evil.example.com", app.ApiKey); err == nil {
+		conn.Close()
+		t.Fatal("cross-site origin accepted")
+	}
+	conn, err := dialWebSocket(server.URL, server.URL, app.ApiKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	// 非浏览器客户端不发送 Origin
+	tcp, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcp.Close()
+	fmt.Fprintf(tcp, "GET /api/open/ws HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\nAuthorization: Bearer %s\r\n\r\n",
+		strings.TrimPrefix(server.URL, "http://"), app.ApiKey)
+	tcp.SetReadDeadline(time.Now().Add(5 * time.Second))
+	res, err := http.ReadResponse(bufio.NewReader(tcp), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake without origin status %d", res.StatusCode)
+	}
+}
@@ -16,14 +16,16 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
 
 type Install struct {
 	apis.Controller
+	Store     *models.Stores
+	Connected func(db *gorm.DB) // 连接数据库后的回调，由服务接管连接
 }
 
 func (ctl *Install) Index(c *gin.Context) {
@@ -32,7 +34,7 @@ func (ctl *Install) Index(c *gin.Context) {
 
 // 提交配置
 func (ctl *Install) Config(c *gin.Context) {
-	if !helper.IsInitialize() {
+	if !ctl.Store.Config.IsInitialize() {
 		ctl.Fail(c, "出错啦")
 		return
 	}
@@ -98,13 +100,13 @@ func (ctl *Install) siteConfig(data string) error {
 		return errors.New("管理员密码为空或小于 6 位")
 	}
 
-	helper.Config.SiteName = config.SiteName
-	helper.Config.DomainName = config.DomainName
-	helper.Config.Port = port
-	helper.Config.AdminUser.User = config.AdminUser
-	helper.Config.AdminUser.Password = fmt.Sprintf("%x", md5.Sum([]byte(config.AdminPassword)))
+	ctl.Store.Config.SiteName = config.SiteName
+	ctl.Store.Config.DomainName = config.DomainName
+	ctl.Store.Config.Port = port
+	ctl.Store.Config.AdminUser.User = config.AdminUser
+	ctl.Store.Config.AdminUser.Password = fmt.Sprintf("%x", md5.Sum([]byte(config.AdminPassword)))
 
-	if err := helper.Config.SaveConfig(); err != nil {
+	if err := ctl.Store.Config.SaveConfig(); err != nil {
 		return err
 	}
 
@@ -129,17 +131,17 @@ func (ctl *Install) openaiConfig(data string) error {
 		return errors.New("OpenAI SecretKey 填写错误")
 	}
 
-	status, callback := helper.PingOpenAI(config.SecretKey, config.ProxyHost, config.ProxyPort)
+	status, callback := ctl.Store.Config.PingOpenAI(config.SecretKey, config.ProxyHost, config.ProxyPort)
 	if !status {
 		return errors.New("OpenAI 服务器连接失败，" + callback)
 	}
 
-	helper.Config.OpenAI.SecretKey = config.SecretKey
-	helper.Config.OpenAI.HttpProxyHost = config.ProxyHost
-	helper.Config.OpenAI.HttpProxyPort = config.ProxyPort
-	helper.Config.OpenAI.Model = config.Model
+	ctl.Store.Config.OpenAI.SecretKey = config.SecretKey
+	ctl.Store.Config.OpenAI.HttpProxyHost = config.ProxyHost
+	ctl.Store.Config.OpenAI.HttpProxyPort = config.ProxyPort
+	ctl.Store.Config.OpenAI.Model = config.Model
 
-	if err := helper.Config.SaveConfig(); err != nil {
+	if err := ctl.Store.Config.SaveConfig(); err != nil {
 		return err
 	}
 
@@ -149,11 +151,19 @@ func (ctl *Install) openaiConfig(data string) error {
 // 配置数据库
 func (ctl *Install) databaseConfig(data string) error {
 	type DatabaseConfig struct {
-		MysqlHost     string `json:"mysql_host"`
-		MysqlPort     string `json:"mysql_port"`
-		MysqlUser     string `json:"mysql_user"`
-		MysqlPassword string `json:"mysql_password"`
-		MysqlDatabase string `json:"mysql_database"`
+		DBDriver         string `json:"db_driver"`
+		SqlitePath       string `json:"sqlite_path"`
+		PostgresHost     string `json:"postgres_host"`
+		PostgresPort     string `json:"postgres_port"`
+		PostgresUser     string `json:"postgres_user"`
+		PostgresPassword string `json:"postgres_password"`
+		PostgresDatabase string `json:"postgres_database"`
+		PostgresSSLMode  string `json:"postgres_ssl_mode"`
+		MysqlHost        string `json:"mysql_host"`
+		MysqlPort        string `json:"mysql_port"`
+		MysqlUser        string `json:"mysql_user"`
+		MysqlPassword    string `json:"mysql_password"`
+		MysqlDatabase    string `json:"mysql_database"`
 	}
 
 	var config DatabaseConfig
@@ -161,6 +171,16 @@ func (ctl *Install) databaseConfig(data string) error {
 		return errors.New("参数填写错误")
 	}
 
+	switch config.DBDriver {
+	case "", helper.DBDriverMysql:
+	case helper.DBDriverSqlite:
+		return ctl.sqliteConfig(config.SqlitePath)
+	case helper.DBDriverPostgres:
+		return ctl.postgresConfig(config.PostgresHost, config.PostgresPort, config.PostgresUser, config.PostgresPassword, config.PostgresDatabase, config.PostgresSSLMode)
+	default:
+		return errors.New("不支持的数据库类型")
+	}
+
 	port, err := strconv.Atoi(config.MysqlPort)
 	if err != nil || port == 0 {
 		return errors.New("数据库端口错误")
@@ -183,35 +203,124 @@ func (ctl *Install) databaseConfig(data string) error {
 		return errors.New("数据库名称错误")
 	}
 
-	u_p := config.MysqlUser
-	if config.MysqlPassword != "" {
-		u_p = u_p + ":" + config.MysqlPassword
+	mysqlConfig := *ctl.Store.Config
+	mysqlConfig.DBDriver = helper.DBDriverMysql
+	mysqlConfig.Mysql.Host = config.MysqlHost
+	mysqlConfig.Mysql.Port = port
+	mysqlConfig.Mysql.User = config.MysqlUser
+	mysqlConfig.Mysql.Password = config.MysqlPassword
+	mysqlConfig.Mysql.Database = config.MysqlDatabase
+
+	// 检查数据库是否连接成功
+	if err := ctl.pingDatabase(&mysqlConfig); err != nil {
+		return err
+	}
+	return ctl.saveDatabaseConfig(&mysqlConfig)
+}
+
+// 配置 SQLite 数据库，路径为空时保存在配置文件所在目录
+func (ctl *Install) sqliteConfig(path string) error {
+	config := *ctl.Store.Config
+	config.DBDriver = helper.DBDriverSqlite
+	config.Sqlite.Path = strings.TrimSpace(path)
+
+	// 检查数据库文件是否可以创建
+	if err := ctl.pingDatabase(&config); err != nil {
+		return err
+	}
+
+	return ctl.saveDatabaseConfig(&config)
+}
+
+// 配置 PostgreSQL 数据库
+func (ctl *Install) postgresConfig(host, portStr, user, password, database, sslMode string) error {
+	port := 5432
+	if portStr != "" {
+		var err error
+		if port, err = strconv.Atoi(portStr); err != nil || port == 0 {
+			return errors.New("数据库端口错误")
+		}
+	}
+
+	if host == "" {
+		return errors.New("数据库地址错误")
+	}
+
+	if user == "" {
+		return errors.New("数据库用户名错误")
+	}
+
+	if database == "" {
+		return errors.New("数据库名称错误")
 	}
 
+	config := *ctl.Store.Config
+	config.DBDriver = helper.DBDriverPostgres
+	config.Postgres.DSN = ""
+	config.Postgres.Host = host
+	config.Postgres.Port = port
+	config.Postgres.User = user
+	config.Postgres.Password = password
+	config.Postgres.Database = database
+	config.Postgres.SSLMode = sslMode
+
 	// 检查数据库是否连接成功
-	dsn := u_p + "@tcp(" + dbURL.Host + ")/" + config.MysqlDatabase + "?charset=utf8&parseTime=True&loc=Local"
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	if err := ctl.pingDatabase(&config); err != nil {
+		return err
+	}
+
+	return ctl.saveDatabaseConfig(&config)
+}
+
+// 按配置连接数据库并检查是否可用
+func (ctl *Install) pingDatabase(config *helper.DefaultConfig) error {
+	dialector, err := models.Dialector(config)
+	if err != nil {
+		return err
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{})
+	if err == nil {
+		err = db.Exec("SELECT 1").Error
+	}
 	if err != nil {
 		return errors.New("数据库连接失败" + err.Error())
 	}
-	if db == nil {
+	closeDatabase(db)
+	return nil
+}
+
+// 执行迁移，成功后保存数据库配置并切换到新连接
+func (ctl *Install) saveDatabaseConfig(config *helper.DefaultConfig) error {
+	db, err := models.Open(config)
+	if err != nil {
+		ctl.Store.Log().Error(err.Error())
 		return errors.New("数据库连接失败")
 	}
 
-	helper.Config.Mysql.Host = config.MysqlHost
-	helper.Config.Mysql.Port = port
-	helper.Config.Mysql.User = config.MysqlUser
-	helper.Config.Mysql.Password = config.MysqlPassword
-	helper.Config.Mysql.Database = config.MysqlDatabase
+	// 迁移失败时不保存配置，避免使用未完成迁移的数据库提供服务
+	if _, err := models.MigrateUp(db); err != nil {
+		ctl.Store.Log().Error(err.Error())
+		closeDatabase(db)
+		return errors.New("数据迁移失败")
+	}
 
-	if err := helper.Config.SaveConfig(); err != nil {
+	ctl.Store.Config.DBDriver = config.DBDriver
+	ctl.Store.Config.Sqlite = config.Sqlite
+	ctl.Store.Config.Mysql = config.Mysql
+	ctl.Store.Config.Postgres = config.Postgres
+	if err := ctl.Store.Config.SaveConfig(); err != nil {
+		closeDatabase(db)
 		return err
 	}
 
-	// 初始化数据库
-	if err := models.InitDB(); err != nil {
-		return errors.New("数据迁移失败")
+	if ctl.Connected != nil {
+		ctl.Connected(db)
 	}
-
 	return nil
 }
+
+func closeDatabase(db *gorm.DB) {
+	if sqlDB, _ := db.DB(); sqlDB != nil {
+		sqlDB.Close()
+	}
+}
@@ -6,30 +6,145 @@
 package helper
 
 import (
-	"bufio"
+	"context"
 	"encoding/json"
-	"io"
-	"strings"
+	"errors"
+	"gpt-zmide-server/helper/tokenizer"
+	"net/http"
 )
 
 // 构造请求体
 type ChatRequest struct {
-	Model            string         `json:"model"`
-	Messages         []*ChatMessage `json:"messages"`
-	User             string         `json:"user"`
-	Stream           bool           `json:"stream"`
-	Temperature      float64        `json:"temperature,omitempty"`
-	MaxTokens        int            `json:"max_tokens,omitempty"`
-	FrequencyPenalty float64        `json:"frequency_penalty,omitempty"`
-	PresencePenalty  float64        `json:"presence_penalty,omitempty"`
-	TopP             float64        `json:"top_p,omitempty"`
-	Raw              bool           `json:"-"`
-	RawBody          []byte         `json:"-"`
+	Model            string          `json:"model"`
+	Messages         []*ChatMessage  `json:"messages"`
+	User             string          `json:"user"`
+	Stream           bool            `json:"stream"`
+	Temperature      float64         `json:"temperature,omitempty"`
+	MaxTokens        int             `json:"max_tokens,omitempty"`
+	FrequencyPenalty float64         `json:"frequency_penalty,omitempty"`
+	PresencePenalty  float64         `json:"presence_penalty,omitempty"`
+	TopP             float64         `json:"top_p,omitempty"`
+	StreamOptions    *StreamOptions  `json:"stream_options,omitempty"`
+	Tools            []*Tool         `json:"tools,omitempty"`
+	ToolChoice       interface{}     `json:"tool_choice,omitempty"` // none、auto、required 或指定函数
+	Provider         string          `json:"-"`
+	Raw              bool            `json:"-"`
+	RawBody          []byte          `json:"-"`
+	Context          context.Context `json:"-"` // 请求上下文，取消时中断上游请求
+}
+
+// 客户端断开导致请求取消时的结束原因
+const FinishReasonCancelled = "cancelled"
+
+func (req *ChatRequest) context() context.Context {
+	if req.Context == nil {
+		return context.Background()
+	}
+	return req.Context
+}
+
+// 流式请求选项
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 type ChatMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role       string      `json:"role"`
+	Content    string      `json:"content"`
+	Name       string      `json:"name,omitempty"`
+	ToolCalls  []*ToolCall `json:"tool_calls,omitempty"`   // assistant 消息发起的工具调用
+	ToolCallID string      `json:"tool_call_id,omitempty"` // tool 消息对应的工具调用 ID
+	// 多模态内容，不为空时 content 按数组格式请求，Content 为其中的文本内容
+	Parts []*ContentPart `json:"-"`
+}
+
+// 消息内容片段，Type 为 text 或 image_url
+type ContentPart struct {
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+// 图片地址，支持 http 地址及 base64 data URL
+type ImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"` // auto、low 或 high
+}
+
+type chatMessageJSON ChatMessage
+
+func (msg *ChatMessage) MarshalJSON() ([]byte, error) {
+	if len(msg.Parts) < 1 {
+		return json.Marshal((*chatMessageJSON)(msg))
+	}
+	return json.Marshal(&struct {
+		*chatMessageJSON
+		Content []*ContentPart `json:"content"`
+	}{(*chatMessageJSON)(msg), msg.Parts})
+}
+
+// content 兼容字符串及内容片段数组
+func (msg *ChatMessage) UnmarshalJSON(data []byte) error {
+	var body struct {
+		*chatMessageJSON
+		Content json.RawMessage `json:"content"`
+	}
+	body.chatMessageJSON = (*chatMessageJSON)(msg)
+	if err := json.Unmarshal(data, &body); err != nil {
+		return err
+	}
+
+	msg.Content, msg.Parts = "", nil
+	if len(body.Content) < 1 || string(body.Content) == "null" {
+		return nil
+	}
+	if body.Content[0] != '[' {
+		return json.Unmarshal(body.Content, &msg.Content)
+	}
+	if err := json.Unmarshal(body.Content, &msg.Parts); err != nil {
+		return err
+	}
+	msg.Content = PartsText(msg.Parts)
+	return nil
+}
+
+// 内容片段中的文本内容
+func PartsText(parts []*ContentPart) string {
+	text := ""
+	for _, part := range parts {
+		if part.Type == "text" {
+			if text != "" {
+				text += "\n"
+			}
+			text += part.Text
+		}
+	}
+	return text
+}
+
+// 工具定义，目前仅支持函数
+type Tool struct {
+	Type     string       `json:"type"`
+	Function ToolFunction `json:"function"`
+}
+
+type ToolFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"` // JSON Schema
+}
+
+// 工具调用，流式分片中 Index 标识所属的调用，Arguments 需按 Index 拼接
+type ToolCall struct {
+	Index    *int             `json:"index,omitempty"`
+	ID       string           `json:"id,omitempty"`
+	Type     string           `json:"type,omitempty"`
+	Function ToolCallFunction `json:"function"`
+}
+
+type ToolCallFunction struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"` // JSON 字符串
 }
 
 type ChatChoices struct {
@@ -41,140 +156,171 @@ type ChatChoices struct {
 
 // openAi 返回结构体
 type OpenAIResponse struct {
-	ID      string `json:"id"`
-	Model   string `json:"model"`
-	Object  string `json:"object"`
-	Created int64  `json:"created"`
-	Usage   struct {
-		PromptTokens     int64 `json:"prompt_tokens"`
-		CompletionTokens int64 `json:"completion_tokens"`
-		TotalTokens      int64 `json:"total_tokens"`
-	} `json:"usage"`
+	ID      string         `json:"id"`
+	Model   string         `json:"model"`
+	Object  string         `json:"object"`
+	Created int64          `json:"created"`
+	Usage   ChatUsage      `json:"usage"`
 	Choices []*ChatChoices `json:"choices"`
 	Raw     string         `json:"-"`
+	// 上游请求 ID，取自响应头
+	RequestID string `json:"-"`
+}
+
+// token 用量
+type ChatUsage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
 }
 
 // openAi 返回结构体(Stream)
 type OpenAIResponseStream struct {
-	ID      string `json:"id"`
-	Model   string `json:"model"`
-	Object  string `json:"object"`
-	Created int64  `json:"created"`
-	Choices []struct {
-		Delta struct {
-			Role    string `json:"role"`
-			Content string `json:"content"`
-		} `json:"delta"`
-		Index        int    `json:"index"`
-		FinishReason string `json:"finish_reason"`
-	} `json:"choices"`
-	Raw string `json:"-"`
-}
-
-// 调用 chatGPT
-func ChatGptAsk(req ChatRequest, streamCall ...func(line *OpenAIResponseStream)) (res *OpenAIResponse, err error) {
-	client, err := Config.GetOpenAIHttpClient()
-	if err != nil {
-		return
-	}
+	ID      string              `json:"id"`
+	Model   string              `json:"model"`
+	Object  string              `json:"object"`
+	Created int64               `json:"created"`
+	Choices []*ChatStreamChoice `json:"choices"`
+	Usage   *ChatUsage          `json:"usage"`
+	Raw     string              `json:"-"`
+}
 
-	c := client.R()
+type ChatStreamDelta struct {
+	Role      string      `json:"role,omitempty"`
+	Content   string      `json:"content"`
+	ToolCalls []*ToolCall `json:"tool_calls,omitempty"`
+}
 
-	// 流式返回时指定参数
-	if len(streamCall) > 0 {
-		req.Stream = true
-		c = c.SetDoNotParseResponse(true)
+type ChatStreamChoice struct {
+	Delta        ChatStreamDelta `json:"delta"`
+	Index        int             `json:"index"`
+	FinishReason string          `json:"finish_reason"`
+}
+
+// 按 Index 合并流式工具调用分片
+func mergeToolCallDeltas(calls []*ToolCall, deltas []*ToolCall) []*ToolCall {
+	for i, delta := range deltas {
+		index := i
+		if delta.Index != nil {
+			index = *delta.Index
+		}
+		for len(calls) <= index {
+			calls = append(calls, &ToolCall{Type: "function"})
+		}
+		call := calls[index]
+		if delta.ID != "" {
+			call.ID = delta.ID
+		}
+		if delta.Type != "" {
+			call.Type = delta.Type
+		}
+		call.Function.Name += delta.Function.Name
+		call.Function.Arguments += delta.Function.Arguments
 	}
+	return calls
+}
 
-	var bodyStr []byte
+// 解析上游返回的错误信息，不是错误响应时返回 nil
+func parseUpstreamError(body []byte) error {
+	var data struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(body, &data) != nil || len(data.Error) < 1 || string(data.Error) == "null" {
+		return nil
+	}
 
-	if req.RawBody == nil {
-		bodyStr, err = json.Marshal(req)
-		if err != nil {
-			return
+	// error 为对象或字符串
+	var detail struct {
+		Message string `json:"message"`
+	}
+	var message string
+	if json.Unmarshal(data.Error, &detail) == nil && detail.Message != "" {
+		message = detail.Message
+	} else if json.Unmarshal(data.Error, &message) != nil || message == "" {
+		message = "upstream response error"
+	}
+	return errors.New(message)
+}
+
+// 从响应头获取上游请求 ID
+func upstreamRequestID(header http.Header) string {
+	for _, key := range []string{"X-Request-Id", "Apim-Request-Id"} {
+		if id := header.Get(key); id != "" {
+			return id
 		}
-	} else {
-		bodyStr = req.RawBody
 	}
+	return ""
+}
 
-	// 发送请求
-	resp, err := c.SetBody(bodyStr).Post("/v1/chat/completions")
+// 计算文本 token 数
+func CountTokens(model string, text string) int64 {
+	return int64(tokenizer.Count(model, text))
+}
 
-	if len(streamCall) == 0 {
-		if err = json.Unmarshal(resp.Body(), &res); err != nil {
-			return
-		}
+// 图片 token 数估算，low 精度固定为 85，其余按 high 精度常见尺寸估算
+const (
+	imageTokensLow  = 85
+	imageTokensHigh = 765
+)
 
-		res.Raw = string(resp.Body())
-	} else {
-		// 逐行读取响应结果
-		reader := bufio.NewReader(resp.RawBody())
-		defer resp.RawBody().Close()
-
-		res = &OpenAIResponse{}
-		message := &ChatMessage{
-			Role:    "",
-			Content: "",
+// 计算单条消息 token 数，工具调用按函数名及参数计算，图片按精度估算
+func CountMessageTokens(model string, msg *ChatMessage) int64 {
+	content := msg.Content
+	for _, call := range msg.ToolCalls {
+		content += call.Function.Name + call.Function.Arguments
+	}
+	count := int64(tokenizer.CountMessage(model, tokenizer.Message{Role: msg.Role, Name: msg.Name, Content: content}))
+	for _, part := range msg.Parts {
+		if part.Type != "image_url" || part.ImageURL == nil {
+			continue
 		}
-		var choices = []*ChatChoices{}
-
-		for {
-			line, err := reader.ReadBytes('\n')
-			if err != nil {
-				if err == io.EOF {
-					err = nil
-					break
-				}
-				break
-			}
+		if part.ImageURL.Detail == "low" {
+			count += imageTokensLow
+		} else {
+			count += imageTokensHigh
+		}
+	}
+	return count
+}
 
-			var resStream *OpenAIResponseStream
-
-			// 是否指定原样返回
-			if !req.Raw {
-				// 去掉 data: 前缀
-				jsonData := strings.TrimSpace(strings.TrimPrefix(string(line), "data:"))
-
-				if jsonData == "[DONE]" {
-					break
-				}
-
-				err = json.Unmarshal([]byte(jsonData), &resStream)
-
-				if resStream != nil {
-					if resStream.Choices[0].Delta.Role != "" {
-						message.Role = resStream.Choices[0].Delta.Role
-					}
-
-					if resStream.Choices[0].Delta.Content != "" {
-						message.Content += resStream.Choices[0].Delta.Content
-					}
-
-					res.Raw += jsonData
-					res.ID += resStream.ID
-					res.Model += resStream.Model
-					res.Object += resStream.Object
-					res.Created += resStream.Created
-				}
-			} else {
-				resStream = &OpenAIResponseStream{}
-				resStream.Raw = string(line)
-			}
+// 计算工具定义 token 数（估算）
+func CountToolsTokens(model string, tools []*Tool) int64 {
+	if len(tools) < 1 {
+		return 0
+	}
+	data, _ := json.Marshal(tools)
+	return CountTokens(model, string(data))
+}
 
-			if resStream != nil {
-				streamCall[0](resStream)
-			}
-		}
+// 计算请求消息列表 token 数
+func CountChatTokens(model string, msgs []*ChatMessage) int64 {
+	count := int64(tokenizer.ReplyPrimingTokens)
+	for _, msg := range msgs {
+		count += CountMessageTokens(model, msg)
+	}
+	return count
+}
 
-		if res.ID != "" {
-			choices = append(choices, &ChatChoices{
-				Message:      message,
-				Index:        0,
-				FinishReason: "stop",
-			})
-			res.Choices = choices
-		}
+// 调用 chatGPT，请求经由 req.Provider 指定的上游服务提供方
+func (c *DefaultConfig) ChatGptAsk(req ChatRequest, streamCall ...func(line *OpenAIResponseStream)) (res *OpenAIResponse, err error) {
+	provider, err := c.GetProvider(req.Provider)
+	if err != nil {
+		return
+	}
+
+	// 流式返回
+	if len(streamCall) > 0 {
+		res, err = provider.ChatStream(req, streamCall[0])
+	} else {
+		res, err = provider.Chat(req)
 	}
 
+	// 请求被取消时返回已接收的部分内容
+	if ctxErr := req.context().Err(); ctxErr != nil {
+		if res != nil && len(res.Choices) > 0 {
+			res.Choices[0].FinishReason = FinishReasonCancelled
+		}
+		err = ctxErr
+	}
 	return
 }
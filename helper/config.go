@@ -7,32 +7,36 @@ package helper
 
 import (
 	"crypto/md5"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"gpt-zmide-server/helper/logger"
+	"gpt-zmide-server/helper/tokenizer"
+	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-resty/resty/v2"
 	"gopkg.in/yaml.v3"
 )
 
-var Config *DefaultConfig
-
 type DefaultConfig struct {
 	AppKey     string `yaml:"app_key"`
 	SiteName   string `yaml:"site_name"`
 	DomainName string `yaml:"domain_name"`
 	Host       string `yaml:"host"`
 	Port       int    `yaml:"port"`
+	Provider   string `yaml:"provider"`
 	AdminUser  struct {
 		User     string `yaml:"user"`
 		Password string `yaml:"password"`
 	} `yaml:"admin_user"`
+	DBDriver string `yaml:"db_driver"` // 数据库类型 mysql / sqlite / postgres，为空使用 mysql
+	Sqlite   struct {
+		Path string `yaml:"path"` // 数据库文件路径，为空使用配置文件所在目录下 gpt_zmide_server.db
+	} `yaml:"sqlite"`
 	Mysql struct {
 		Host     string `yaml:"host"`
 		Port     int    `yaml:"port"`
@@ -40,36 +44,67 @@ type DefaultConfig struct {
 		Password string `yaml:"password"`
 		Database string `yaml:"database"`
 	}
+	Postgres struct {
+		DSN      string `yaml:"dsn"` // 完整连接串，设置后忽略以下连接参数
+		Host     string `yaml:"host"`
+		Port     int    `yaml:"port"` // 为 0 时使用 5432
+		User     string `yaml:"user"`
+		Password string `yaml:"password"`
+		Database string `yaml:"database"`
+		SSLMode  string `yaml:"ssl_mode"` // disable / allow / prefer / require / verify-ca / verify-full，为空使用 disable
+	} `yaml:"postgres"`
 	OpenAI struct {
 		SecretKey     string `yaml:"secret_key"`
 		Model         string `yaml:"model"`
 		HttpProxyHost string `yaml:"http_proxy_host"`
 		HttpProxyPort string `yaml:"http_proxy_port"`
 		BaseUrl       string `yaml:"base_url"`
+		// 不在流式请求中携带 stream_options.include_usage，用于不支持该参数的兼容服务，用量由本地计算，同时作用于 Azure
+		DisableStreamUsage bool `yaml:"disable_stream_usage"`
 	}
-}
-
-func init() {
-	var err error
-	Config, err = ReadConfig()
-	if err != nil {
-		// 读取配置失败
-		logger.Warn("读取配置文件失败。" + err.Error())
-		// fmt.Println("读取配置文件失败。" + err.Error())
+	Azure struct {
+		Endpoint      string            `yaml:"endpoint"`
+		ApiKey        string            `yaml:"api_key"`
+		ApiVersion    string            `yaml:"api_version"`
+		HttpProxyHost string            `yaml:"http_proxy_host"`
+		HttpProxyPort string            `yaml:"http_proxy_port"`
+		Deployments   map[string]string `yaml:"deployments"` // 模型名 => Azure 部署名
+	}
+	Ollama struct {
+		BaseUrl string `yaml:"base_url"`
+	}
+	Mock struct {
+		Latency int    `yaml:"latency"` // 响应延迟毫秒，流式为每个分片间隔
+		Script  string `yaml:"script"`  // 对话脚本文件路径（YAML），见 mockupstream.Script
+	} `yaml:"mock"`
+	Filter struct {
+		Action string `yaml:"action"` // 敏感词处理方式 reject / mask / log
 	}
+	ContextWindows map[string]int `yaml:"context_windows"` // 模型名 => 上下文窗口，覆盖内置模型表
+	UploadPath     string         `yaml:"upload_path"`     // 消息图片保存目录，为空使用程序目录下 uploads
+
+	// 运行时依赖，不写入配置文件
+	path       string       // 配置文件路径，为空时按运行模式确定
+	httpClient *http.Client // 请求上游使用的基础客户端，为空时使用默认客户端
+	keyPool    KeyPool      // 上游密钥池，为空时使用配置文件中的密钥
 }
 
 // 是否未完成初始化
-func IsInitialize() bool {
-	return Config == nil ||
-		Config.AdminUser.User == "" ||
-		Config.AdminUser.Password == "" ||
-		Config.Mysql.Host == "" ||
-		Config.Mysql.User == ""
+func (c *DefaultConfig) IsInitialize() bool {
+	if c == nil || c.AdminUser.User == "" || c.AdminUser.Password == "" {
+		return true
+	}
+	switch c.GetDBDriver() {
+	case DBDriverSqlite:
+		return false
+	case DBDriverPostgres:
+		return c.Postgres.DSN == "" && (c.Postgres.Host == "" || c.Postgres.User == "")
+	}
+	return c.Mysql.Host == "" || c.Mysql.User == ""
 }
 
-// 获取配置目录
-func getConfigPath() string {
+// 获取默认配置文件路径
+func defaultConfigPath() string {
 	if IsRelease() {
 		appPath, err := os.Executable()
 		if err == nil {
@@ -89,6 +124,7 @@ func InitConfig() *DefaultConfig {
 	c.DomainName = "https://demo.zmide.com"
 	c.Host = "0.0.0.0"
 	c.Port = 8091
+	c.Provider = DefaultProviderName
 	c.AdminUser.User = "admin"
 	pwd := fmt.Sprintf("%x", md5.Sum([]byte("admin")))
 	c.AdminUser.Password = pwd
@@ -97,23 +133,34 @@ func InitConfig() *DefaultConfig {
 	c.Mysql.Database = "gpt_zmide_server"
 	c.OpenAI.Model = "gpt-3.5-turbo"
 	c.OpenAI.BaseUrl = "https://api.openai.com"
+	c.Filter.Action = "reject"
 	return &c
 }
 
-func ReadConfig() (*DefaultConfig, error) {
-	_, err := os.Stat(getConfigPath())
+// 读取配置文件，文件不存在时创建默认配置，path 为空时按运行模式确定
+func ReadConfig(path string) (*DefaultConfig, error) {
+	if path == "" {
+		path = defaultConfigPath()
+	}
+	_, err := os.Stat(path)
 	if err == nil {
 		// 文件存在，读取配置文件
-		content, err := os.ReadFile(getConfigPath())
+		content, err := os.ReadFile(path)
 
 		if err != nil {
 			// 配置文件读取失败
 			return nil, err
 		}
-		return LoadConfig(string(content))
+		conf, err := LoadConfig(string(content))
+		if err != nil {
+			return nil, err
+		}
+		conf.path = path
+		return conf, nil
 	}
 
 	conf := InitConfig()
+	conf.path = path
 
 	if err = conf.SaveConfig(); err != nil {
 		// 保存配置文件失败
@@ -132,10 +179,38 @@ func LoadConfig(configStr string) (*DefaultConfig, error) {
 	return config, nil
 }
 
+// 配置文件路径
+func (c *DefaultConfig) Path() string {
+	if c.path != "" {
+		return c.path
+	}
+	return defaultConfigPath()
+}
+
+// 设置配置文件路径，安装向导及后台保存配置时写入该文件
+func (c *DefaultConfig) SetPath(path string) {
+	c.path = path
+}
+
+// 请求上游使用的基础客户端
+func (c *DefaultConfig) HttpClient() *http.Client {
+	return c.httpClient
+}
+
+// 设置请求上游使用的基础客户端，为空时使用默认客户端
+func (c *DefaultConfig) SetHttpClient(client *http.Client) {
+	c.httpClient = client
+}
+
+// 设置上游密钥池，为空时使用配置文件中的密钥
+func (c *DefaultConfig) SetKeyPool(pool KeyPool) {
+	c.keyPool = pool
+}
+
 // 保存配置文件
 func (c *DefaultConfig) SaveConfig() error {
 	if content, err := yaml.Marshal(c); err == nil {
-		err = os.WriteFile(getConfigPath(), content, 0766)
+		err = os.WriteFile(c.Path(), content, 0766)
 		if err != nil {
 			// 写入配置失败
 			return err
@@ -147,6 +222,88 @@ func (c *DefaultConfig) SaveConfig() error {
 	return nil
 }
 
+// 支持的数据库类型
+const (
+	DBDriverMysql    = "mysql"
+	DBDriverSqlite   = "sqlite"
+	DBDriverPostgres = "postgres"
+)
+
+// PostgreSQL 支持的 SSL 模式
+var postgresSSLModes = map[string]bool{
+	"disable":     true,
+	"allow":       true,
+	"prefer":      true,
+	"require":     true,
+	"verify-ca":   true,
+	"verify-full": true,
+}
+
+// 获取数据库类型
+func (c *DefaultConfig) GetDBDriver() string {
+	if c.DBDriver == "" {
+		return DBDriverMysql
+	}
+	return c.DBDriver
+}
+
+// 获取 SQLite 数据库文件路径
+func (c *DefaultConfig) GetSqlitePath() string {
+	if c.Sqlite.Path != "" {
+		return c.Sqlite.Path
+	}
+	return filepath.Join(filepath.Dir(c.Path()), "gpt_zmide_server.db")
+}
+
+// 获取 PostgreSQL 连接串
+func (c *DefaultConfig) GetPostgresDSN() (string, error) {
+	if c.Postgres.DSN != "" {
+		return c.Postgres.DSN, nil
+	}
+	if c.Postgres.Host == "" || c.Postgres.User == "" || c.Postgres.Database == "" {
+		return "", errors.New("database misconfiguration error")
+	}
+
+	port := c.Postgres.Port
+	if port == 0 {
+		port = 5432
+	}
+	sslMode := c.Postgres.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+	if !postgresSSLModes[sslMode] {
+		return "", errors.New("unsupported postgres ssl mode " + sslMode)
+	}
+
+	params := [][2]string{
+		{"host", c.Postgres.Host},
+		{"port", strconv.Itoa(port)},
+		{"user", c.Postgres.User},
+		{"password", c.Postgres.Password},
+		{"dbname", c.Postgres.Database},
+		{"sslmode", sslMode},
+	}
+	items := make([]string, 0, len(params))
+	for _, param := range params {
+		if param[1] == "" {
+			continue
+		}
+		items = append(items, param[0]+"="+quotePostgresValue(param[1]))
+	}
+	return strings.Join(items, " "), nil
+}
+
+// 连接参数包含空格、引号或为空时需使用单引号包裹并转义
+func quotePostgresValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, " '\\\t\n") {
+		return value
+	}
+	value = strings.ReplaceAll(value, "\\", "\\\\")
+	value = strings.ReplaceAll(value, "'", "\\'")
+	return "'" + value + "'"
+}
+
 // 获取数据库地址
 func (c *DefaultConfig) GetMysqlUrl() (*url.URL, error) {
 	if c.Mysql.Host == "" || c.Mysql.Port == 0 {
@@ -164,21 +321,104 @@ func (c *DefaultConfig) GetOpenAIBaseUrl() string {
 	return baseURL
 }
 
+// 创建上游请求客户端，每次返回独立的传输层以便分别设置代理
+func (c *DefaultConfig) newHttpClient() *resty.Client {
+	if c.httpClient == nil {
+		return resty.New()
+	}
+	httpClient := *c.httpClient
+	if transport, ok := httpClient.Transport.(*http.Transport); ok {
+		httpClient.Transport = transport.Clone()
+	}
+	return resty.NewWithClient(&httpClient)
+}
+
 func (c *DefaultConfig) GetOpenAIHttpClient() (*resty.Client, error) {
-	if c.OpenAI.SecretKey == "" {
+	poolKey, secretKey, err := c.pickPoolKey(DefaultProviderName, c.OpenAI.SecretKey)
+	if err != nil {
+		return nil, err
+	}
+	if secretKey == "" {
 		return nil, errors.New("not set OpenAI SecretKey")
 	}
-	client := resty.New()
+	client := c.newHttpClient()
 	if c.OpenAI.HttpProxyHost != "" && c.OpenAI.HttpProxyPort != "" {
 		client.SetProxy("http://" + c.OpenAI.HttpProxyHost + ":" + c.OpenAI.HttpProxyPort)
 	}
 	client.SetBaseURL(c.GetOpenAIBaseUrl())
+	if strings.HasPrefix(c.GetOpenAIBaseUrl(), MockBaseUrl) {
+		// 使用内置模拟上游，不经过网络
+		if err := c.useMockUpstream(client); err != nil {
+			return nil, err
+		}
+	}
+	client.SetTimeout(20 * time.Minute)
+	client.Header.Add("Content-Type", "application/json")
+	client.Header.Add("Authorization", "Bearer "+secretKey)
+	c.reportPoolKey(client, poolKey)
+	return client, nil
+}
+
+func (c *DefaultConfig) GetAzureHttpClient() (*resty.Client, error) {
+	poolKey, apiKey, err := c.pickPoolKey(AzureProviderName, c.Azure.ApiKey)
+	if err != nil {
+		return nil, err
+	}
+	if c.Azure.Endpoint == "" || apiKey == "" {
+		return nil, errors.New("not set Azure OpenAI Endpoint or ApiKey")
+	}
+	client := c.newHttpClient()
+	if c.Azure.HttpProxyHost != "" && c.Azure.HttpProxyPort != "" {
+		client.SetProxy("http://" + c.Azure.HttpProxyHost + ":" + c.Azure.HttpProxyPort)
+	}
+	client.SetBaseURL(strings.TrimRight(c.Azure.Endpoint, "/"))
+	client.SetTimeout(20 * time.Minute)
+	client.SetQueryParam("api-version", c.GetAzureApiVersion())
+	client.Header.Add("Content-Type", "application/json")
+	client.Header.Add("api-key", apiKey)
+	c.reportPoolKey(client, poolKey)
+	return client, nil
+}
+
+// 获取 Azure OpenAI API 版本
+func (c *DefaultConfig) GetAzureApiVersion() string {
+	if c.Azure.ApiVersion != "" {
+		return c.Azure.ApiVersion
+	}
+	return "2024-02-01"
+}
+
+// 获取模型对应的 Azure 部署名，未配置映射时直接使用模型名
+func (c *DefaultConfig) GetAzureDeployment(model string) string {
+	if deployment, ok := c.Azure.Deployments[model]; ok && deployment != "" {
+		return deployment
+	}
+	return model
+}
+
+func (c *DefaultConfig) GetOllamaHttpClient() (*resty.Client, error) {
+	if c.Ollama.BaseUrl == "" {
+		return nil, errors.New("not set Ollama BaseUrl")
+	}
+	client := c.newHttpClient()
+	client.SetBaseURL(strings.TrimRight(c.Ollama.BaseUrl, "/"))
 	client.SetTimeout(20 * time.Minute)
 	client.Header.Add("Content-Type", "application/json")
-	client.Header.Add("Authorization", "Bearer "+c.OpenAI.SecretKey)
 	return client, nil
 }
 
+// 获取模型信息，配置文件中的上下文窗口优先
+func (c *DefaultConfig) GetModelInfo(model string) tokenizer.ModelInfo {
+	info := tokenizer.GetModelInfo(model)
+	if window, ok := c.ContextWindows[model]; ok && window > 0 {
+		info.ContextWindow = window
+		if info.MaxOutput > window {
+			info.MaxOutput = window
+		}
+	}
+	return info
+}
+
 func GetMysqlUrl(host string, port int) (*url.URL, error) {
 	if host == "" || port == 0 {
 		return nil, errors.New("database misconfiguration error")
@@ -190,45 +430,31 @@ func GetMysqlUrl(host string, port int) (*url.URL, error) {
 	return u, nil
 }
 
-func PingOpenAI(secret_key string, proxy_host string, proxy_port string) (status bool, callback string) {
+// 检查 OpenAI 密钥是否可用，上游地址及模拟上游配置沿用当前配置
+func (c *DefaultConfig) PingOpenAI(secret_key string, proxy_host string, proxy_port string) (status bool, callback string) {
 	if secret_key != "" {
-		tmpConfig := &DefaultConfig{}
+		tmpConfig := &DefaultConfig{httpClient: c.httpClient}
 		tmpConfig.OpenAI.SecretKey = secret_key
 		tmpConfig.OpenAI.HttpProxyHost = proxy_host
 		tmpConfig.OpenAI.HttpProxyPort = proxy_port
+		tmpConfig.OpenAI.BaseUrl = c.OpenAI.BaseUrl
+		tmpConfig.Mock = c.Mock
 
-		client, err := tmpConfig.GetOpenAIHttpClient()
-		if err != nil {
-			return false, err.Error()
-		}
-		resp, err := client.R().
-			Get("/v1/models")
-		if err == nil && resp.StatusCode() > 190 && resp.StatusCode() < 300 {
-			type Model struct {
-				Id         string        `json:"id"`
-				Object     string        `json:"object"`
-				OwnedBy    string        `json:"owned_by"`
-				Permission []interface{} `json:"permission"`
-			}
-			var data struct {
-				Data []Model `json:"data"`
-			}
-			callback = string(resp.Body())
-			if err := json.Unmarshal(resp.Body(), &data); err == nil {
-				status = true
-				callback = "200"
-			}
-		} else {
-			callback = resp.Status()
-			if err != nil {
-				callback = err.Error()
-			}
-		}
+		status, callback = PingProvider(tmpConfig, DefaultProviderName)
 	}
 
 	return
 }
 
+// 检查指定上游服务提供方是否可用
+func PingProvider(c *DefaultConfig, name string) (status bool, callback string) {
+	provider, err := c.GetProvider(name)
+	if err != nil {
+		return false, err.Error()
+	}
+	return provider.Ping()
+}
+
 func getPidPath() string {
 	if IsRelease() {
 		appPath, err := os.Executable()
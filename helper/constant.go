@@ -7,3 +7,5 @@ package helper
 
 const MiddlewareAuthAppKey = "application"
 const PostBodyKey = "post_body_json"
+const UsageTokensKey = "usage_tokens"
+const OpenAIFormatKey = "openai_format"
@@ -0,0 +1,112 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/helper/embedding.go
+ */
+package helper
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// 未指定模型时使用的向量模型
+const DefaultEmbeddingModel = "text-embedding-3-small"
+
+// 向量请求体，Input 为字符串、字符串数组或 token 数组
+type EmbeddingRequest struct {
+	Model          string      `json:"model"`
+	Input          interface{} `json:"input"`
+	EncodingFormat string      `json:"encoding_format,omitempty"`
+	Dimensions     int         `json:"dimensions,omitempty"`
+	User           string      `json:"user,omitempty"`
+	Provider       string      `json:"-"`
+}
+
+type Embedding struct {
+	Object    string          `json:"object"`
+	Embedding json.RawMessage `json:"embedding"` // 浮点数组，encoding_format 为 base64 时为字符串
+	Index     int             `json:"index"`
+}
+
+type EmbeddingUsage struct {
+	PromptTokens int64 `json:"prompt_tokens"`
+	TotalTokens  int64 `json:"total_tokens"`
+}
+
+// 向量返回结构体
+type EmbeddingResponse struct {
+	Object    string         `json:"object"`
+	Data      []*Embedding   `json:"data"`
+	Model     string         `json:"model"`
+	Usage     EmbeddingUsage `json:"usage"`
+	Raw       string         `json:"-"`
+	RequestID string         `json:"-"`
+}
+
+// 支持向量接口的上游服务提供方
+type EmbeddingProvider interface {
+	Embeddings(req EmbeddingRequest) (*EmbeddingResponse, error)
+}
+
+// 解析向量输入，返回文本列表；输入为 token 数组时 tokens 为 token 总数
+func EmbeddingInputs(input interface{}) (texts []string, tokens int64, err error) {
+	switch value := input.(type) {
+	case string:
+		return []string{value}, 0, nil
+	case []string:
+		return value, 0, nil
+	case []interface{}:
+		for _, item := range value {
+			switch v := item.(type) {
+			case string:
+				texts = append(texts, v)
+			case float64:
+				tokens++
+			case []interface{}:
+				tokens += int64(len(v))
+			default:
+				return nil, 0, errors.New("input 格式错误")
+			}
+		}
+		if len(texts) > 0 && tokens > 0 {
+			return nil, 0, errors.New("input 格式错误")
+		}
+		return texts, tokens, nil
+	}
+	return nil, 0, errors.New("input 格式错误")
+}
+
+// 调用向量接口，请求经由 req.Provider 指定的上游服务提供方
+func (c *DefaultConfig) Embed(req EmbeddingRequest) (*EmbeddingResponse, error) {
+	provider, err := c.GetProvider(req.Provider)
+	if err != nil {
+		return nil, err
+	}
+	embedder, ok := provider.(EmbeddingProvider)
+	if !ok {
+		return nil, errors.New("provider " + provider.Name() + " not support embeddings")
+	}
+	return embedder.Embeddings(req)
+}
+
+// 解析 OpenAI 协议的向量响应
+func parseEmbeddingResponse(body []byte) (*EmbeddingResponse, error) {
+	var res EmbeddingResponse
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, err
+	}
+	if len(res.Data) < 1 {
+		var data struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(body, &data) == nil && data.Error.Message != "" {
+			return nil, errors.New(data.Error.Message)
+		}
+		return nil, errors.New("embeddings response data error")
+	}
+	res.Raw = string(body)
+	return &res, nil
+}
@@ -0,0 +1,224 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/helper/filter/filter.go
+ */
+package filter
+
+import (
+	"strings"
+	"unicode"
+)
+
+// 命中处理方式
+const (
+	ActionReject = "reject" // 拒绝请求
+	ActionMask   = "mask"   // 替换为 *
+	ActionLog    = "log"    // 仅记录日志
+)
+
+// 处理方式是否合法
+func IsAction(action string) bool {
+	return action == ActionReject || action == ActionMask || action == ActionLog
+}
+
+const maskRune = '*'
+
+// 命中结果，Start、End 为字符（rune）下标，左闭右开
+type Match struct {
+	Word  string
+	Start int
+	End   int
+}
+
+type node struct {
+	next map[rune]int
+	fail int
+	out  []int // 以该节点结尾的敏感词下标
+}
+
+// Aho-Corasick 多模式匹配，忽略大小写
+type Matcher struct {
+	nodes  []*node
+	words  []string
+	maxLen int
+}
+
+func NewMatcher(words []string) *Matcher {
+	m := &Matcher{nodes: []*node{{next: map[rune]int{}}}}
+
+	seen := map[string]bool{}
+	for _, word := range words {
+		word = strings.TrimSpace(word)
+		key := strings.ToLower(word)
+		if word == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		m.insert(word)
+	}
+	m.build()
+	return m
+}
+
+func (m *Matcher) insert(word string) {
+	cur := 0
+	runes := []rune(word)
+	for _, r := range runes {
+		r = unicode.ToLower(r)
+		next, ok := m.nodes[cur].next[r]
+		if !ok {
+			m.nodes = append(m.nodes, &node{next: map[rune]int{}})
+			next = len(m.nodes) - 1
+			m.nodes[cur].next[r] = next
+		}
+		cur = next
+	}
+	m.nodes[cur].out = append(m.nodes[cur].out, len(m.words))
+	m.words = append(m.words, word)
+	if len(runes) > m.maxLen {
+		m.maxLen = len(runes)
+	}
+}
+
+// 构建失败指针
+func (m *Matcher) build() {
+	queue := []int{}
+	for _, child := range m.nodes[0].next {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for r, child := range m.nodes[cur].next {
+			fail := m.nodes[cur].fail
+			for fail > 0 {
+				if _, ok := m.nodes[fail].next[r]; ok {
+					break
+				}
+				fail = m.nodes[fail].fail
+			}
+			if next, ok := m.nodes[fail].next[r]; ok && next != child {
+				m.nodes[child].fail = next
+			}
+			m.nodes[child].out = append(m.nodes[child].out, m.nodes[m.nodes[child].fail].out...)
+			queue = append(queue, child)
+		}
+	}
+}
+
+func (m *Matcher) step(state int, r rune) int {
+	r = unicode.ToLower(r)
+	for {
+		if next, ok := m.nodes[state].next[r]; ok {
+			return next
+		}
+		if state == 0 {
+			return 0
+		}
+		state = m.nodes[state].fail
+	}
+}
+
+// 是否没有敏感词
+func (m *Matcher) Empty() bool {
+	return m == nil || len(m.words) == 0
+}
+
+// 查找全部命中
+func (m *Matcher) FindAll(text string) []Match {
+	if m.Empty() {
+		return nil
+	}
+	var matches []Match
+	state := 0
+	pos := 0
+	for _, r := range text {
+		state = m.step(state, r)
+		pos++
+		for _, idx := range m.nodes[state].out {
+			length := len([]rune(m.words[idx]))
+			matches = append(matches, Match{Word: m.words[idx], Start: pos - length, End: pos})
+		}
+	}
+	return matches
+}
+
+// 将命中的敏感词替换为 *
+func (m *Matcher) Mask(text string) (string, []Match) {
+	matches := m.FindAll(text)
+	if len(matches) < 1 {
+		return text, nil
+	}
+	runes := []rune(text)
+	for _, match := range matches {
+		for i := match.Start; i < match.End; i++ {
+			runes[i] = maskRune
+		}
+	}
+	return string(runes), matches
+}
+
+// 流式匹配，敏感词被拆分到多个分片时同样能够命中
+type Stream struct {
+	m       *Matcher
+	mask    bool
+	state   int
+	pos     int    // 已读取的字符数
+	offset  int    // pending 第一个字符的下标
+	pending []rune // 尚未输出的字符
+	Matches []Match
+}
+
+// 创建流式匹配，mask 为 true 时输出内容中的敏感词替换为 *
+func (m *Matcher) NewStream(mask bool) *Stream {
+	return &Stream{m: m, mask: mask}
+}
+
+// 流式匹配使用的匹配器
+func (s *Stream) Matcher() *Matcher {
+	return s.m
+}
+
+// 写入分片，返回可以安全输出的内容及本次命中
+func (s *Stream) Write(chunk string) (string, []Match) {
+	if s.m.Empty() {
+		return chunk, nil
+	}
+
+	var matches []Match
+	for _, r := range chunk {
+		s.pending = append(s.pending, r)
+		s.state = s.m.step(s.state, r)
+		s.pos++
+		for _, idx := range s.m.nodes[s.state].out {
+			length := len([]rune(s.m.words[idx]))
+			match := Match{Word: s.m.words[idx], Start: s.pos - length, End: s.pos}
+			matches = append(matches, match)
+			if s.mask {
+				for i := match.Start; i < match.End; i++ {
+					s.pending[i-s.offset] = maskRune
+				}
+			}
+		}
+	}
+	s.Matches = append(s.Matches, matches...)
+
+	// 保留可能构成敏感词前缀的尾部字符
+	keep := s.m.maxLen - 1
+	if len(s.pending) <= keep {
+		return "", matches
+	}
+	out := string(s.pending[:len(s.pending)-keep])
+	s.offset += len(s.pending) - keep
+	s.pending = append([]rune{}, s.pending[len(s.pending)-keep:]...)
+	return out, matches
+}
+
+// 输出剩余内容
+func (s *Stream) Flush() string {
+	out := string(s.pending)
+	s.offset += len(s.pending)
+	s.pending = nil
+	return out
+}
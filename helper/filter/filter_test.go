@@ -0,0 +1,116 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/helper/filter/filter_test.go
+ */
+package filter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindAll(t *testing.T) {
+	cases := []struct {
+		name  string
+		words []string
+		text  string
+		want  []Match
+	}{
+		{"no words", nil, "hello", nil},
+		{"no match", []string{"foo"}, "hello", nil},
+		{"ignore case", []string{"Foo"}, "a FOO b", []Match{{"Foo", 2, 5}}},
+		{"repeated", []string{"ab"}, "abab", []Match{{"ab", 0, 2}, {"ab", 2, 4}}},
+		{"overlapping", []string{"aa"}, "aaa", []Match{{"aa", 0, 2}, {"aa", 1, 3}}},
+		// 失败指针：abcd 在 d 处失配后跳转到 bc，继续命中 bce
+		{"failure link", []string{"abcd", "bce"}, "abce", []Match{{"bce", 1, 4}}},
+		// 输出链：命中 she 时同时命中其后缀 he
+		{"suffix output", []string{"she", "he", "hers"}, "ushers", []Match{{"she", 1, 4}, {"he", 2, 4}, {"hers", 2, 6}}},
+		{"failure to root", []string{"abc", "c"}, "abxc", []Match{{"c", 3, 4}}},
+		{"duplicate and blank words", []string{" ab ", "AB", ""}, "ab", []Match{{"ab", 0, 2}}},
+		// 下标为字符下标，不受多字节字符影响
+		{"multi-byte", []string{"敏感词"}, "含有敏感词。", []Match{{"敏感词", 2, 5}}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := NewMatcher(c.words).FindAll(c.text)
+			if !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("matches %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestMask(t *testing.T) {
+	cases := []struct {
+		name  string
+		words []string
+		text  string
+		want  string
+	}{
+		{"no match", []string{"foo"}, "hello", "hello"},
+		{"ascii", []string{"foo"}, "a foo b", "a *** b"},
+		{"overlapping", []string{"abc", "cd"}, "abcde", "****e"},
+		{"multi-byte", []string{"敏感"}, "含敏感词", "含**词"},
+		{"mixed width", []string{"坏x"}, "é坏X😀", "é**😀"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, _ := NewMatcher(c.words).Mask(c.text)
+			if got != c.want {
+				t.Fatalf("masked %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestStream(t *testing.T) {
+	cases := []struct {
+		name    string
+		words   []string
+		mask    bool
+		chunks  []string
+		want    string
+		matches []Match
+	}{
+		{"no words", nil, true, []string{"he", "llo"}, "hello", nil},
+		{"word across chunks", []string{"secret"}, true, []string{"my sec", "ret is"}, "my ****** is", []Match{{"secret", 3, 9}}},
+		{"word across three chunks", []string{"abcd"}, true, []string{"xa", "b", "cdy"}, "x****y", []Match{{"abcd", 1, 5}}},
+		{"log only", []string{"secret"}, false, []string{"my sec", "ret"}, "my secret", []Match{{"secret", 3, 9}}},
+		{"multi-byte across chunks", []string{"敏感词"}, true, []string{"含有敏", "感词。"}, "含有***。", []Match{{"敏感词", 2, 5}}},
+		{"prefix without match", []string{"abc"}, true, []string{"ab", "x", "ab"}, "abxab", nil},
+		{"failure link across chunks", []string{"abcd", "bce"}, true, []string{"ab", "ce"}, "a***", []Match{{"bce", 1, 4}}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := NewMatcher(c.words).NewStream(c.mask)
+			out := ""
+			for _, chunk := range c.chunks {
+				text, _ := s.Write(chunk)
+				out += text
+			}
+			out += s.Flush()
+			if out != c.want {
+				t.Fatalf("output %q, want %q", out, c.want)
+			}
+			if !reflect.DeepEqual(s.Matches, c.matches) {
+				t.Fatalf("matches %v, want %v", s.Matches, c.matches)
+			}
+		})
+	}
+}
+
+func TestStreamHoldsPrefix(t *testing.T) {
+	s := NewMatcher([]string{"secret"}).NewStream(true)
+
+	// 尾部可能构成敏感词前缀的字符暂不输出
+	if out, _ := s.Write("hello sec"); out != "hell" {
+		t.Fatalf("first chunk output %q", out)
+	}
+	if out, matches := s.Write("ret"); out != "o *" || len(matches) != 1 {
+		t.Fatalf("second chunk output %q matches %v", out, matches)
+	}
+	if out := s.Flush(); out != "*****" {
+		t.Fatalf("flush %q", out)
+	}
+}
@@ -0,0 +1,107 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/helper/image.go
+ */
+package helper
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 支持的图片格式
+var imageExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// 消息图片，URL 为远程图片地址，否则 Data 为图片内容
+type ImageInput struct {
+	URL      string
+	Data     []byte
+	MimeType string
+}
+
+// 解析图片地址，支持 http 地址及 base64 data URL
+func ParseImageURL(value string) (*ImageInput, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://") {
+		return &ImageInput{URL: value}, nil
+	}
+
+	// data:image/png;base64,xxxx
+	if !strings.HasPrefix(value, "data:") {
+		return nil, errors.New("图片地址格式错误")
+	}
+	meta, data, ok := strings.Cut(value[len("data:"):], ",")
+	if !ok || !strings.HasSuffix(meta, ";base64") {
+		return nil, errors.New("图片需为 base64 编码")
+	}
+	bytes, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, errors.New("图片 base64 解码失败")
+	}
+	return NewImageInput(bytes)
+}
+
+// 按图片内容创建，校验图片格式
+func NewImageInput(data []byte) (*ImageInput, error) {
+	mimeType := http.DetectContentType(data)
+	if _, ok := imageExtensions[mimeType]; !ok {
+		return nil, errors.New("不支持的图片格式 " + mimeType)
+	}
+	return &ImageInput{Data: data, MimeType: mimeType}, nil
+}
+
+// 图片保存目录，未配置时为配置文件所在目录下 uploads
+func (c *DefaultConfig) GetUploadPath() string {
+	if c.UploadPath != "" {
+		return c.UploadPath
+	}
+	return filepath.Join(filepath.Dir(c.Path()), "uploads")
+}
+
+// 保存图片到 root 目录，返回相对保存目录的路径；远程图片直接返回地址
+func (img *ImageInput) Save(root string) (string, error) {
+	if img.URL != "" {
+		return img.URL, nil
+	}
+
+	ref := filepath.ToSlash(filepath.Join(time.Now().Format("2006/01/02"), uuid.NewString()+imageExtensions[img.MimeType]))
+	path := filepath.Join(root, ref)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, img.Data, 0644); err != nil {
+		return "", err
+	}
+	return ref, nil
+}
+
+// 读取 root 目录下已保存的图片并转换为请求上游的地址，本地图片转换为 data URL
+func ImageDataURL(root string, ref string) (string, error) {
+	if strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://") {
+		return ref, nil
+	}
+
+	// 防止读取保存目录以外的文件
+	path := filepath.Join(root, filepath.FromSlash(ref))
+	if rel, err := filepath.Rel(root, path); err != nil || strings.HasPrefix(rel, "..") {
+		return "", errors.New("图片路径错误")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return "data:" + http.DetectContentType(data) + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
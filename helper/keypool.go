@@ -0,0 +1,86 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/helper/keypool.go
+ */
+package helper
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// 上游密钥
+type PoolKey struct {
+	ID        uint
+	Provider  string
+	SecretKey string
+}
+
+// 上游密钥池，创建服务时通过 DefaultConfig.SetKeyPool 注册
+type KeyPool interface {
+	// 选取一个可用密钥，密钥池中没有该提供方的密钥时返回 nil, nil
+	Pick(provider string) (*PoolKey, error)
+	// 上报密钥的请求结果，用于统计错误及冷却
+	Report(key *PoolKey, statusCode int, retryAfter time.Duration, err error)
+}
+
+// 从密钥池选取密钥，未注册密钥池时使用配置文件密钥，密钥池无可用密钥时同样回退到配置文件密钥
+func (c *DefaultConfig) pickPoolKey(provider string, fallback string) (key *PoolKey, secretKey string, err error) {
+	secretKey = fallback
+	if c.keyPool == nil {
+		return
+	}
+
+	key, err = c.keyPool.Pick(provider)
+	if err != nil {
+		if fallback != "" {
+			err = nil
+		}
+		return nil, fallback, err
+	}
+	if key != nil {
+		secretKey = key.SecretKey
+	}
+	return
+}
+
+// 在 http 层上报密钥请求结果，流式请求不解析响应时同样生效
+func (c *DefaultConfig) reportPoolKey(client *resty.Client, key *PoolKey) {
+	if key == nil || c.keyPool == nil {
+		return
+	}
+	httpClient := client.GetClient()
+	base := httpClient.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	httpClient.Transport = &poolKeyTransport{base: base, key: key, pool: c.keyPool}
+}
+
+type poolKeyTransport struct {
+	base http.RoundTripper
+	key  *PoolKey
+	pool KeyPool
+}
+
+func (t *poolKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		// 客户端取消或超时不是密钥的问题，仅网络及连接错误计入
+		if req.Context().Err() == nil {
+			t.pool.Report(t.key, 0, 0, err)
+		}
+		return resp, err
+	}
+
+	var retryAfter time.Duration
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		retryAfter = time.Duration(seconds) * time.Second
+	}
+	t.pool.Report(t.key, resp.StatusCode, retryAfter, nil)
+	return resp, nil
+}
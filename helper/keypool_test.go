@@ -0,0 +1,61 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/helper/keypool_test.go
+ */
+package helper
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// 记录上报结果的密钥池
+type reportPool struct {
+	reports []error
+}
+
+func (p *reportPool) Pick(provider string) (*PoolKey, error) { return nil, nil }
+
+func (p *reportPool) Report(key *PoolKey, statusCode int, retryAfter time.Duration, err error) {
+	p.reports = append(p.reports, err)
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestPoolKeyTransportError(t *testing.T) {
+	dialErr := errors.New("dial tcp: connection refused")
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cases := []struct {
+		name    string
+		ctx     context.Context
+		reports int
+	}{
+		{"network error", context.Background(), 1},
+		{"client canceled", canceled, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			pool := &reportPool{}
+			transport := &poolKeyTransport{
+				base: roundTripFunc(func(*http.Request) (*http.Response, error) { return nil, dialErr }),
+				key:  &PoolKey{ID: 1},
+				pool: pool,
+			}
+			req, _ := http.NewRequestWithContext(c.ctx, http.MethodPost, "http://upstream/v1/chat/completions", nil)
+			if _, err := transport.RoundTrip(req); err != dialErr {
+				t.Fatalf("round trip error %v", err)
+			}
+			if len(pool.reports) != c.reports {
+				t.Fatalf("reported %d times, want %d", len(pool.reports), c.reports)
+			}
+		})
+	}
+}
@@ -7,7 +7,6 @@ package logger
 
 import (
 	"os"
-	"sync"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -16,34 +15,10 @@ import (
 
 var LOG_FILE_PATH = "./debug.log"
 
-var (
-	_logger *zap.Logger
-	once    sync.Once
-)
-
-var (
-	Debug func(msg string, fields ...zap.Field)
-	Info  func(msg string, fields ...zap.Field)
-	Warn  func(msg string, fields ...zap.Field)
-	Error func(msg string, fields ...zap.Field)
-	Fatal func(msg string, fields ...zap.Field)
-)
-
-func InitLogger() {
-	once.Do(func() {
-		_logger = loadLogConfig()
-	})
-
-	Debug = _logger.Debug
-	Info = _logger.Info
-	Warn = _logger.Warn
-	Error = _logger.Error
-	Fatal = _logger.Fatal
-}
-
-func loadLogConfig() *zap.Logger {
+// 创建同时输出到标准输出及日志文件的日志对象
+func New(path string) *zap.Logger {
 	encoder := getEncoder()
-	sync := getWriteSync()
+	sync := getWriteSync(path)
 	core := zapcore.NewCore(encoder, sync, zapcore.DebugLevel)
 
 	if os.Getenv("GIN_DEBUG") == "true" {
@@ -74,13 +49,13 @@ func getEncoder() zapcore.Encoder {
 	return zapcore.NewConsoleEncoder(stdEncoderConfig)
 }
 
-func getWriteSync() zapcore.WriteSyncer {
+func getWriteSync(path string) zapcore.WriteSyncer {
 	loggerFileWriter := lumberjack.Logger{
-		Filename:   LOG_FILE_PATH, // 日志文件路径
-		MaxSize:    50,            // 每个日志文件保存的最大尺寸 单位：M
-		MaxBackups: 1,             // 日志文件最多保存多少个备份
-		MaxAge:     30,            // 文件最多保存多少天
-		Compress:   true,          // 是否压缩
+		Filename:   path, // 日志文件路径
+		MaxSize:    50,   // 每个日志文件保存的最大尺寸 单位：M
+		MaxBackups: 1,    // 日志文件最多保存多少个备份
+		MaxAge:     30,   // 文件最多保存多少天
+		Compress:   true, // 是否压缩
 	}
 	syncConsole := zapcore.AddSync(os.Stdout)
 	syncFile := zapcore.AddSync(&loggerFileWriter)
@@ -0,0 +1,461 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/helper/mockupstream/mockupstream.go
+ */
+package mockupstream
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"gpt-zmide-server/helper/tokenizer"
+)
+
+// 模拟上游参数
+type Options struct {
+	Latency time.Duration // 响应延迟，流式为每个分片间隔
+	Models  []string      // /v1/models 返回的模型，为空使用 DefaultModels
+	Rules   []Rule        // 对话脚本，按顺序匹配
+}
+
+// 对话脚本规则
+type Rule struct {
+	Match    string `yaml:"match" json:"match"`       // 最后一条用户消息包含该文本时命中，为空匹配任意消息
+	Reply    string `yaml:"reply" json:"reply"`       // 回复内容
+	Status   int    `yaml:"status" json:"status"`     // 非 0 时返回该错误状态码，如 429、500
+	Latency  int    `yaml:"latency" json:"latency"`   // 延迟毫秒，覆盖全局延迟
+	Truncate int    `yaml:"truncate" json:"truncate"` // 流式输出该数量内容分片后断开连接，不发送结束分片
+}
+
+// 脚本文件格式
+type Script struct {
+	Models []string `yaml:"models" json:"models"`
+	Rules  []Rule   `yaml:"rules" json:"rules"`
+}
+
+// 默认模型列表
+var DefaultModels = []string{"gpt-3.5-turbo", "gpt-4o", "gpt-4o-mini", "text-embedding-3-small"}
+
+// 默认向量维度
+const defaultDimensions = 1536
+
+// 读取 YAML（或 JSON）脚本文件
+func LoadScript(path string) (*Script, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	script := &Script{}
+	if err := yaml.Unmarshal(content, script); err != nil {
+		return nil, err
+	}
+	return script, nil
+}
+
+// 创建兼容 OpenAI 协议的模拟上游处理器，用于离线开发及测试
+//
+// 对话回复由脚本规则决定，未命中规则时回显最后一条用户消息。
+// 用户消息中可包含以下指令临时控制响应：
+//
+//	[mock:429] [mock:500]  返回对应错误状态码
+//	[mock:latency=300]     响应前（流式为每个分片前）延迟 300 毫秒
+//	[mock:truncate=2]      流式输出 2 个内容分片后断开连接
+func New(opts Options) http.Handler {
+	if len(opts.Models) < 1 {
+		opts.Models = DefaultModels
+	}
+	mux := http.NewServeMux()
+	s := &server{opts: opts}
+	mux.HandleFunc("/v1/models", s.models)
+	mux.HandleFunc("/v1/chat/completions", s.chatCompletions)
+	mux.HandleFunc("/v1/embeddings", s.embeddings)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "Unknown request URL: "+r.Method+" "+r.URL.Path)
+	})
+	return mux
+}
+
+type server struct {
+	opts Options
+}
+
+// 返回 OpenAI 格式的错误
+func writeError(w http.ResponseWriter, status int, message string) {
+	errType, code := "server_error", ""
+	switch {
+	case status == http.StatusTooManyRequests:
+		errType, code = "requests", "rate_limit_exceeded"
+		w.Header().Set("Retry-After", "1")
+	case status < http.StatusInternalServerError:
+		errType = "invalid_request_error"
+	}
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": message,
+			"type":    errType,
+			"code":    code,
+		},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Request-Id", "req_mock")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+// 等待延迟，请求取消时返回 false
+func sleep(r *http.Request, latency time.Duration) bool {
+	if latency <= 0 {
+		return true
+	}
+	timer := time.NewTimer(latency)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+func (s *server) models(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	data := []map[string]interface{}{}
+	for _, model := range s.opts.Models {
+		data = append(data, map[string]interface{}{
+			"id":       model,
+			"object":   "model",
+			"created":  0,
+			"owned_by": "mock",
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"object": "list", "data": data})
+}
+
+type chatMessage struct {
+	Role    string          `json:"role"`
+	Name    string          `json:"name,omitempty"`
+	Content json.RawMessage `json:"content"`
+}
+
+// 消息文本，多模态消息仅取文本部分
+func (msg *chatMessage) text() string {
+	var text string
+	if json.Unmarshal(msg.Content, &text) == nil {
+		return text
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if json.Unmarshal(msg.Content, &parts) != nil {
+		return ""
+	}
+	texts := []string{}
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+type chatRequest struct {
+	Model         string         `json:"model"`
+	Messages      []*chatMessage `json:"messages"`
+	Stream        bool           `json:"stream"`
+	StreamOptions *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options"`
+}
+
+// 本次请求的响应方式
+type reply struct {
+	Content  string
+	Status   int
+	Latency  time.Duration
+	Truncate int
+}
+
+var directivePattern = regexp.MustCompile(`\[mock:(\w+)(?:=(\d+))?\]`)
+
+// 按脚本及消息指令确定响应
+func (s *server) reply(prompt string) *reply {
+	res := &reply{Content: "Mock reply: " + prompt, Latency: s.opts.Latency}
+	for _, rule := range s.opts.Rules {
+		if rule.Match != "" && !strings.Contains(prompt, rule.Match) {
+			continue
+		}
+		if rule.Reply != "" {
+			res.Content = rule.Reply
+		}
+		if rule.Latency > 0 {
+			res.Latency = time.Duration(rule.Latency) * time.Millisecond
+		}
+		res.Status = rule.Status
+		res.Truncate = rule.Truncate
+		break
+	}
+
+	for _, match := range directivePattern.FindAllStringSubmatch(prompt, -1) {
+		value, _ := strconv.Atoi(match[2])
+		switch match[1] {
+		case "latency":
+			res.Latency = time.Duration(value) * time.Millisecond
+		case "truncate":
+			if value < 1 {
+				value = 1
+			}
+			res.Truncate = value
+		default:
+			if status, err := strconv.Atoi(match[1]); err == nil && status >= 400 && status < 600 {
+				res.Status = status
+			}
+		}
+	}
+	return res
+}
+
+func (s *server) chatCompletions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var req chatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if len(req.Messages) < 1 {
+		writeError(w, http.StatusBadRequest, "messages is required")
+		return
+	}
+	if req.Model == "" {
+		req.Model = s.opts.Models[0]
+	}
+
+	prompt := ""
+	msgs := []tokenizer.Message{}
+	for _, msg := range req.Messages {
+		text := msg.text()
+		if msg.Role == "user" {
+			prompt = text
+		}
+		msgs = append(msgs, tokenizer.Message{Role: msg.Role, Name: msg.Name, Content: text})
+	}
+	res := s.reply(prompt)
+
+	if !sleep(r, res.Latency) {
+		return
+	}
+	if res.Status != 0 {
+		writeError(w, res.Status, "mock upstream error "+strconv.Itoa(res.Status))
+		return
+	}
+
+	sum := sha256.Sum256([]byte(req.Model + "\n" + prompt))
+	id := "chatcmpl-mock-" + hex.EncodeToString(sum[:6])
+	created := time.Now().Unix()
+	usage := map[string]int{
+		"prompt_tokens":     tokenizer.CountMessages(req.Model, msgs),
+		"completion_tokens": tokenizer.Count(req.Model, res.Content),
+	}
+	usage["total_tokens"] = usage["prompt_tokens"] + usage["completion_tokens"]
+
+	if !req.Stream {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"id":      id,
+			"object":  "chat.completion",
+			"created": created,
+			"model":   req.Model,
+			"choices": []map[string]interface{}{{
+				"index":         0,
+				"message":       map[string]string{"role": "assistant", "content": res.Content},
+				"finish_reason": "stop",
+			}},
+			"usage": usage,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Request-Id", "req_mock")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	send := func(data interface{}) {
+		content, _ := json.Marshal(data)
+		w.Write([]byte("data: " + string(content) + "\n\n"))
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	chunk := func(delta map[string]string, finishReason interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"id":      id,
+			"object":  "chat.completion.chunk",
+			"created": created,
+			"model":   req.Model,
+			"choices": []map[string]interface{}{{
+				"index":         0,
+				"delta":         delta,
+				"finish_reason": finishReason,
+			}},
+		}
+	}
+
+	send(chunk(map[string]string{"role": "assistant", "content": ""}, nil))
+	for i, piece := range splitContent(res.Content) {
+		if res.Truncate > 0 && i >= res.Truncate {
+			// 中断连接模拟上游异常断开
+			panic(http.ErrAbortHandler)
+		}
+		if i > 0 && !sleep(r, res.Latency) {
+			return
+		}
+		send(chunk(map[string]string{"content": piece}, nil))
+	}
+	if res.Truncate > 0 {
+		panic(http.ErrAbortHandler)
+	}
+	send(chunk(map[string]string{}, "stop"))
+	if req.StreamOptions != nil && req.StreamOptions.IncludeUsage {
+		send(map[string]interface{}{
+			"id":      id,
+			"object":  "chat.completion.chunk",
+			"created": created,
+			"model":   req.Model,
+			"choices": []interface{}{},
+			"usage":   usage,
+		})
+	}
+	w.Write([]byte("data: [DONE]\n\n"))
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
+
+// 按单词切分流式分片，较长的片段按 8 个字符切分
+func splitContent(content string) []string {
+	pieces := []string{}
+	for _, word := range strings.SplitAfter(content, " ") {
+		runes := []rune(word)
+		for len(runes) > 8 {
+			pieces = append(pieces, string(runes[:8]))
+			runes = runes[8:]
+		}
+		if len(runes) > 0 {
+			pieces = append(pieces, string(runes))
+		}
+	}
+	return pieces
+}
+
+type embeddingRequest struct {
+	Model          string      `json:"model"`
+	Input          interface{} `json:"input"`
+	EncodingFormat string      `json:"encoding_format"`
+	Dimensions     int         `json:"dimensions"`
+}
+
+func (s *server) embeddings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var req embeddingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	var texts []string
+	switch value := req.Input.(type) {
+	case string:
+		texts = []string{value}
+	case []interface{}:
+		for _, item := range value {
+			// token 数组按其 JSON 文本计算向量
+			content, _ := json.Marshal(item)
+			if text, ok := item.(string); ok {
+				content = []byte(text)
+			}
+			texts = append(texts, string(content))
+		}
+	}
+	if len(texts) < 1 {
+		writeError(w, http.StatusBadRequest, "input is required")
+		return
+	}
+	res := s.reply(strings.Join(texts, "\n"))
+	if !sleep(r, res.Latency) {
+		return
+	}
+	if res.Status != 0 {
+		writeError(w, res.Status, "mock upstream error "+strconv.Itoa(res.Status))
+		return
+	}
+
+	dimensions := req.Dimensions
+	if dimensions <= 0 {
+		dimensions = defaultDimensions
+	}
+	data := []map[string]interface{}{}
+	tokens := 0
+	for i, text := range texts {
+		vector := embed(req.Model+"\n"+text, dimensions)
+		var embedding interface{} = vector
+		if req.EncodingFormat == "base64" {
+			buf := make([]byte, 4*len(vector))
+			for j, v := range vector {
+				binary.LittleEndian.PutUint32(buf[4*j:], math.Float32bits(v))
+			}
+			embedding = base64.StdEncoding.EncodeToString(buf)
+		}
+		data = append(data, map[string]interface{}{"object": "embedding", "index": i, "embedding": embedding})
+		tokens += tokenizer.Count(req.Model, text)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"object": "list",
+		"data":   data,
+		"model":  req.Model,
+		"usage":  map[string]int{"prompt_tokens": tokens, "total_tokens": tokens},
+	})
+}
+
+// 由文本生成确定的单位向量
+func embed(text string, dimensions int) []float32 {
+	sum := sha256.Sum256([]byte(text))
+	random := rand.New(rand.NewSource(int64(binary.LittleEndian.Uint64(sum[:8]))))
+	vector := make([]float32, dimensions)
+	norm := 0.0
+	for i := range vector {
+		v := random.NormFloat64()
+		vector[i] = float32(v)
+		norm += v * v
+	}
+	norm = math.Sqrt(norm)
+	for i := range vector {
+		vector[i] = float32(float64(vector[i]) / norm)
+	}
+	return vector
+}
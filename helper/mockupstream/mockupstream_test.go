@@ -0,0 +1,248 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/helper/mockupstream/mockupstream_test.go
+ */
+package mockupstream
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReply(t *testing.T) {
+	s := &server{opts: Options{
+		Latency: 10 * time.Millisecond,
+		Rules: []Rule{
+			{Match: "weather", Reply: "Sunny", Latency: 50},
+			{Match: "busy", Status: 503},
+			{Match: "cut", Truncate: 3},
+		},
+	}}
+	cases := []struct {
+		name   string
+		prompt string
+		want   reply
+	}{
+		{"echo", "hello", reply{Content: "Mock reply: hello", Latency: 10 * time.Millisecond}},
+		{"rule reply", "weather today", reply{Content: "Sunny", Latency: 50 * time.Millisecond}},
+		{"rule status", "busy now", reply{Content: "Mock reply: busy now", Status: 503, Latency: 10 * time.Millisecond}},
+		{"rule truncate", "cut it", reply{Content: "Mock reply: cut it", Truncate: 3, Latency: 10 * time.Millisecond}},
+		{"status directive", "[mock:429] hi", reply{Content: "Mock reply: [mock:429] hi", Status: 429, Latency: 10 * time.Millisecond}},
+		{"ignore invalid status", "[mock:200] hi", reply{Content: "Mock reply: [mock:200] hi", Latency: 10 * time.Millisecond}},
+		{"latency directive", "[mock:latency=300] hi", reply{Content: "Mock reply: [mock:latency=300] hi", Latency: 300 * time.Millisecond}},
+		{"truncate at least 1", "[mock:truncate=0] hi", reply{Content: "Mock reply: [mock:truncate=0] hi", Truncate: 1, Latency: 10 * time.Millisecond}},
+		{"directive overrides rule", "weather [mock:500]", reply{Content: "Sunny", Status: 500, Latency: 50 * time.Millisecond}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := s.reply(c.prompt); *got != c.want {
+				t.Fatalf("reply %+v, want %+v", *got, c.want)
+			}
+		})
+	}
+}
+
+func TestSplitContent(t *testing.T) {
+	cases := []struct {
+		content string
+		want    []string
+	}{
+		{"", []string{}},
+		{"hello world", []string{"hello ", "world"}},
+		{"abcdefghij k", []string{"abcdefgh", "ij ", "k"}},
+		{"你好世界你好世界你好", []string{"你好世界你好世界", "你好"}},
+	}
+	for _, c := range cases {
+		if got := splitContent(c.content); !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("split %q: %q, want %q", c.content, got, c.want)
+		}
+	}
+}
+
+func post(t *testing.T, handler http.Handler, path, body string) *http.Response {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	res, err := http.Post(server.URL+path, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+	return res
+}
+
+func TestChatCompletions(t *testing.T) {
+	res := post(t, New(Options{}), "/v1/chat/completions",
+		`{"model":"gpt-4o","messages":[{"role":"system","content":"be brief"},{"role":"user","content":[{"type":"text","text":"hello"}]}]}`)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", res.StatusCode)
+	}
+	var body struct {
+		Model   string `json:"model"`
+		Choices []struct {
+			Message      struct{ Content string } `json:"message"`
+			FinishReason string                   `json:"finish_reason"`
+		} `json:"choices"`
+		Usage struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+			TotalTokens      int `json:"total_tokens"`
+		} `json:"usage"`
+	}
+	json.NewDecoder(res.Body).Decode(&body)
+	if body.Model != "gpt-4o" || len(body.Choices) != 1 || body.Choices[0].Message.Content != "Mock reply: hello" || body.Choices[0].FinishReason != "stop" {
+		t.Fatalf("response %+v", body)
+	}
+	if body.Usage.PromptTokens < 1 || body.Usage.CompletionTokens < 1 || body.Usage.TotalTokens != body.Usage.PromptTokens+body.Usage.CompletionTokens {
+		t.Fatalf("usage %+v", body.Usage)
+	}
+}
+
+func TestChatCompletionsError(t *testing.T) {
+	cases := []struct {
+		body   string
+		status int
+		code   string
+	}{
+		{`{"messages":[{"role":"user","content":"[mock:429] hi"}]}`, 429, "rate_limit_exceeded"},
+		{`{"messages":[{"role":"user","content":"[mock:500] hi"}]}`, 500, ""},
+		{`{"messages":[]}`, 400, ""},
+		{`not json`, 400, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.body, func(t *testing.T) {
+			res := post(t, New(Options{}), "/v1/chat/completions", c.body)
+			var body struct {
+				Error struct {
+					Message string `json:"message"`
+					Code    string `json:"code"`
+				} `json:"error"`
+			}
+			json.NewDecoder(res.Body).Decode(&body)
+			if res.StatusCode != c.status || body.Error.Code != c.code || body.Error.Message == "" {
+				t.Fatalf("status %d error %+v", res.StatusCode, body.Error)
+			}
+		})
+	}
+}
+
+// 读取流式响应的 data 行
+func readStream(t *testing.T, body io.Reader) (lines []string, err error) {
+	t.Helper()
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "data: ") {
+			lines = append(lines, strings.TrimPrefix(line, "data: "))
+		}
+	}
+	return lines, scanner.Err()
+}
+
+func TestChatCompletionsStream(t *testing.T) {
+	cases := []struct {
+		name      string
+		prompt    string
+		usage     bool
+		pieces    int  // 内容分片数
+		completed bool // 是否正常结束
+	}{
+		{"with usage", "one two three", true, 5, true},
+		{"without usage", "one two three", false, 5, true},
+		{"truncated", "[mock:truncate=2] one two three", true, 2, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			body := `{"stream":true,"messages":[{"role":"user","content":"` + c.prompt + `"}]`
+			if c.usage {
+				body += `,"stream_options":{"include_usage":true}`
+			}
+			res := post(t, New(Options{}), "/v1/chat/completions", body+"}")
+			lines, err := readStream(t, res.Body)
+			if c.completed != (err == nil) {
+				t.Fatalf("read error %v", err)
+			}
+
+			pieces, usage, done := 0, false, false
+			for _, line := range lines {
+				if line == "[DONE]" {
+					done = true
+					continue
+				}
+				var chunk struct {
+					Choices []struct {
+						Delta struct{ Content string } `json:"delta"`
+					} `json:"choices"`
+					Usage *struct{ TotalTokens int } `json:"usage"`
+				}
+				if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+					t.Fatalf("decode chunk %q: %v", line, err)
+				}
+				if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+					pieces++
+				}
+				if chunk.Usage != nil {
+					usage = true
+				}
+			}
+			if pieces != c.pieces || done != c.completed || usage != (c.usage && c.completed) {
+				t.Fatalf("pieces %d done %v usage %v", pieces, done, usage)
+			}
+		})
+	}
+}
+
+func TestEmbeddings(t *testing.T) {
+	res := post(t, New(Options{}), "/v1/embeddings", `{"model":"text-embedding-3-small","input":["hello","world","hello"],"dimensions":8}`)
+	var body struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float64 `json:"embedding"`
+		} `json:"data"`
+		Usage struct {
+			TotalTokens int `json:"total_tokens"`
+		} `json:"usage"`
+	}
+	json.NewDecoder(res.Body).Decode(&body)
+	if len(body.Data) != 3 || body.Usage.TotalTokens != 3 {
+		t.Fatalf("response %+v", body)
+	}
+
+	// 向量为单位向量，相同输入得到相同向量
+	norm := 0.0
+	for _, v := range body.Data[0].Embedding {
+		norm += v * v
+	}
+	if len(body.Data[0].Embedding) != 8 || math.Abs(norm-1) > 1e-5 {
+		t.Fatalf("embedding %v", body.Data[0].Embedding)
+	}
+	if !reflect.DeepEqual(body.Data[0].Embedding, body.Data[2].Embedding) || reflect.DeepEqual(body.Data[0].Embedding, body.Data[1].Embedding) {
+		t.Fatal("embedding not deterministic per input")
+	}
+}
+
+func TestTransport(t *testing.T) {
+	client := &http.Client{Transport: NewTransport(New(Options{Models: []string{"mock-model"}}))}
+	res, err := client.Get("http://mock/v1/models")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var body struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	json.NewDecoder(res.Body).Decode(&body)
+	if res.StatusCode != http.StatusOK || len(body.Data) != 1 || body.Data[0].ID != "mock-model" {
+		t.Fatalf("status %d models %+v", res.StatusCode, body.Data)
+	}
+}
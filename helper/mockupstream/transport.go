@@ -0,0 +1,111 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/helper/mockupstream/transport.go
+ */
+package mockupstream
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// 进程内调用处理器的 http 传输层，不经过网络
+type Transport struct {
+	Handler http.Handler
+}
+
+func NewTransport(handler http.Handler) *Transport {
+	return &Transport{Handler: handler}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	pr, pw := io.Pipe()
+	w := &pipeResponseWriter{header: http.Header{}, pw: pw, ready: make(chan struct{})}
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		defer func() {
+			if err := recover(); err != nil {
+				// 处理器中断时响应体以读取错误结束，与连接断开一致
+				if err != http.ErrAbortHandler {
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+				pw.CloseWithError(io.ErrUnexpectedEOF)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			pw.Close()
+		}()
+		if req.Body != nil {
+			defer req.Body.Close()
+		}
+		t.Handler.ServeHTTP(w, req)
+	}()
+
+	select {
+	case <-w.ready:
+	case <-req.Context().Done():
+		pr.CloseWithError(req.Context().Err())
+		return nil, req.Context().Err()
+	}
+
+	// 请求取消时结束读取，处理器写入随之失败
+	go func() {
+		select {
+		case <-req.Context().Done():
+			pr.CloseWithError(req.Context().Err())
+		case <-done:
+		}
+	}()
+
+	return &http.Response{
+		Status:        strconv.Itoa(w.status) + " " + http.StatusText(w.status),
+		StatusCode:    w.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        w.sent,
+		Body:          pr,
+		ContentLength: -1,
+		Request:       req,
+	}, nil
+}
+
+// 写入管道的响应，写入状态码后 RoundTrip 返回
+type pipeResponseWriter struct {
+	header http.Header
+	sent   http.Header // 写入状态码时的响应头
+	pw     *io.PipeWriter
+	status int
+	once   sync.Once
+	ready  chan struct{}
+}
+
+func (w *pipeResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *pipeResponseWriter) WriteHeader(status int) {
+	w.once.Do(func() {
+		// 复制响应头，避免返回后处理器继续修改
+		w.sent = w.header.Clone()
+		w.status = status
+		close(w.ready)
+	})
+}
+
+func (w *pipeResponseWriter) Write(data []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	n, err := w.pw.Write(data)
+	if errors.Is(err, io.ErrClosedPipe) {
+		return n, http.ErrAbortHandler
+	}
+	return n, err
+}
+
+func (w *pipeResponseWriter) Flush() {}
@@ -0,0 +1,101 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/helper/provider.go
+ */
+package helper
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 默认上游服务提供方
+const DefaultProviderName = "openai"
+
+// 上游模型信息
+type ProviderModel struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// 上游服务提供方，不同厂商实现该接口即可接入
+type Provider interface {
+	// 提供方名称
+	Name() string
+	// 普通请求
+	Chat(req ChatRequest) (*OpenAIResponse, error)
+	// 流式请求，每收到一行数据回调一次
+	ChatStream(req ChatRequest, streamCall func(line *OpenAIResponseStream)) (*OpenAIResponse, error)
+	// 获取可用模型列表
+	ListModels() ([]*ProviderModel, error)
+	// 检查上游服务是否可用
+	Ping() (status bool, callback string)
+}
+
+// 支持在流式请求中携带 stream_options.include_usage 返回用量的提供方
+type StreamUsageProvider interface {
+	// 流式请求是否要求上游在最后一个分片返回用量
+	IncludeStreamUsage() bool
+}
+
+// 根据配置构造 Provider
+type ProviderFactory func(c *DefaultConfig) (Provider, error)
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]ProviderFactory{}
+)
+
+// 注册上游服务提供方，同名注册会覆盖
+func RegisterProvider(name string, factory ProviderFactory) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || factory == nil {
+		panic("helper: RegisterProvider name or factory is empty")
+	}
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[name] = factory
+}
+
+// 已注册的提供方名称
+func ProviderNames() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 提供方是否已注册
+func HasProvider(name string) bool {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	_, ok := providers[strings.ToLower(name)]
+	return ok
+}
+
+// 获取提供方，name 为空时使用配置的默认提供方
+func (c *DefaultConfig) GetProvider(name string) (Provider, error) {
+	if name == "" {
+		name = c.Provider
+	}
+	if name == "" {
+		name = DefaultProviderName
+	}
+	name = strings.ToLower(name)
+
+	providersMu.RLock()
+	factory, ok := providers[name]
+	providersMu.RUnlock()
+	if !ok {
+		return nil, errors.New("provider " + name + " not registered")
+	}
+	return factory(c)
+}
@@ -0,0 +1,176 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/helper/provider_azure.go
+ */
+package helper
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"sort"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const AzureProviderName = "azure"
+
+func init() {
+	RegisterProvider(AzureProviderName, func(c *DefaultConfig) (Provider, error) {
+		client, err := c.GetAzureHttpClient()
+		if err != nil {
+			return nil, err
+		}
+		return &AzureProvider{Client: client, Config: c, StreamUsage: !c.OpenAI.DisableStreamUsage}, nil
+	})
+}
+
+// Azure OpenAI 服务，按模型名映射到部署名调用
+type AzureProvider struct {
+	Client      *resty.Client
+	Config      *DefaultConfig
+	StreamUsage bool // 流式请求要求上游在最后一个分片返回用量
+}
+
+func (p *AzureProvider) Name() string {
+	return AzureProviderName
+}
+
+func (p *AzureProvider) IncludeStreamUsage() bool {
+	return p.StreamUsage
+}
+
+// 获取请求的部署地址
+func (p *AzureProvider) chatPath(req ChatRequest) (string, error) {
+	model := req.Model
+	if req.RawBody != nil {
+		var body struct {
+			Model string `json:"model"`
+		}
+		if err := json.Unmarshal(req.RawBody, &body); err != nil {
+			return "", err
+		}
+		model = body.Model
+	}
+
+	deployment := p.Config.GetAzureDeployment(model)
+	if deployment == "" {
+		return "", errors.New("azure deployment not found for model " + model)
+	}
+	return "/openai/deployments/" + url.PathEscape(deployment) + "/chat/completions", nil
+}
+
+func (p *AzureProvider) Chat(req ChatRequest) (res *OpenAIResponse, err error) {
+	req.Stream = false
+	path, err := p.chatPath(req)
+	if err != nil {
+		return
+	}
+
+	bodyStr := req.RawBody
+	if bodyStr == nil {
+		if bodyStr, err = json.Marshal(req); err != nil {
+			return
+		}
+	}
+
+	resp, err := p.Client.R().SetContext(req.context()).SetBody(bodyStr).Post(path)
+	if err != nil {
+		return
+	}
+	if !resp.IsSuccess() {
+		return nil, statusError(resp.Status(), resp.Body())
+	}
+
+	if err = json.Unmarshal(resp.Body(), &res); err != nil {
+		return
+	}
+	res.Raw = string(resp.Body())
+	res.RequestID = upstreamRequestID(resp.Header())
+	return
+}
+
+func (p *AzureProvider) ChatStream(req ChatRequest, streamCall func(line *OpenAIResponseStream)) (res *OpenAIResponse, err error) {
+	req.Stream = true
+	if p.StreamUsage {
+		req.StreamOptions = &StreamOptions{IncludeUsage: true}
+	}
+	path, err := p.chatPath(req)
+	if err != nil {
+		return
+	}
+
+	bodyStr := req.RawBody
+	if bodyStr == nil {
+		if bodyStr, err = json.Marshal(req); err != nil {
+			return
+		}
+	}
+
+	resp, err := p.Client.R().
+		SetContext(req.context()).
+		SetDoNotParseResponse(true).
+		SetBody(bodyStr).
+		Post(path)
+	if err != nil {
+		return
+	}
+
+	defer resp.RawBody().Close()
+	if err = streamStatusError(resp, req.Raw); err != nil {
+		return
+	}
+	res, err = readChatStream(resp.RawBody(), req.Raw, streamCall)
+	if res != nil {
+		res.RequestID = upstreamRequestID(resp.Header())
+	}
+	return
+}
+
+// Azure 的可用模型即配置的部署映射
+func (p *AzureProvider) ListModels() ([]*ProviderModel, error) {
+	names := make([]string, 0, len(p.Config.Azure.Deployments))
+	for name := range p.Config.Azure.Deployments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	list := make([]*ProviderModel, 0, len(names))
+	for _, name := range names {
+		list = append(list, &ProviderModel{ID: name, Object: "model", OwnedBy: AzureProviderName})
+	}
+	return list, nil
+}
+
+func (p *AzureProvider) Ping() (status bool, callback string) {
+	resp, err := p.Client.R().Get("/openai/models")
+	if err != nil {
+		return false, err.Error()
+	}
+	if resp.StatusCode() < 200 || resp.StatusCode() >= 300 {
+		return false, resp.Status()
+	}
+	return true, "200"
+}
+
+func (p *AzureProvider) Embeddings(req EmbeddingRequest) (*EmbeddingResponse, error) {
+	deployment := p.Config.GetAzureDeployment(req.Model)
+	if deployment == "" {
+		return nil, errors.New("azure deployment not found for model " + req.Model)
+	}
+
+	resp, err := p.Client.R().SetBody(req).Post("/openai/deployments/" + url.PathEscape(deployment) + "/embeddings")
+	if err != nil {
+		return nil, err
+	}
+	if !resp.IsSuccess() {
+		return nil, statusError(resp.Status(), resp.Body())
+	}
+	res, err := parseEmbeddingResponse(resp.Body())
+	if err != nil {
+		return nil, err
+	}
+	res.RequestID = upstreamRequestID(resp.Header())
+	return res, nil
+}
@@ -0,0 +1,113 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/helper/provider_azure_test.go
+ */
+package helper
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// 上游对所有请求返回 status 及 body
+func newStatusStub(t *testing.T, status int, body string) *resty.Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return resty.New().SetBaseURL(server.URL)
+}
+
+func TestProviderStatusError(t *testing.T) {
+	cases := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{"upstream error message", http.StatusTooManyRequests, `{"error":{"message":"Rate limit reached","code":"429"}}`, "Rate limit reached"},
+		{"empty body", http.StatusInternalServerError, ``, "upstream response status 500 Internal Server Error"},
+		// 部分网关出错时仍返回 JSON 结构，同样按状态码判断
+		{"body without error", http.StatusBadGateway, `{"data":[]}`, "upstream response status 502 Bad Gateway"},
+		{"html error page", http.StatusBadGateway, `<html><body>502 Bad Gateway</body></html>`, "upstream response status 502 Bad Gateway"},
+	}
+	config := &DefaultConfig{}
+	chat := ChatRequest{Model: "gpt-4o", Messages: []*ChatMessage{{Role: "user", Content: "hello"}}}
+	embedding := EmbeddingRequest{Model: "text-embedding-3-small", Input: "hello"}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			client := newStatusStub(t, c.status, c.body)
+			azure := &AzureProvider{Client: client, Config: config}
+			openai := &OpenAIProvider{Client: client}
+			ollama := &OllamaProvider{Client: client}
+
+			calls := map[string]func() error{
+				"azure chat":        func() error { _, err := azure.Chat(chat); return err },
+				"azure embeddings":  func() error { _, err := azure.Embeddings(embedding); return err },
+				"openai chat":       func() error { _, err := openai.Chat(chat); return err },
+				"openai embeddings": func() error { _, err := openai.Embeddings(embedding); return err },
+				"ollama chat":       func() error { _, err := ollama.Chat(chat); return err },
+				"ollama stream":     func() error { _, err := ollama.ChatStream(chat, func(*OpenAIResponseStream) {}); return err },
+			}
+			for name, call := range calls {
+				if err := call(); err == nil || err.Error() != c.want {
+					t.Fatalf("%s error %v, want %q", name, err, c.want)
+				}
+			}
+		})
+	}
+}
+
+// 流式请求携带 stream_options.include_usage，并记录上游返回的用量
+func TestAzureChatStreamUsage(t *testing.T) {
+	var received ChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/openai/deployments/gpt4o/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+		received = ChatRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(`data: {"id":"chatcmpl-1","choices":[{"index":0,"delta":{"role":"assistant","content":"hi"}}]}` + "\n\n"))
+		w.Write([]byte(`data: {"choices":[],"usage":{"prompt_tokens":8,"completion_tokens":1,"total_tokens":9}}` + "\n\n"))
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	t.Cleanup(server.Close)
+
+	config := &DefaultConfig{}
+	config.Azure.Deployments = map[string]string{"gpt-4o": "gpt4o"}
+	req := ChatRequest{Model: "gpt-4o", Messages: []*ChatMessage{{Role: "user", Content: "hello"}}}
+
+	azure := &AzureProvider{Client: resty.New().SetBaseURL(server.URL), Config: config, StreamUsage: true}
+	res, err := azure.ChatStream(req, func(*OpenAIResponseStream) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received.StreamOptions == nil || !received.StreamOptions.IncludeUsage {
+		t.Fatalf("stream options %+v", received.StreamOptions)
+	}
+	if res.Usage.TotalTokens != 9 || res.Choices[0].Message.Content != "hi" {
+		t.Fatalf("response usage %+v choices %+v", res.Usage, res.Choices)
+	}
+
+	// 关闭后不携带该参数
+	azure.StreamUsage = false
+	if _, err := azure.ChatStream(req, func(*OpenAIResponseStream) {}); err != nil {
+		t.Fatal(err)
+	}
+	if received.StreamOptions != nil {
+		t.Fatalf("stream options %+v, want none", received.StreamOptions)
+	}
+}
@@ -0,0 +1,65 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/helper/provider_mock.go
+ */
+package helper
+
+import (
+	"time"
+
+	"github.com/go-resty/resty/v2"
+
+	"gpt-zmide-server/helper/mockupstream"
+)
+
+// 内置模拟上游提供方，用于离线开发及测试
+const MockProviderName = "mock"
+
+// OpenAI BaseUrl 设置为该前缀时使用内置模拟上游
+const MockBaseUrl = "mock://"
+
+func init() {
+	RegisterProvider(MockProviderName, func(c *DefaultConfig) (Provider, error) {
+		client, err := c.GetMockHttpClient()
+		if err != nil {
+			return nil, err
+		}
+		return &MockProvider{OpenAIProvider{Client: client, StreamUsage: true}}, nil
+	})
+}
+
+// 模拟上游使用 OpenAI 协议，无需密钥
+type MockProvider struct {
+	OpenAIProvider
+}
+
+func (p *MockProvider) Name() string {
+	return MockProviderName
+}
+
+func (c *DefaultConfig) GetMockHttpClient() (*resty.Client, error) {
+	client := resty.New()
+	if err := c.useMockUpstream(client); err != nil {
+		return nil, err
+	}
+	client.SetTimeout(20 * time.Minute)
+	client.Header.Add("Content-Type", "application/json")
+	client.Header.Add("Authorization", "Bearer mock")
+	return client, nil
+}
+
+// 按配置创建模拟上游，请求在进程内处理
+func (c *DefaultConfig) useMockUpstream(client *resty.Client) error {
+	opts := mockupstream.Options{Latency: time.Duration(c.Mock.Latency) * time.Millisecond}
+	if c.Mock.Script != "" {
+		script, err := mockupstream.LoadScript(c.Mock.Script)
+		if err != nil {
+			return err
+		}
+		opts.Models, opts.Rules = script.Models, script.Rules
+	}
+	client.SetTransport(mockupstream.NewTransport(mockupstream.New(opts)))
+	client.SetBaseURL("http://mock")
+	return nil
+}
@@ -0,0 +1,416 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/helper/provider_ollama.go
+ */
+package helper
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const OllamaProviderName = "ollama"
+
+func init() {
+	RegisterProvider(OllamaProviderName, func(c *DefaultConfig) (Provider, error) {
+		client, err := c.GetOllamaHttpClient()
+		if err != nil {
+			return nil, err
+		}
+		return &OllamaProvider{Client: client}, nil
+	})
+}
+
+// 本地推理服务（Ollama / 兼容 Ollama /api/chat 协议的 llama.cpp server）
+type OllamaProvider struct {
+	Client *resty.Client
+}
+
+type ollamaOptions struct {
+	Temperature      float64 `json:"temperature,omitempty"`
+	TopP             float64 `json:"top_p,omitempty"`
+	NumPredict       int     `json:"num_predict,omitempty"`
+	FrequencyPenalty float64 `json:"frequency_penalty,omitempty"`
+	PresencePenalty  float64 `json:"presence_penalty,omitempty"`
+}
+
+type ollamaChatRequest struct {
+	Model    string           `json:"model"`
+	Messages []*ollamaMessage `json:"messages"`
+	Stream   bool             `json:"stream"`
+	Tools    []*Tool          `json:"tools,omitempty"`
+	Options  *ollamaOptions   `json:"options,omitempty"`
+}
+
+// Ollama 消息，工具调用参数为 JSON 对象，工具结果按函数名关联
+type ollamaMessage struct {
+	Role      string            `json:"role"`
+	Content   string            `json:"content"`
+	ToolCalls []*ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string            `json:"tool_name,omitempty"`
+	Images    []string          `json:"images,omitempty"` // base64 编码的图片
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+// 将 OpenAI 格式消息转换为 Ollama 消息
+func toOllamaMessages(msgs []*ChatMessage) []*ollamaMessage {
+	toolNames := map[string]string{}
+	list := make([]*ollamaMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		item := &ollamaMessage{Role: msg.Role, Content: msg.Content, ToolName: msg.Name}
+		// 仅支持 base64 图片，远程图片地址忽略
+		for _, part := range msg.Parts {
+			if part.Type != "image_url" || part.ImageURL == nil {
+				continue
+			}
+			if _, data, ok := strings.Cut(part.ImageURL.URL, ";base64,"); ok && strings.HasPrefix(part.ImageURL.URL, "data:") {
+				item.Images = append(item.Images, data)
+			}
+		}
+		for _, call := range msg.ToolCalls {
+			toolNames[call.ID] = call.Function.Name
+			toolCall := &ollamaToolCall{}
+			toolCall.Function.Name = call.Function.Name
+			toolCall.Function.Arguments = json.RawMessage(call.Function.Arguments)
+			if !json.Valid(toolCall.Function.Arguments) {
+				toolCall.Function.Arguments = json.RawMessage("{}")
+			}
+			item.ToolCalls = append(item.ToolCalls, toolCall)
+		}
+		if msg.Role == "tool" && item.ToolName == "" {
+			item.ToolName = toolNames[msg.ToolCallID]
+		}
+		list = append(list, item)
+	}
+	return list
+}
+
+// 将 Ollama 消息转换为 OpenAI 格式，工具调用 ID 由 prefix 及序号生成
+func (msg *ollamaMessage) toChatMessage(prefix string) *ChatMessage {
+	item := &ChatMessage{Role: msg.Role, Content: msg.Content}
+	for i, call := range msg.ToolCalls {
+		item.ToolCalls = append(item.ToolCalls, &ToolCall{
+			ID:   prefix + "-call-" + strconv.Itoa(i),
+			Type: "function",
+			Function: ToolCallFunction{
+				Name:      call.Function.Name,
+				Arguments: string(call.Function.Arguments),
+			},
+		})
+	}
+	return item
+}
+
+// Ollama 返回结构体，流式时每行一个
+type ollamaChatResponse struct {
+	Model           string         `json:"model"`
+	CreatedAt       time.Time      `json:"created_at"`
+	Message         *ollamaMessage `json:"message"`
+	Done            bool           `json:"done"`
+	DoneReason      string         `json:"done_reason"`
+	PromptEvalCount int64          `json:"prompt_eval_count"`
+	EvalCount       int64          `json:"eval_count"`
+	Error           string         `json:"error"`
+}
+
+func (p *OllamaProvider) Name() string {
+	return OllamaProviderName
+}
+
+// 将 OpenAI 格式请求转换为 Ollama 请求
+func (p *OllamaProvider) requestBody(req ChatRequest, stream bool) ([]byte, error) {
+	if req.RawBody != nil {
+		if err := json.Unmarshal(req.RawBody, &req); err != nil {
+			return nil, err
+		}
+	}
+
+	body := &ollamaChatRequest{
+		Model:    req.Model,
+		Messages: toOllamaMessages(req.Messages),
+		Stream:   stream,
+		Tools:    req.Tools,
+	}
+	if req.Temperature != 0 || req.TopP != 0 || req.MaxTokens != 0 || req.FrequencyPenalty != 0 || req.PresencePenalty != 0 {
+		body.Options = &ollamaOptions{
+			Temperature:      req.Temperature,
+			TopP:             req.TopP,
+			NumPredict:       req.MaxTokens,
+			FrequencyPenalty: req.FrequencyPenalty,
+			PresencePenalty:  req.PresencePenalty,
+		}
+	}
+	return json.Marshal(body)
+}
+
+// 生成兼容 OpenAI 的响应 ID
+func (p *OllamaProvider) responseID(created time.Time) string {
+	return "chatcmpl-ollama-" + strconv.FormatInt(created.UnixNano(), 36)
+}
+
+func (p *OllamaProvider) finishReason(line *ollamaChatResponse) string {
+	if !line.Done {
+		return ""
+	}
+	if line.DoneReason != "" {
+		return line.DoneReason
+	}
+	return "stop"
+}
+
+func (p *OllamaProvider) Chat(req ChatRequest) (res *OpenAIResponse, err error) {
+	bodyStr, err := p.requestBody(req, false)
+	if err != nil {
+		return
+	}
+
+	resp, err := p.Client.R().SetContext(req.context()).SetBody(bodyStr).Post("/api/chat")
+	if err != nil {
+		return
+	}
+	if !resp.IsSuccess() {
+		return nil, statusError(resp.Status(), resp.Body())
+	}
+
+	var data ollamaChatResponse
+	if err = json.Unmarshal(resp.Body(), &data); err != nil {
+		return
+	}
+	if data.Error != "" {
+		return nil, errors.New(data.Error)
+	}
+
+	res = &OpenAIResponse{
+		ID:      p.responseID(data.CreatedAt),
+		Model:   data.Model,
+		Object:  "chat.completion",
+		Created: data.CreatedAt.Unix(),
+		Raw:     string(resp.Body()),
+	}
+	res.Usage.PromptTokens = data.PromptEvalCount
+	res.Usage.CompletionTokens = data.EvalCount
+	res.Usage.TotalTokens = data.PromptEvalCount + data.EvalCount
+	if data.Message != nil {
+		message := data.Message.toChatMessage(res.ID)
+		finishReason := p.finishReason(&data)
+		if len(message.ToolCalls) > 0 {
+			finishReason = "tool_calls"
+		}
+		res.Choices = []*ChatChoices{
+			{
+				Message:      message,
+				Index:        0,
+				FinishReason: finishReason,
+			},
+		}
+	}
+	return
+}
+
+// 读取 NDJSON 流式响应，转换为 OpenAIResponseStream 回调
+func (p *OllamaProvider) ChatStream(req ChatRequest, streamCall func(line *OpenAIResponseStream)) (res *OpenAIResponse, err error) {
+	bodyStr, err := p.requestBody(req, true)
+	if err != nil {
+		return
+	}
+
+	resp, err := p.Client.R().
+		SetContext(req.context()).
+		SetDoNotParseResponse(true).
+		SetBody(bodyStr).
+		Post("/api/chat")
+	if err != nil {
+		return
+	}
+
+	defer resp.RawBody().Close()
+	// 响应内容为转换后的分片，原样返回时同样按状态码返回错误
+	if err = streamStatusError(resp, false); err != nil {
+		return
+	}
+	reader := bufio.NewReader(resp.RawBody())
+
+	res = &OpenAIResponse{Object: "chat.completion"}
+	message := &ChatMessage{Role: "assistant"}
+	finishReason := "stop"
+
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if len(strings.TrimSpace(string(line))) > 0 {
+			var data ollamaChatResponse
+			if jsonErr := json.Unmarshal(line, &data); jsonErr != nil {
+				err = jsonErr
+				break
+			}
+			if data.Error != "" {
+				err = errors.New(data.Error)
+				break
+			}
+
+			if res.ID == "" {
+				res.ID = p.responseID(data.CreatedAt)
+				res.Model = data.Model
+				res.Created = data.CreatedAt.Unix()
+			}
+
+			resStream := &OpenAIResponseStream{
+				ID:      res.ID,
+				Model:   data.Model,
+				Object:  "chat.completion.chunk",
+				Created: res.Created,
+				Choices: []*ChatStreamChoice{
+					{FinishReason: p.finishReason(&data)},
+				},
+			}
+			if data.Message != nil {
+				resStream.Choices[0].Delta.Role = data.Message.Role
+				resStream.Choices[0].Delta.Content = data.Message.Content
+				message.Content += data.Message.Content
+
+				// Ollama 每个分片中的工具调用是完整的，按顺序编号
+				for _, call := range data.Message.toChatMessage(res.ID + "-" + strconv.Itoa(len(message.ToolCalls))).ToolCalls {
+					index := len(message.ToolCalls)
+					message.ToolCalls = append(message.ToolCalls, call)
+					delta := *call
+					delta.Index = &index
+					resStream.Choices[0].Delta.ToolCalls = append(resStream.Choices[0].Delta.ToolCalls, &delta)
+				}
+			}
+
+			if data.Done {
+				finishReason = p.finishReason(&data)
+				if len(message.ToolCalls) > 0 {
+					finishReason = "tool_calls"
+				}
+				resStream.Choices[0].FinishReason = finishReason
+				res.Usage.PromptTokens = data.PromptEvalCount
+				res.Usage.CompletionTokens = data.EvalCount
+				res.Usage.TotalTokens = data.PromptEvalCount + data.EvalCount
+			}
+
+			// 原样返回时按 OpenAI SSE 格式输出
+			jsonData, _ := json.Marshal(resStream)
+			res.Raw += string(jsonData)
+			if req.Raw {
+				resStream.Raw = "data: " + string(jsonData) + "\n\n"
+			}
+			streamCall(resStream)
+
+			if data.Done {
+				if req.Raw {
+					streamCall(&OpenAIResponseStream{Raw: "data: [DONE]\n\n"})
+				}
+				break
+			}
+		}
+
+		if readErr != nil {
+			if readErr != io.EOF {
+				err = readErr
+			}
+			break
+		}
+	}
+
+	if res.ID != "" {
+		res.Choices = []*ChatChoices{
+			{
+				Message:      message,
+				Index:        0,
+				FinishReason: finishReason,
+			},
+		}
+	}
+
+	return
+}
+
+func (p *OllamaProvider) ListModels() ([]*ProviderModel, error) {
+	resp, err := p.Client.R().Get("/api/tags")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() < 200 || resp.StatusCode() >= 300 {
+		return nil, errors.New(resp.Status())
+	}
+
+	var data struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.Unmarshal(resp.Body(), &data); err != nil {
+		return nil, err
+	}
+
+	list := make([]*ProviderModel, 0, len(data.Models))
+	for _, item := range data.Models {
+		list = append(list, &ProviderModel{ID: item.Name, Object: "model", OwnedBy: OllamaProviderName})
+	}
+	return list, nil
+}
+
+func (p *OllamaProvider) Ping() (status bool, callback string) {
+	if _, err := p.ListModels(); err != nil {
+		return false, err.Error()
+	}
+	return true, "200"
+}
+
+// 调用 /api/embed 并转换为 OpenAI 格式，仅支持文本输入及浮点数组输出
+func (p *OllamaProvider) Embeddings(req EmbeddingRequest) (*EmbeddingResponse, error) {
+	texts, tokens, err := EmbeddingInputs(req.Input)
+	if err != nil {
+		return nil, err
+	}
+	if tokens > 0 {
+		return nil, errors.New("ollama embeddings not support token input")
+	}
+
+	resp, err := p.Client.R().SetBody(map[string]interface{}{
+		"model": req.Model,
+		"input": texts,
+	}).Post("/api/embed")
+	if err != nil {
+		return nil, err
+	}
+
+	var data struct {
+		Model           string            `json:"model"`
+		Embeddings      []json.RawMessage `json:"embeddings"`
+		PromptEvalCount int64             `json:"prompt_eval_count"`
+		Error           string            `json:"error"`
+	}
+	if err = json.Unmarshal(resp.Body(), &data); err != nil {
+		return nil, err
+	}
+	if data.Error != "" {
+		return nil, errors.New(data.Error)
+	}
+
+	res := &EmbeddingResponse{
+		Object: "list",
+		Model:  data.Model,
+		Raw:    string(resp.Body()),
+	}
+	for i, embedding := range data.Embeddings {
+		res.Data = append(res.Data, &Embedding{Object: "embedding", Embedding: embedding, Index: i})
+	}
+	res.Usage.PromptTokens = data.PromptEvalCount
+	res.Usage.TotalTokens = data.PromptEvalCount
+	return res, nil
+}
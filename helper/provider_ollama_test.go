@@ -0,0 +1,135 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/helper/provider_ollama_test.go
+ */
+package helper
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// 模拟 Ollama /api/chat，流式时逐行输出 lines，最后一行携带用量
+func newOllamaStub(t *testing.T, lines ...string) (*DefaultConfig, *ollamaChatRequest) {
+	t.Helper()
+	received := &ollamaChatRequest{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" || r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(received); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for _, line := range lines {
+			w.Write([]byte(line + "\n"))
+			w.(http.Flusher).Flush()
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	config := &DefaultConfig{}
+	config.Ollama.BaseUrl = server.URL + "/"
+	return config, received
+}
+
+func ollamaRequest() ChatRequest {
+	return ChatRequest{
+		Provider:    OllamaProviderName,
+		Model:       "llama3",
+		Messages:    []*ChatMessage{{Role: "system", Content: "be brief"}, {Role: "user", Content: "hello"}},
+		Temperature: 0.5,
+	}
+}
+
+func TestOllamaChatStream(t *testing.T) {
+	config, received := newOllamaStub(t,
+		`{"model":"llama3","created_at":"2026-10-17T08:00:00Z","message":{"role":"assistant","content":"Hel"},"done":false}`,
+		``,
+		`{"model":"llama3","created_at":"2026-10-17T08:00:00Z","message":{"role":"assistant","content":"lo!"},"done":false}`,
+		`{"model":"llama3","created_at":"2026-10-17T08:00:01Z","message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":12,"eval_count":3}`,
+	)
+
+	var chunks []*OpenAIResponseStream
+	res, err := config.ChatGptAsk(ollamaRequest(), func(line *OpenAIResponseStream) {
+		chunks = append(chunks, line)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 请求按 Ollama 格式转换
+	if !received.Stream || received.Model != "llama3" || len(received.Messages) != 2 || received.Messages[1].Content != "hello" {
+		t.Fatalf("received request %+v", received)
+	}
+	if received.Options == nil || received.Options.Temperature != 0.5 {
+		t.Fatalf("received options %+v", received.Options)
+	}
+
+	// 每行转换为一个 OpenAI 分片，最后一个分片携带结束原因
+	if len(chunks) != 3 {
+		t.Fatalf("got %d chunks, want 3", len(chunks))
+	}
+	content := ""
+	for _, chunk := range chunks {
+		if chunk.ID != res.ID || chunk.Object != "chat.completion.chunk" {
+			t.Fatalf("chunk %+v", chunk)
+		}
+		content += chunk.Choices[0].Delta.Content
+	}
+	if content != "Hello!" || chunks[0].Choices[0].FinishReason != "" || chunks[2].Choices[0].FinishReason != "stop" {
+		t.Fatalf("chunks content %q finish %q", content, chunks[2].Choices[0].FinishReason)
+	}
+
+	// 完整消息及最后一行的用量
+	if len(res.Choices) != 1 || res.Choices[0].Message.Content != "Hello!" || res.Choices[0].FinishReason != "stop" {
+		t.Fatalf("response choices %+v", res.Choices)
+	}
+	if res.Usage.PromptTokens != 12 || res.Usage.CompletionTokens != 3 || res.Usage.TotalTokens != 15 {
+		t.Fatalf("response usage %+v", res.Usage)
+	}
+	if !strings.HasPrefix(res.ID, "chatcmpl-ollama-") || res.Model != "llama3" {
+		t.Fatalf("response id %q model %q", res.ID, res.Model)
+	}
+}
+
+func TestOllamaChatStreamError(t *testing.T) {
+	config, _ := newOllamaStub(t,
+		`{"model":"llama3","created_at":"2026-10-17T08:00:00Z","message":{"role":"assistant","content":"Hel"},"done":false}`,
+		`{"error":"model runner has unexpectedly stopped"}`,
+	)
+
+	var chunks int
+	_, err := config.ChatGptAsk(ollamaRequest(), func(line *OpenAIResponseStream) { chunks++ })
+	if err == nil || err.Error() != "model runner has unexpectedly stopped" {
+		t.Fatalf("got error %v", err)
+	}
+	if chunks != 1 {
+		t.Fatalf("got %d chunks before error, want 1", chunks)
+	}
+}
+
+func TestOllamaChat(t *testing.T) {
+	config, received := newOllamaStub(t,
+		`{"model":"llama3","created_at":"2026-10-17T08:00:00Z","message":{"role":"assistant","content":"Hello!"},"done":true,"done_reason":"length","prompt_eval_count":12,"eval_count":3}`,
+	)
+
+	res, err := config.ChatGptAsk(ollamaRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received.Stream {
+		t.Fatal("non-stream request sent with stream true")
+	}
+	if len(res.Choices) != 1 || res.Choices[0].Message.Content != "Hello!" || res.Choices[0].FinishReason != "length" {
+		t.Fatalf("response choices %+v", res.Choices)
+	}
+	if res.Usage.PromptTokens != 12 || res.Usage.CompletionTokens != 3 || res.Usage.TotalTokens != 15 {
+		t.Fatalf("response usage %+v", res.Usage)
+	}
+}
@@ -0,0 +1,261 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/helper/provider_openai.go
+ */
+package helper
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/go-resty/resty/v2"
+)
+
+func init() {
+	RegisterProvider(DefaultProviderName, func(c *DefaultConfig) (Provider, error) {
+		client, err := c.GetOpenAIHttpClient()
+		if err != nil {
+			return nil, err
+		}
+		return &OpenAIProvider{Client: client, StreamUsage: !c.OpenAI.DisableStreamUsage}, nil
+	})
+}
+
+// OpenAI 官方接口（以及兼容 OpenAI 协议的服务）
+type OpenAIProvider struct {
+	Client      *resty.Client
+	StreamUsage bool // 流式请求要求上游在最后一个分片返回用量
+}
+
+func (p *OpenAIProvider) Name() string {
+	return DefaultProviderName
+}
+
+func (p *OpenAIProvider) IncludeStreamUsage() bool {
+	return p.StreamUsage
+}
+
+// 构造请求体
+func (p *OpenAIProvider) requestBody(req ChatRequest) ([]byte, error) {
+	if req.RawBody != nil {
+		return req.RawBody, nil
+	}
+	return json.Marshal(req)
+}
+
+func (p *OpenAIProvider) Chat(req ChatRequest) (res *OpenAIResponse, err error) {
+	req.Stream = false
+	bodyStr, err := p.requestBody(req)
+	if err != nil {
+		return
+	}
+
+	resp, err := p.Client.R().SetContext(req.context()).SetBody(bodyStr).Post("/v1/chat/completions")
+	if err != nil {
+		return
+	}
+	if !resp.IsSuccess() {
+		return nil, statusError(resp.Status(), resp.Body())
+	}
+
+	if err = json.Unmarshal(resp.Body(), &res); err != nil {
+		return
+	}
+	res.Raw = string(resp.Body())
+	res.RequestID = upstreamRequestID(resp.Header())
+	return
+}
+
+func (p *OpenAIProvider) ChatStream(req ChatRequest, streamCall func(line *OpenAIResponseStream)) (res *OpenAIResponse, err error) {
+	req.Stream = true
+	if p.StreamUsage {
+		req.StreamOptions = &StreamOptions{IncludeUsage: true}
+	}
+	bodyStr, err := p.requestBody(req)
+	if err != nil {
+		return
+	}
+
+	resp, err := p.Client.R().
+		SetContext(req.context()).
+		SetDoNotParseResponse(true).
+		SetBody(bodyStr).
+		Post("/v1/chat/completions")
+	if err != nil {
+		return
+	}
+
+	defer resp.RawBody().Close()
+	if err = streamStatusError(resp, req.Raw); err != nil {
+		return
+	}
+	res, err = readChatStream(resp.RawBody(), req.Raw, streamCall)
+	if res != nil {
+		res.RequestID = upstreamRequestID(resp.Header())
+	}
+	return
+}
+
+// 流式请求上游返回错误状态码时读取错误信息，原样返回时交由调用方处理
+func streamStatusError(resp *resty.Response, raw bool) error {
+	if raw || resp.StatusCode() < http.StatusBadRequest {
+		return nil
+	}
+	body, _ := io.ReadAll(resp.RawBody())
+	return statusError(resp.Status(), body)
+}
+
+// 上游返回错误状态码，优先使用响应中的错误信息
+func statusError(status string, body []byte) error {
+	if err := parseUpstreamError(body); err != nil {
+		return err
+	}
+	return errors.New("upstream response status " + status)
+}
+
+// 逐行读取 OpenAI 协议的 SSE 响应，拼接完整消息；原样返回时逐行转发，同时解析数据行记录回复内容及用量
+func readChatStream(body io.Reader, raw bool, streamCall func(line *OpenAIResponseStream)) (res *OpenAIResponse, err error) {
+	reader := bufio.NewReader(body)
+
+	res = &OpenAIResponse{}
+	message := &ChatMessage{
+		Role:    "",
+		Content: "",
+	}
+	finishReason := ""
+
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil {
+			if readErr != io.EOF {
+				err = readErr
+			}
+			break
+		}
+
+		// 是否指定原样返回
+		if raw {
+			streamCall(&OpenAIResponseStream{Raw: string(line)})
+		}
+
+		// 去掉 data: 前缀
+		jsonData := strings.TrimSpace(strings.TrimPrefix(string(line), "data:"))
+
+		// 原样返回时继续转发结束标记之后的内容
+		if jsonData == "[DONE]" && !raw {
+			break
+		}
+
+		// 跳过空行、注释及 event 等非数据行，数据解析失败或上游返回错误时中断
+		if !strings.HasPrefix(jsonData, "{") {
+			continue
+		}
+		var resStream *OpenAIResponseStream
+		parseErr := parseUpstreamError([]byte(jsonData))
+		if parseErr == nil {
+			parseErr = json.Unmarshal([]byte(jsonData), &resStream)
+		}
+		if parseErr != nil {
+			// 原样返回时错误内容已转发给客户端
+			if raw {
+				continue
+			}
+			err = parseErr
+			break
+		}
+
+		// 用量分片不含 choices
+		if resStream != nil && resStream.Usage != nil {
+			res.Usage = *resStream.Usage
+		}
+
+		if resStream == nil || len(resStream.Choices) < 1 {
+			continue
+		}
+		if resStream.Choices[0].Delta.Role != "" {
+			message.Role = resStream.Choices[0].Delta.Role
+		}
+
+		if resStream.Choices[0].Delta.Content != "" {
+			message.Content += resStream.Choices[0].Delta.Content
+		}
+
+		if len(resStream.Choices[0].Delta.ToolCalls) > 0 {
+			message.ToolCalls = mergeToolCallDeltas(message.ToolCalls, resStream.Choices[0].Delta.ToolCalls)
+		}
+
+		if resStream.Choices[0].FinishReason != "" {
+			finishReason = resStream.Choices[0].FinishReason
+		}
+
+		res.Raw += jsonData
+		if res.ID == "" {
+			res.ID = resStream.ID
+			res.Model = resStream.Model
+			res.Object = resStream.Object
+			res.Created = resStream.Created
+		}
+
+		if !raw {
+			streamCall(resStream)
+		}
+	}
+
+	if res.ID != "" {
+		res.Choices = []*ChatChoices{
+			{
+				Message:      message,
+				Index:        0,
+				FinishReason: finishReason,
+			},
+		}
+	}
+
+	return
+}
+
+func (p *OpenAIProvider) ListModels() ([]*ProviderModel, error) {
+	resp, err := p.Client.R().Get("/v1/models")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() < 200 || resp.StatusCode() >= 300 {
+		return nil, errors.New(resp.Status())
+	}
+
+	var data struct {
+		Data []*ProviderModel `json:"data"`
+	}
+	if err := json.Unmarshal(resp.Body(), &data); err != nil {
+		return nil, err
+	}
+	return data.Data, nil
+}
+
+func (p *OpenAIProvider) Ping() (status bool, callback string) {
+	if _, err := p.ListModels(); err != nil {
+		return false, err.Error()
+	}
+	return true, "200"
+}
+
+func (p *OpenAIProvider) Embeddings(req EmbeddingRequest) (*EmbeddingResponse, error) {
+	resp, err := p.Client.R().SetBody(req).Post("/v1/embeddings")
+	if err != nil {
+		return nil, err
+	}
+	if !resp.IsSuccess() {
+		return nil, statusError(resp.Status(), resp.Body())
+	}
+	res, err := parseEmbeddingResponse(resp.Body())
+	if err != nil {
+		return nil, err
+	}
+	res.RequestID = upstreamRequestID(resp.Header())
+	return res, nil
+}
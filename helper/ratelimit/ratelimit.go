@@ -0,0 +1,167 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/helper/ratelimit/ratelimit.go
+ */
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// 限流规则，每个周期补充 Limit 个令牌，桶容量为 Limit
+type Rule struct {
+	Limit  int64
+	Window time.Duration
+}
+
+// 限流结果
+type Result struct {
+	Allowed    bool
+	Limit      int64
+	Remaining  int64
+	RetryAfter time.Duration // 不允许时需等待的时间
+	ResetAfter time.Duration // 令牌桶补满需要的时间
+}
+
+// 限流状态存储，多实例部署时可替换为共享存储实现
+type Store interface {
+	// 从令牌桶中取 cost 个令牌，余量不足时不扣减；cost 为 0 时仅检查余量是否大于 0
+	Take(key string, rule Rule, cost int64) (Result, error)
+	// 直接扣减令牌，余量允许为负，用于请求完成后按实际用量计费
+	Charge(key string, rule Rule, cost int64) error
+	// 占用并发名额
+	Acquire(key string, limit int64) (ok bool, current int64, err error)
+	// 释放并发名额
+	Release(key string) error
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	rule    Rule
+}
+
+// 清理已补满的令牌桶的间隔
+const sweepInterval = time.Minute
+
+// 内存限流存储，仅适用于单实例部署
+type MemoryStore struct {
+	mu         sync.Mutex
+	buckets    map[string]*bucket
+	concurrent map[string]int64
+	swept      time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:    map[string]*bucket{},
+		concurrent: map[string]int64{},
+	}
+}
+
+// 按时间补充令牌
+func (s *MemoryStore) refill(key string, rule Rule, now time.Time) *bucket {
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rule.Limit), updated: now, rule: rule}
+		s.buckets[key] = b
+		return b
+	}
+	b.rule = rule
+
+	elapsed := now.Sub(b.updated)
+	if elapsed > 0 && rule.Window > 0 {
+		b.tokens += float64(rule.Limit) * elapsed.Seconds() / rule.Window.Seconds()
+		if b.tokens > float64(rule.Limit) {
+			b.tokens = float64(rule.Limit)
+		}
+	}
+	b.updated = now
+	return b
+}
+
+// 删除已补满的令牌桶，补满的令牌桶与新建的一致，按周期窗口生成的 key 过期后也会被清理
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.swept) < sweepInterval {
+		return
+	}
+	s.swept = now
+	for key, b := range s.buckets {
+		if !now.Before(b.updated.Add(b.rule.waitFor(b.tokens, float64(b.rule.Limit)))) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// 补充到指定令牌数需要的时间
+func (rule Rule) waitFor(tokens float64, target float64) time.Duration {
+	if tokens >= target || rule.Limit <= 0 {
+		return 0
+	}
+	seconds := (target - tokens) * rule.Window.Seconds() / float64(rule.Limit)
+	return time.Duration(seconds * float64(time.Second))
+}
+
+func (s *MemoryStore) Take(key string, rule Rule, cost int64) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+	b := s.refill(key, rule, now)
+	result := Result{Limit: rule.Limit}
+
+	need := float64(cost)
+	if cost <= 0 {
+		need = 1
+	}
+	if b.tokens >= need {
+		result.Allowed = true
+		b.tokens -= float64(cost)
+	} else {
+		result.RetryAfter = rule.waitFor(b.tokens, need)
+	}
+
+	if b.tokens > 0 {
+		result.Remaining = int64(b.tokens)
+	}
+	result.ResetAfter = rule.waitFor(b.tokens, float64(rule.Limit))
+	return result, nil
+}
+
+func (s *MemoryStore) Charge(key string, rule Rule, cost int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+	b := s.refill(key, rule, now)
+	b.tokens -= float64(cost)
+	return nil
+}
+
+func (s *MemoryStore) Acquire(key string, limit int64) (bool, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := s.concurrent[key]
+	if limit > 0 && current >= limit {
+		return false, current, nil
+	}
+	s.concurrent[key] = current + 1
+	return true, current + 1, nil
+}
+
+func (s *MemoryStore) Release(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.concurrent[key] <= 1 {
+		delete(s.concurrent, key)
+		return nil
+	}
+	s.concurrent[key]--
+	return nil
+}
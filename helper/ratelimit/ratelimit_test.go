@@ -0,0 +1,159 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/helper/ratelimit/ratelimit_test.go
+ */
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRefill(t *testing.T) {
+	rule := Rule{Limit: 60, Window: time.Minute}
+	start := time.Date(2026, 10, 17, 8, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name    string
+		tokens  float64
+		elapsed time.Duration
+		want    float64
+	}{
+		{"no time passed", 10, 0, 10},
+		{"one token per second", 10, 5 * time.Second, 15},
+		{"capped at limit", 50, time.Minute, 60},
+		{"recover from negative", -30, 40 * time.Second, 10},
+		{"clock going backwards", 10, -time.Second, 10},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := NewMemoryStore()
+			s.buckets["key"] = &bucket{tokens: c.tokens, updated: start}
+			b := s.refill("key", rule, start.Add(c.elapsed))
+			if b.tokens != c.want {
+				t.Fatalf("tokens %v, want %v", b.tokens, c.want)
+			}
+		})
+	}
+
+	// 新建的令牌桶为满
+	s := NewMemoryStore()
+	if b := s.refill("new", rule, start); b.tokens != 60 || !b.updated.Equal(start) {
+		t.Fatalf("new bucket %+v", b)
+	}
+}
+
+func TestWaitFor(t *testing.T) {
+	rule := Rule{Limit: 60, Window: time.Minute}
+	cases := []struct {
+		name   string
+		rule   Rule
+		tokens float64
+		target float64
+		want   time.Duration
+	}{
+		{"enough tokens", rule, 5, 1, 0},
+		{"one token short", rule, 0, 1, time.Second},
+		{"negative balance", rule, -9, 1, 10 * time.Second},
+		{"fraction", rule, 0.5, 1, 500 * time.Millisecond},
+		{"no limit", Rule{Window: time.Minute}, 0, 1, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.rule.waitFor(c.tokens, c.target); got != c.want {
+				t.Fatalf("wait %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestTake(t *testing.T) {
+	rule := Rule{Limit: 3, Window: time.Hour}
+	s := NewMemoryStore()
+
+	// 桶内令牌用尽后拒绝，并给出补充一个令牌的冷却时间
+	for i := int64(2); i >= 0; i-- {
+		result, _ := s.Take("key", rule, 1)
+		if !result.Allowed || result.Remaining != i || result.Limit != 3 {
+			t.Fatalf("take %d %+v", i, result)
+		}
+	}
+	result, _ := s.Take("key", rule, 1)
+	if result.Allowed || result.Remaining != 0 {
+		t.Fatalf("take on empty bucket %+v", result)
+	}
+	if result.RetryAfter <= 19*time.Minute || result.RetryAfter > 20*time.Minute {
+		t.Fatalf("retry after %v", result.RetryAfter)
+	}
+	if result.ResetAfter <= 59*time.Minute || result.ResetAfter > time.Hour {
+		t.Fatalf("reset after %v", result.ResetAfter)
+	}
+
+	// cost 为 0 时仅检查余量，不扣减
+	s = NewMemoryStore()
+	if result, _ := s.Take("key", rule, 0); !result.Allowed || result.Remaining != 3 {
+		t.Fatalf("check only %+v", result)
+	}
+
+	// 按实际用量扣减后余量为负，需等待补充到 1 个令牌
+	s.Charge("key", rule, 5)
+	result, _ = s.Take("key", rule, 0)
+	if result.Allowed || result.Remaining != 0 {
+		t.Fatalf("take after overcharge %+v", result)
+	}
+	if result.RetryAfter <= 59*time.Minute || result.RetryAfter > time.Hour {
+		t.Fatalf("retry after overcharge %v", result.RetryAfter)
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	s := NewMemoryStore()
+	for i := int64(1); i <= 2; i++ {
+		if ok, current, _ := s.Acquire("key", 2); !ok || current != i {
+			t.Fatalf("acquire %d: ok %v current %d", i, ok, current)
+		}
+	}
+	if ok, current, _ := s.Acquire("key", 2); ok || current != 2 {
+		t.Fatalf("acquire over limit: ok %v current %d", ok, current)
+	}
+
+	s.Release("key")
+	if ok, _, _ := s.Acquire("key", 2); !ok {
+		t.Fatal("acquire after release rejected")
+	}
+	s.Release("key")
+	s.Release("key")
+	if _, ok := s.concurrent["key"]; ok {
+		t.Fatalf("released key kept %d", s.concurrent["key"])
+	}
+
+	// limit 为 0 时不限制
+	if ok, _, _ := s.Acquire("other", 0); !ok {
+		t.Fatal("unlimited acquire rejected")
+	}
+}
+
+func TestSweep(t *testing.T) {
+	s := NewMemoryStore()
+	s.Take("minute", Rule{Limit: 2, Window: time.Minute}, 1)
+	s.Take("hour", Rule{Limit: 2, Window: time.Hour}, 1)
+	s.Charge("negative", Rule{Limit: 2, Window: time.Minute}, 10)
+
+	// 未到清理间隔时不清理
+	s.sweep(time.Now().Add(time.Second))
+	if len(s.buckets) != 3 {
+		t.Fatalf("buckets %d before sweep interval", len(s.buckets))
+	}
+
+	// 两分钟后仅补满的令牌桶被删除，超额扣减的令牌桶需更长时间补满
+	s.sweep(time.Now().Add(2 * time.Minute))
+	if _, ok := s.buckets["minute"]; ok || len(s.buckets) != 2 {
+		t.Fatalf("buckets after sweep %v", s.buckets)
+	}
+
+	s.sweep(time.Now().Add(2 * time.Hour))
+	if len(s.buckets) != 0 {
+		t.Fatalf("buckets after hours %v", s.buckets)
+	}
+}
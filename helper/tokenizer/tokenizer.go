@@ -0,0 +1,139 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/helper/tokenizer/tokenizer.go
+ */
+package tokenizer
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+const (
+	EncodingCL100K = tiktoken.MODEL_CL100K_BASE
+	EncodingO200K  = tiktoken.MODEL_O200K_BASE
+)
+
+func init() {
+	// 使用编译进程序的词表，无需联网下载
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+}
+
+// 模型信息
+type ModelInfo struct {
+	Encoding      string // BPE 编码
+	ContextWindow int    // 上下文窗口 token 数
+	MaxOutput     int    // 最大输出 token 数
+}
+
+// 模型上下文窗口表，按前缀匹配，越靠前越优先
+var modelTable = []struct {
+	prefix string
+	info   ModelInfo
+}{
+	{"gpt-4.1", ModelInfo{EncodingO200K, 1047576, 32768}},
+	{"gpt-4o-mini", ModelInfo{EncodingO200K, 128000, 16384}},
+	{"gpt-4o", ModelInfo{EncodingO200K, 128000, 16384}},
+	{"o1", ModelInfo{EncodingO200K, 200000, 100000}},
+	{"o3", ModelInfo{EncodingO200K, 200000, 100000}},
+	{"o4", ModelInfo{EncodingO200K, 200000, 100000}},
+	{"gpt-4-turbo", ModelInfo{EncodingCL100K, 128000, 4096}},
+	{"gpt-4-1106", ModelInfo{EncodingCL100K, 128000, 4096}},
+	{"gpt-4-0125", ModelInfo{EncodingCL100K, 128000, 4096}},
+	{"gpt-4-32k", ModelInfo{EncodingCL100K, 32768, 8192}},
+	{"gpt-4", ModelInfo{EncodingCL100K, 8192, 8192}},
+	{"gpt-3.5-turbo-instruct", ModelInfo{EncodingCL100K, 4096, 4096}},
+	{"gpt-3.5-turbo-0301", ModelInfo{EncodingCL100K, 4096, 4096}},
+	{"gpt-3.5-turbo-0613", ModelInfo{EncodingCL100K, 4096, 4096}},
+	{"gpt-3.5-turbo", ModelInfo{EncodingCL100K, 16385, 4096}},
+	{"text-embedding", ModelInfo{EncodingCL100K, 8191, 0}},
+}
+
+// 未指定 max_tokens 时为回复预留的 token 数
+func (info ModelInfo) ReplyReserve() int {
+	reserve := info.ContextWindow / 4
+	if info.MaxOutput > 0 && reserve > info.MaxOutput {
+		reserve = info.MaxOutput
+	}
+	return reserve
+}
+
+// 未知模型使用的默认信息
+var DefaultModelInfo = ModelInfo{EncodingCL100K, 4096, 4096}
+
+// 获取模型信息，未知模型返回默认信息
+func GetModelInfo(model string) ModelInfo {
+	model = strings.ToLower(model)
+	for _, item := range modelTable {
+		if strings.HasPrefix(model, item.prefix) {
+			return item.info
+		}
+	}
+	return DefaultModelInfo
+}
+
+var encoders sync.Map // 编码名 => *tiktoken.Tiktoken
+
+func getEncoder(encoding string) *tiktoken.Tiktoken {
+	if enc, ok := encoders.Load(encoding); ok {
+		return enc.(*tiktoken.Tiktoken)
+	}
+	enc, err := tiktoken.GetEncoding(encoding)
+	if err != nil {
+		return nil
+	}
+	actual, _ := encoders.LoadOrStore(encoding, enc)
+	return actual.(*tiktoken.Tiktoken)
+}
+
+// 计算文本 token 数
+func Count(model string, text string) int {
+	if text == "" {
+		return 0
+	}
+	enc := getEncoder(GetModelInfo(model).Encoding)
+	if enc == nil {
+		// 词表加载失败时按字符数估算
+		return len([]rune(text))
+	}
+	return len(enc.EncodeOrdinary(text))
+}
+
+// 对话消息
+type Message struct {
+	Role    string
+	Name    string
+	Content string
+}
+
+// 每条消息额外消耗的 token 数，参考 OpenAI 官方计算方式
+const (
+	tokensPerMessage = 3
+	tokensPerName    = 1
+	tokensPerReply   = 3
+)
+
+// 回复引导消耗的 token 数
+const ReplyPrimingTokens = tokensPerReply
+
+// 计算单条消息 token 数（含消息格式开销）
+func CountMessage(model string, msg Message) int {
+	count := tokensPerMessage + Count(model, msg.Role) + Count(model, msg.Content)
+	if msg.Name != "" {
+		count += tokensPerName + Count(model, msg.Name)
+	}
+	return count
+}
+
+// 计算请求消息列表 token 数，包含回复引导开销
+func CountMessages(model string, msgs []Message) int {
+	count := tokensPerReply
+	for _, msg := range msgs {
+		count += CountMessage(model, msg)
+	}
+	return count
+}
@@ -0,0 +1,102 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/helper/tokenizer/tokenizer_test.go
+ */
+package tokenizer
+
+import "testing"
+
+func TestGetModelInfo(t *testing.T) {
+	cases := []struct {
+		model string
+		want  ModelInfo
+	}{
+		{"gpt-4o-mini-2024-07-18", ModelInfo{EncodingO200K, 128000, 16384}},
+		{"GPT-4o", ModelInfo{EncodingO200K, 128000, 16384}},
+		{"gpt-4.1-nano", ModelInfo{EncodingO200K, 1047576, 32768}},
+		{"gpt-4-32k-0613", ModelInfo{EncodingCL100K, 32768, 8192}},
+		{"gpt-4", ModelInfo{EncodingCL100K, 8192, 8192}},
+		{"gpt-3.5-turbo-0613", ModelInfo{EncodingCL100K, 4096, 4096}},
+		{"gpt-3.5-turbo", ModelInfo{EncodingCL100K, 16385, 4096}},
+		{"text-embedding-3-small", ModelInfo{EncodingCL100K, 8191, 0}},
+		{"llama3", DefaultModelInfo},
+	}
+	for _, c := range cases {
+		t.Run(c.model, func(t *testing.T) {
+			if got := GetModelInfo(c.model); got != c.want {
+				t.Fatalf("model info %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestReplyReserve(t *testing.T) {
+	cases := []struct {
+		info ModelInfo
+		want int
+	}{
+		{ModelInfo{EncodingCL100K, 8192, 8192}, 2048},
+		{ModelInfo{EncodingO200K, 128000, 16384}, 16384},
+		{ModelInfo{EncodingCL100K, 8191, 0}, 2047},
+	}
+	for _, c := range cases {
+		if got := c.info.ReplyReserve(); got != c.want {
+			t.Fatalf("reserve of %+v is %d, want %d", c.info, got, c.want)
+		}
+	}
+}
+
+func TestCount(t *testing.T) {
+	cases := []struct {
+		model string
+		text  string
+		want  int
+	}{
+		{"gpt-4", "", 0},
+		{"gpt-4", "hello world", 2},
+		{"gpt-4", "tiktoken is great!", 6},
+		{"gpt-4", "你好，世界", 6},
+		{"gpt-4o", "你好，世界", 3},
+	}
+	for _, c := range cases {
+		t.Run(c.model+" "+c.text, func(t *testing.T) {
+			if got := Count(c.model, c.text); got != c.want {
+				t.Fatalf("count %d, want %d", got, c.want)
+			}
+		})
+	}
+}
+
+func TestCountMessages(t *testing.T) {
+	// OpenAI cookbook 中的示例消息及各模型的 prompt_tokens
+	msgs := []Message{
+		{Role: "system", Content: "You are a helpful, pattern-following assistant that translates corporate jargon into plain English."},
+		{Role: "system", Name: "example_user", Content: "New synergies will help drive top-line growth."},
+		{Role: "system", Name: "example_assistant", Content: "Things working well together will increase revenue."},
+		{Role: "system", Name: "example_user", Content: "Let's circle back when we have more bandwidth to touch base on opportunities for increased leverage."},
+		{Role: "system", Name: "example_assistant", Content: "Let's talk later when we're less busy about how to do better."},
+		{Role: "user", Content: "This late pivot means we don't have time to boil the ocean for the client deliverable."},
+	}
+	cases := []struct {
+		model string
+		want  int
+	}{
+		{"gpt-3.5-turbo-0613", 129},
+		{"gpt-4-0613", 129},
+		{"gpt-4o", 124},
+		{"gpt-4o-mini", 124},
+	}
+	for _, c := range cases {
+		t.Run(c.model, func(t *testing.T) {
+			if got := CountMessages(c.model, msgs); got != c.want {
+				t.Fatalf("count %d, want %d", got, c.want)
+			}
+		})
+	}
+
+	// 空消息列表仅包含回复引导
+	if got := CountMessages("gpt-4", nil); got != ReplyPrimingTokens {
+		t.Fatalf("empty messages count %d", got)
+	}
+}
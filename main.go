@@ -6,27 +6,21 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"embed"
-	"html/template"
-	"io"
+	"errors"
+	"fmt"
 	"io/fs"
-	"net/http"
-	"net/http/httputil"
-	"net/url"
 	"os"
-	"strconv"
-	"strings"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"github.com/PuerkitoBio/goquery"
 	"github.com/gin-gonic/gin"
-	"golang.org/x/net/html"
-	"golang.org/x/net/html/atom"
 
 	"gpt-zmide-server/helper"
-	"gpt-zmide-server/helper/logger"
-	_ "gpt-zmide-server/models"
-	"gpt-zmide-server/routers"
+	"gpt-zmide-server/models"
+	"gpt-zmide-server/server"
 )
 
 //go:embed dist/assets
@@ -35,125 +29,64 @@ var FSStatic embed.FS
 //go:embed dist/views
 var FSViews embed.FS
 
-func renderNode(n *html.Node) string {
-	var buf bytes.Buffer
-	w := io.Writer(&buf)
-	html.Render(w, n)
-	return buf.String()
-}
-
-func newScriptDevNode() html.Node {
-	// scriptDev := `
-	// <script type="module">
-	// 	import RefreshRuntime from 'http://localhost:5173/@react-refresh'
-	// 	RefreshRuntime.injectIntoGlobalHook(window)
-	// 	window.$RefreshReg$ = () => {}
-	// 	window.$RefreshSig$ = () => (type) => type
-	// 	window.__vite_plugin_react_preamble_installed__ = true
-	// </script>
-	// `
-	scriptDev := html.Node{
-		Type:     html.ElementNode,
-		Data:     "script",
-		DataAtom: atom.Body,
-		Attr: []html.Attribute{
-			{
-				Key: "type",
-				Val: "module",
-			},
-		},
+// 按配置文件创建服务，skipCheck 为 true 时不检查数据库迁移
+func newApp(skipCheck bool) (*server.App, error) {
+	config, err := helper.ReadConfig("")
+	if err != nil {
+		return nil, errors.New("读取配置文件失败。" + err.Error())
 	}
-	scriptDev.AppendChild(&html.Node{
-		Type: html.TextNode,
-		Data: `
-		import RefreshRuntime from '/@react-refresh'
-		RefreshRuntime.injectIntoGlobalHook(window)
-		window.$RefreshReg$ = () => {}
-		window.$RefreshSig$ = () => (type) => type
-		window.__vite_plugin_react_preamble_installed__ = true
-		`,
+
+	views, _ := fs.Sub(FSViews, "dist/views")
+	assets, _ := fs.Sub(FSStatic, "dist/assets")
+	return server.New(server.Options{
+		Config:    config,
+		Views:     views,
+		Assets:    assets,
+		Dev:       gin.Mode() == gin.DebugMode,
+		SkipCheck: skipCheck,
 	})
-	return scriptDev
 }
 
 func main() {
-	//写入 pid
-	pid := os.Getpid()
-	helper.Config.WritePid(pid)
+	// 执行子命令后退出
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
 
 	// 判断是部署环境
 	if helper.IsRelease() {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
-	logger.InitLogger()
-
-	r := gin.Default()
-
-	// 配置静态文件路由
-	if gin.Mode() == "debug" {
-		// 前端调试模式
-		// 注入前端调试代码
-		var templ = template.New("")
-		templDir, err := template.ParseGlob("./views/*")
-		if err == nil {
-			for _, item := range templDir.Templates() {
-				document, err := goquery.NewDocumentFromReader(strings.NewReader(item.Tree.Root.String()))
-				if err == nil {
-					headStr := document.Find("head")
-					nodeItem := newScriptDevNode()
-					headStr.AddBack().Get(0).AppendChild(&nodeItem)
-				}
-
-				templItem := template.Must(templ.Parse(renderNode(document.AddBack().Get(0))))
-				// templ := template.Must(template.New(templ.Tree.Root.String()).Parse())
-				logger.Debug("解析 html " + item.Name())
-				templ.AddParseTree(item.Name(), templItem.Tree)
-			}
-		}
-		// goquery.NewDocument();
-
-		r.SetHTMLTemplate(templ)
-
-		// r.StaticFS("/assets", http.Dir("./dist/assets"))
-
-		// 反向代理代码目录
-		proxyHandle := func(c *gin.Context) {
-			remote, err := url.Parse("http://localhost:5173")
-			if err != nil {
-				panic(err)
-			}
-			proxy := httputil.NewSingleHostReverseProxy(remote)
-			proxy.ServeHTTP(c.Writer, c.Request)
+	app, err := newApp(false)
+	if err != nil {
+		if errors.Is(err, models.ErrMigrationPending) {
+			fmt.Fprintln(os.Stderr, err.Error()+", please run `gpt-zmide-server migrate up` first")
+		} else {
+			fmt.Fprintln(os.Stderr, err.Error())
 		}
-		// r.Any("/src/:path/*name", proxyHandle)
-		r.Any("/src/*name", proxyHandle)
-		r.Any("/@id/*name", proxyHandle)
-		r.Any("/node_modules/*name", proxyHandle)
-		r.Any("/@vite/*name", proxyHandle)
-		r.Any("/@react-refresh", proxyHandle)
-
-	} else {
-		templ := template.Must(template.New("").ParseFS(FSViews, "dist/views/*"))
-		r.SetHTMLTemplate(templ)
-
-		staticDir, _ := fs.Sub(FSStatic, "dist/assets")
-		r.StaticFS("/assets", http.FS(staticDir))
+		os.Exit(1)
 	}
 
-	// 注册路由
-	r = routers.BuildRouter(r)
-
-	// Listen and Server in 0.0.0.0:8091
-	host := "http://0.0.0.0:8091"
-	if helper.Config.Host != "" {
-		host = "http://" + helper.Config.Host + ":" + strconv.Itoa(helper.Config.Port)
-	}
-
-	serverHost, err := url.Parse(host)
-	if err != nil {
-		serverHost = &url.URL{Host: "0.0.0.0:8091"}
+	//写入 pid
+	app.Config.WritePid(os.Getpid())
+
+	// 收到退出信号后等待处理中的请求完成
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		app.Shutdown(shutdownCtx)
+	}()
+
+	if err := app.Run(); err != nil {
+		app.Logger.Error(err.Error())
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
 	}
-	logger.Info("gpt-zmide-server start up, listening and serving HTTP on " + serverHost.String())
-	r.Run(serverHost.Host)
+	<-done
 }
@@ -17,14 +17,14 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func adminCredential(token string) bool {
+func adminCredential(config *helper.DefaultConfig, token string) bool {
 	if token == "" {
 		return false
 	}
 
 	if decoded, err := base64.StdEncoding.DecodeString(token); err == nil && decoded != nil {
 		if input := strings.Split(string(decoded), ":"); len(input) == 2 {
-			userObj := helper.Config.AdminUser
+			userObj := config.AdminUser
 			user, password := input[0], fmt.Sprintf("%x", md5.Sum([]byte(input[1])))
 			if user == userObj.User && password == userObj.Password {
 				return true
@@ -35,7 +35,7 @@ func adminCredential(token string) bool {
 	return false
 }
 
-func BasicAuthAdmin() gin.HandlerFunc {
+func BasicAuthAdmin(config *helper.DefaultConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Search user in the slice of allowed credentials
 		auth := strings.Replace(c.Request.Header.Get("Authorization"), "Basic ", "", -1)
@@ -43,7 +43,7 @@ func BasicAuthAdmin() gin.HandlerFunc {
 			auth = c.Query("token")
 		}
 
-		if !adminCredential(auth) {
+		if !adminCredential(config, auth) {
 			// Credentials doesn't match, we return 401 and abort handlers chain.
 			apis.APIDefaultController.Fail(c, "请登录管理员账号")
 			c.AbortWithStatus(http.StatusUnauthorized)
@@ -53,10 +53,10 @@ func BasicAuthAdmin() gin.HandlerFunc {
 	}
 }
 
-func InstallMiddleware() gin.HandlerFunc {
+func InstallMiddleware(config *helper.DefaultConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 如果系统已安装，直接禁止访问安装页面
-		if !helper.IsInitialize() {
+		if !config.IsInitialize() {
 			c.AbortWithStatus(http.StatusNotFound)
 			c.Writer.Write([]byte("404 page not found"))
 			return
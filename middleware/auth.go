@@ -20,10 +20,10 @@ import (
 // AuthUserKey is the cookie name for user credential in basic auth.
 const AuthUserKey = "user"
 
-func searchCredential(authValue string) (string, bool) {
+func searchCredential(config *helper.DefaultConfig, authValue string) (string, bool) {
 	if decoded, err := base64.StdEncoding.DecodeString(strings.Replace(authValue, "Basic ", "", -1)); err == nil && decoded != nil {
 		if input := strings.Split(string(decoded), ":"); len(input) == 2 {
-			userObj := helper.Config.AdminUser
+			userObj := config.AdminUser
 			user, password := input[0], fmt.Sprintf("%x", md5.Sum([]byte(input[1])))
 			if user == userObj.User && password == userObj.Password {
 				return userObj.User, true
@@ -33,18 +33,18 @@ func searchCredential(authValue string) (string, bool) {
 	return "", false
 }
 
-func BasicAuth() gin.HandlerFunc {
+func BasicAuth(config *helper.DefaultConfig) gin.HandlerFunc {
 	realm := "Basic realm=" + strconv.Quote("Authorization Required")
 	return func(c *gin.Context) {
 
 		// 判断程序未初始化，跳转安装部署页面
-		if helper.IsInitialize() {
+		if config.IsInitialize() {
 			c.Redirect(http.StatusTemporaryRedirect, "/install")
 			return
 		}
 
 		// Search user in the slice of allowed credentials
-		user, found := searchCredential(c.Request.Header.Get("Authorization"))
+		user, found := searchCredential(config, c.Request.Header.Get("Authorization"))
 		if !found {
 			// Credentials doesn't match, we return 401 and abort handlers chain.
 			c.Header("WWW-Authenticate", realm)
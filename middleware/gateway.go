@@ -0,0 +1,32 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/middleware/gateway.go
+ */
+package middleware
+
+import (
+	"gpt-zmide-server/controllers/apis"
+	"gpt-zmide-server/helper"
+	"gpt-zmide-server/models"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OpenAI 兼容接口认证，仅支持应用 ApiKey，错误按 OpenAI 格式返回
+func BasicAuthGateway(apps models.ApplicationStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(helper.OpenAIFormatKey, true)
+
+		auth := strings.TrimSpace(strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer "))
+		app, err := applicationCredential(apps, auth)
+		if err != nil || app == nil || app.ApiKey != auth {
+			apis.OpenAIError(c, http.StatusUnauthorized, "invalid_request_error", "invalid_api_key", "Incorrect API key provided.")
+			return
+		}
+
+		c.Set(helper.MiddlewareAuthAppKey, app)
+	}
+}
@@ -19,13 +19,13 @@ import (
 	"github.com/wumansgy/goEncrypt/aes"
 )
 
-func applicationCredential(token string) (*models.Application, error) {
+func applicationCredential(apps models.ApplicationStore, token string) (*models.Application, error) {
 	if token == "" {
 		return nil, errors.New("authorization 为空")
 	}
 
-	app := &models.Application{}
-	if err := models.DB.Where("app_key = ?", token).Or("api_key = ?", token).First(app).Error; err != nil {
+	app, err := apps.GetByKey(token)
+	if err != nil {
 		return nil, err
 	}
 
@@ -36,7 +36,7 @@ func applicationCredential(token string) (*models.Application, error) {
 	return nil, errors.New("authorization 异常")
 }
 
-func BasicAuthOpen() gin.HandlerFunc {
+func BasicAuthOpen(apps models.ApplicationStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Search user in the slice of allowed credentials
 		auth := strings.Replace(c.Request.Header.Get("Authorization"), "Bearer ", "", -1)
@@ -44,7 +44,7 @@ func BasicAuthOpen() gin.HandlerFunc {
 			auth = c.Query("token")
 		}
 
-		app, err := applicationCredential(auth)
+		app, err := applicationCredential(apps, auth)
 		if err != nil || app == nil {
 			// Credentials doesn't match, we return 401 and abort handlers chain.
 			apis.APIDefaultController.Fail(c, "应用认证失败。")
@@ -0,0 +1,115 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/middleware/ratelimit.go
+ */
+package middleware
+
+import (
+	"errors"
+	"gpt-zmide-server/controllers/apis"
+	"gpt-zmide-server/helper"
+	"gpt-zmide-server/helper/ratelimit"
+	"gpt-zmide-server/models"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 写入限流响应头
+func setRateLimitHeader(c *gin.Context, name string, result ratelimit.Result) {
+	c.Header("X-RateLimit-Limit-"+name, strconv.FormatInt(result.Limit, 10))
+	c.Header("X-RateLimit-Remaining-"+name, strconv.FormatInt(result.Remaining, 10))
+	c.Header("X-RateLimit-Reset-"+name, result.ResetAfter.Round(time.Millisecond).String())
+}
+
+func rateLimitExceeded(c *gin.Context, err error) {
+	var limitErr *models.RateLimitError
+	retryAfter := time.Second
+	if errors.As(err, &limitErr) {
+		retryAfter = limitErr.RetryAfter
+	}
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	if c.GetBool(helper.OpenAIFormatKey) {
+		apis.OpenAIError(c, http.StatusTooManyRequests, "rate_limit_error", "rate_limit_exceeded", err.Error())
+		return
+	}
+	apis.APIDefaultController.FailStatus(c, http.StatusTooManyRequests, err.Error())
+}
+
+func authApplication(c *gin.Context) *models.Application {
+	app, _ := c.MustGet(helper.MiddlewareAuthAppKey).(*models.Application)
+	return app
+}
+
+// 应用请求限速，需在 BasicAuthOpen 之后使用；WebSocket 连接建立后的每条消息另行计入
+func RateLimitOpen(stores *models.Stores) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		app := authApplication(c)
+		if app == nil {
+			return
+		}
+
+		// 每分钟请求数
+		result, err := stores.TakeRequest(app)
+		if result != nil {
+			setRateLimitHeader(c, "Requests", *result)
+		}
+		if err != nil {
+			rateLimitExceeded(c, err)
+			return
+		}
+
+		// 每分钟 token 数，请求前检查余量，请求完成后按实际用量扣减
+		result, err = stores.CheckTokens(app)
+		if result != nil {
+			setRateLimitHeader(c, "Tokens", *result)
+		}
+		if err != nil {
+			rateLimitExceeded(c, err)
+			return
+		}
+		if app.RateLimitTPM <= 0 {
+			return
+		}
+
+		c.Next()
+		stores.ChargeTokens(app, c.GetInt64(helper.UsageTokensKey))
+	}
+}
+
+// 应用并发流式请求限制，用于流式接口
+func StreamLimitOpen(stores *models.Stores) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		app := authApplication(c)
+		if app == nil || app.MaxConcurrentStreams <= 0 {
+			return
+		}
+
+		ok, current, err := stores.AcquireStream(app)
+		if err != nil {
+			return
+		}
+
+		remaining := app.MaxConcurrentStreams - current
+		if remaining < 0 {
+			remaining = 0
+		}
+		c.Header("X-RateLimit-Limit-Streams", strconv.FormatInt(app.MaxConcurrentStreams, 10))
+		c.Header("X-RateLimit-Remaining-Streams", strconv.FormatInt(remaining, 10))
+		if !ok {
+			rateLimitExceeded(c, &models.RateLimitError{Msg: "并发请求数超出限制，请稍后再试", RetryAfter: time.Second})
+			return
+		}
+
+		defer stores.ReleaseStream(app)
+		c.Next()
+	}
+}
@@ -8,42 +8,127 @@ package models
 import (
 	"errors"
 	"gpt-zmide-server/helper"
+	"strconv"
+	"strings"
 
 	"github.com/google/uuid"
 )
 
 type Application struct {
-	ID               uint   `gorm:"primaryKey" json:"id"`
-	Name             string `gorm:"unique" json:"name"`
-	AppSecret        string `gorm:"unique" json:"app_secret"`
-	AppKey           string `gorm:"unique;index" json:"app_key"`
-	ApiKey           string `gorm:"unique;index" json:"api_key"`
-	Status           uint   `json:"status"`
-	EnableFixLongMsg uint   `json:"enable_fix_long_msg"`
+	ID                uint   `gorm:"primaryKey" json:"id"`
+	Name              string `gorm:"unique" json:"name"`
+	AppSecret         string `gorm:"unique" json:"app_secret"`
+	AppKey            string `gorm:"unique;index" json:"app_key"`
+	ApiKey            string `gorm:"unique;index" json:"api_key"`
+	Status            uint   `json:"status"`
+	ContextStrategy   string `json:"context_strategy"`    // 会话上下文策略，为空使用滑动窗口
+	ContextLastN      int    `json:"context_last_n"`      // last_n 策略保留的消息条数
+	MaxToolIterations int    `json:"max_tool_iterations"` // 服务端工具最大调用轮次，为 0 时使用 5
+	Provider          string `json:"provider"`            // 上游服务提供方，为空使用全局配置
+	SensitiveAction   string `json:"sensitive_action"`    // 敏感词处理方式，为空使用全局配置
+	ApplicationProfile
+	ApplicationLimit
+	ApplicationBudget
 	BaseModel
 }
 
+// 应用限流配置，零值表示不限制
+type ApplicationLimit struct {
+	RateLimitRPM         int64 `json:"rate_limit_rpm"`         // 每分钟请求数
+	RateLimitTPM         int64 `json:"rate_limit_tpm"`         // 每分钟 token 数
+	MaxConcurrentStreams int64 `json:"max_concurrent_streams"` // 最大并发流式请求数
+	MaxImages            int64 `json:"max_images"`             // 单条消息最多图片数，为 0 时使用 4
+	MaxImageSize         int64 `json:"max_image_size"`         // 单张图片最大大小（KB），为 0 时使用 5120
+}
+
+// 未配置时的图片限制
+const (
+	defaultMaxImages    = 4
+	defaultMaxImageSize = 5120
+)
+
+// 校验消息图片数量及大小
+func (limit *ApplicationLimit) CheckImages(images []*helper.ImageInput) error {
+	maxImages, maxSize := limit.MaxImages, limit.MaxImageSize
+	if maxImages <= 0 {
+		maxImages = defaultMaxImages
+	}
+	if maxSize <= 0 {
+		maxSize = defaultMaxImageSize
+	}
+	if int64(len(images)) > maxImages {
+		return errors.New("图片数量超出限制 " + strconv.FormatInt(maxImages, 10))
+	}
+	for _, img := range images {
+		if int64(len(img.Data)) > maxSize*1024 {
+			return errors.New("图片大小超出限制 " + strconv.FormatInt(maxSize, 10) + "KB")
+		}
+	}
+	return nil
+}
+
+// 应用模型配置，零值表示使用全局默认配置
+type ApplicationProfile struct {
+	DefaultModel  string  `json:"default_model"`
+	AllowedModels string  `json:"allowed_models"` // 允许调用的模型，多个以英文逗号分隔，为空不限制
+	Temperature   float64 `json:"temperature"`
+	TopP          float64 `json:"top_p"`
+	MaxTokens     int     `json:"max_tokens"`
+	SystemPrompt  string  `gorm:"type:text" json:"system_prompt"`
+}
+
+// 允许调用的模型列表
+func (profile *ApplicationProfile) AllowedModelList() []string {
+	list := []string{}
+	for _, item := range strings.Split(profile.AllowedModels, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// 获取应用实际使用的模型，未指定时使用应用默认模型及全局模型
+func (s *Stores) ResolveModel(app *Application, model string) (string, error) {
+	if model == "" {
+		model = app.DefaultModel
+	}
+	if model == "" && s.Config != nil {
+		model = s.Config.OpenAI.Model
+	}
+
+	allowed := app.AllowedModelList()
+	if len(allowed) < 1 {
+		return model, nil
+	}
+	for _, item := range allowed {
+		if item == model {
+			return model, nil
+		}
+	}
+	return "", errors.New("应用不允许调用模型 " + model)
+}
+
 // 创建应用
-func CreateApplication(name string) (app *Application, err error) {
+func CreateApplication(store ApplicationStore, name string) (app *Application, err error) {
 	if name == "" {
 		return nil, errors.New("应用名不得为空")
 	}
+
+	if _, err = store.GetByName(name); err == nil {
+		return nil, errors.New("应用已经存在，请更换应用名")
+	}
 	app = &Application{
 		Name: name,
 	}
 
-	if err = DB.Where(app).First(app).Error; err == nil {
-		app, err = nil, errors.New("应用已经存在，请更换应用名")
-		return
-	}
-
 	key := helper.RandomStr(32)
 	app.AppSecret = uuid.NewString()
 	app.AppKey = key
 	app.ApiKey = "sk-" + helper.RandomStr(48)
 	app.Status = 1
 
-	if err = DB.Create(app).Error; err != nil {
+	if err = store.Create(app); err != nil {
 		app = nil
 		return
 	}
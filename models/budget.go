@@ -0,0 +1,206 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/models/budget.go
+ */
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+var ErrBudgetExceeded = errors.New("应用预算已用尽")
+
+// 预算统计周期，按自然日、自然月重置
+const (
+	BudgetPeriodDaily   = "daily"
+	BudgetPeriodMonthly = "monthly"
+)
+
+// 预算告警类型
+const (
+	BudgetAlertSoft = "soft" // 用量达到告警比例
+	BudgetAlertHard = "hard" // 用量达到预算，后续请求被拒绝
+)
+
+// 未配置时的预算告警比例
+const defaultBudgetAlertPercent = 80
+
+// 应用预算配置，零值表示不限制；费用按模型价格表计算，费用预算的币种为 DefaultCurrency
+type ApplicationBudget struct {
+	DailyTokenBudget   int64   `json:"daily_token_budget"`
+	MonthlyTokenBudget int64   `json:"monthly_token_budget"`
+	DailyCostBudget    float64 `json:"daily_cost_budget"`
+	MonthlyCostBudget  float64 `json:"monthly_cost_budget"`
+	BudgetAlertPercent int     `json:"budget_alert_percent"` // 软限制，用量达到预算的百分比时告警，为 0 时使用 80
+}
+
+// 应用周期用量
+type ApplicationUsage struct {
+	ID          uint    `gorm:"primaryKey" json:"id"`
+	AppID       uint    `gorm:"uniqueIndex:idx_app_usage_period" json:"app_id"`
+	Period      string  `gorm:"size:16;uniqueIndex:idx_app_usage_period" json:"period"`
+	PeriodKey   string  `gorm:"size:16;uniqueIndex:idx_app_usage_period" json:"period_key"` // 2006-01-02 或 2006-01
+	Tokens      int64   `json:"tokens"`
+	Cost        float64 `json:"cost"`
+	SoftAlerted bool    `json:"soft_alerted"`
+	HardAlerted bool    `json:"hard_alerted"`
+	BaseModel
+}
+
+// 预算告警事件
+type BudgetAlert struct {
+	ID        uint    `gorm:"primaryKey" json:"id"`
+	AppID     uint    `gorm:"index" json:"app_id"`
+	Period    string  `json:"period"`
+	PeriodKey string  `json:"period_key"`
+	Kind      string  `json:"kind"`
+	Metric    string  `json:"metric"` // tokens 或 cost
+	Usage     float64 `json:"usage"`
+	Budget    float64 `json:"budget"`
+	BaseModel
+}
+
+func budgetPeriodKey(period string, now time.Time) string {
+	if period == BudgetPeriodMonthly {
+		return now.Format("2006-01")
+	}
+	return now.Format("2006-01-02")
+}
+
+// 周期对应的 token 及费用预算
+func (budget *ApplicationBudget) limits(period string) (tokens int64, cost float64) {
+	if period == BudgetPeriodMonthly {
+		return budget.MonthlyTokenBudget, budget.MonthlyCostBudget
+	}
+	return budget.DailyTokenBudget, budget.DailyCostBudget
+}
+
+func (budget *ApplicationBudget) alertPercent() int {
+	if budget.BudgetAlertPercent <= 0 || budget.BudgetAlertPercent > 100 {
+		return defaultBudgetAlertPercent
+	}
+	return budget.BudgetAlertPercent
+}
+
+// 是否配置了预算
+func (budget *ApplicationBudget) HasBudget() bool {
+	return budget.DailyTokenBudget > 0 || budget.MonthlyTokenBudget > 0 ||
+		budget.DailyCostBudget > 0 || budget.MonthlyCostBudget > 0
+}
+
+// 获取应用当前周期用量，不存在时返回零值
+func (s *Stores) PeriodUsage(app *Application, period string, now time.Time) (*ApplicationUsage, error) {
+	return s.Budgets.GetUsage(app.ID, period, budgetPeriodKey(period, now))
+}
+
+// 检查预算，达到硬限制时返回 ErrBudgetExceeded
+func (s *Stores) CheckBudget(app *Application) error {
+	if app == nil || !app.HasBudget() {
+		return nil
+	}
+	now := time.Now()
+	for _, period := range []string{BudgetPeriodDaily, BudgetPeriodMonthly} {
+		tokenBudget, costBudget := app.limits(period)
+		if tokenBudget <= 0 && costBudget <= 0 {
+			continue
+		}
+		usage, err := s.PeriodUsage(app, period, now)
+		if err != nil {
+			// 查询失败时不阻断请求
+			s.Log().Error("check budget error " + err.Error())
+			return nil
+		}
+		if tokenBudget > 0 && usage.Tokens >= tokenBudget {
+			return fmt.Errorf("%w（%s token %d/%d）", ErrBudgetExceeded, period, usage.Tokens, tokenBudget)
+		}
+		if costBudget > 0 && usage.Cost >= costBudget {
+			return fmt.Errorf("%w（%s cost %g/%g）", ErrBudgetExceeded, period, usage.Cost, costBudget)
+		}
+	}
+	return nil
+}
+
+// 累加应用用量并检查是否需要告警，currency 为费用币种
+func (s *Stores) RecordUsage(app *Application, tokens int64, cost float64, currency string) {
+	if app == nil || app.ID == 0 {
+		return
+	}
+	// 费用预算按 DefaultCurrency 统计，其他币种的费用无法换算，仅累加 token
+	if cost > 0 && currency != DefaultCurrency {
+		if app.DailyCostBudget > 0 || app.MonthlyCostBudget > 0 {
+			s.Log().Warn("app#" + strconv.Itoa(int(app.ID)) + " cost in " + currency + " is not counted in the " + DefaultCurrency + " cost budget")
+		}
+		cost = 0
+	}
+	if tokens <= 0 && cost <= 0 {
+		return
+	}
+	now := time.Now()
+	for _, period := range []string{BudgetPeriodDaily, BudgetPeriodMonthly} {
+		usage, err := s.Budgets.AddUsage(app.ID, period, budgetPeriodKey(period, now), tokens, cost)
+		if err != nil {
+			s.Log().Error("record app usage error " + err.Error())
+			continue
+		}
+		s.checkBudgetAlert(app, usage)
+	}
+}
+
+// 用量达到软、硬限制时各告警一次
+func (s *Stores) checkBudgetAlert(app *Application, usage *ApplicationUsage) {
+	tokenBudget, costBudget := app.limits(usage.Period)
+	percent := float64(app.alertPercent()) / 100
+
+	kind, metric, value, budget := "", "", float64(0), float64(0)
+	switch {
+	case tokenBudget > 0 && usage.Tokens >= tokenBudget:
+		kind, metric, value, budget = BudgetAlertHard, "tokens", float64(usage.Tokens), float64(tokenBudget)
+	case costBudget > 0 && usage.Cost >= costBudget:
+		kind, metric, value, budget = BudgetAlertHard, "cost", usage.Cost, costBudget
+	case tokenBudget > 0 && float64(usage.Tokens) >= float64(tokenBudget)*percent:
+		kind, metric, value, budget = BudgetAlertSoft, "tokens", float64(usage.Tokens), float64(tokenBudget)
+	case costBudget > 0 && usage.Cost >= costBudget*percent:
+		kind, metric, value, budget = BudgetAlertSoft, "cost", usage.Cost, costBudget
+	default:
+		return
+	}
+
+	// 并发时只告警一次，硬限制告警同时视为已发送软限制告警
+	if marked, err := s.Budgets.MarkAlerted(usage.ID, kind); err != nil || !marked {
+		return
+	}
+
+	alert := &BudgetAlert{
+		AppID:     app.ID,
+		Period:    usage.Period,
+		PeriodKey: usage.PeriodKey,
+		Kind:      kind,
+		Metric:    metric,
+		Usage:     value,
+		Budget:    budget,
+	}
+	if err := s.Budgets.CreateAlert(alert); err != nil {
+		s.Log().Error("budget alert create error " + err.Error())
+	}
+	s.Log().Warn("app#" + strconv.Itoa(int(app.ID)) + " budget " + kind + " alert, " + usage.Period + " " + metric +
+		" " + strconv.FormatFloat(value, 'f', -1, 64) + "/" + strconv.FormatFloat(budget, 'f', -1, 64))
+
+	if s.OnBudgetAlert != nil {
+		s.OnBudgetAlert(alert)
+	}
+}
+
+// 清除应用当前周期用量，用于手动重置预算
+func (s *Stores) ResetBudget(app *Application) error {
+	now := time.Now()
+	for _, period := range []string{BudgetPeriodDaily, BudgetPeriodMonthly} {
+		if err := s.Budgets.DeleteUsage(app.ID, period, budgetPeriodKey(period, now)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -6,9 +6,11 @@
 package models
 
 import (
+	"context"
 	"errors"
 	"gpt-zmide-server/helper"
-	"gpt-zmide-server/helper/logger"
+	"gpt-zmide-server/helper/filter"
+	"time"
 )
 
 type Chat struct {
@@ -19,6 +21,13 @@ type Chat struct {
 	Application *Application  `gorm:"foreignKey:AppID" json:"app"`
 	Model       string        `json:"model"`
 	MessageChan chan *Message `gorm:"-" json:"-"`
+	// 本次请求可用的工具，不持久化
+	Tools      []*helper.Tool `gorm:"-" json:"-"`
+	ToolChoice interface{}    `gorm:"-" json:"-"`
+	// 请求上下文，客户端断开时取消上游请求
+	Context context.Context `gorm:"-" json:"-"`
+	// 会话使用的存储，为空时使用数据库
+	Store *Stores `gorm:"-" json:"-"`
 	BaseModel
 }
 
@@ -34,94 +43,301 @@ type Chat struct {
 func (chat *Chat) QueryChatGPT(stream bool) (msg *Message, err error) {
 
 	model := chat.Model
-	secret_key := helper.Config.OpenAI.SecretKey
-	if model == "" || secret_key == "" {
-		return nil, errors.New("OpenAI model 未设置或 secret_key 未设置")
+	if model == "" {
+		return nil, errors.New("OpenAI model 未设置")
 	}
 
 	if len(chat.Messages) < 1 {
 		return nil, errors.New("chat messages 处理异常")
 	}
 
-	// 处理会话数据
-	var msgsTmp = []*helper.ChatMessage{}
-	msgCount := 0
-	// 倒序遍历消息记录
-	for i := len(chat.Messages) - 1; i >= 0; i-- {
-		item := chat.Messages[i]
-		contextCount := msgCount + len(item.Content)
-		// 避免消息上下文超过 4600 字数限制
-		if contextCount > 4500 {
-			// 判断应用是否需要修复长消息
-			DB.Preload("Application").Find(chat)
-			if chat.Application != nil && chat.Application.EnableFixLongMsg != 1 {
-				continue
-			} else {
-				return nil, errors.New("消息上下文超过 4600 字数限制")
-			}
+	// 加载会话所属应用配置
+	if chat.Application == nil && chat.AppID != 0 {
+		if app, err := chat.Store.Apps.Get(chat.AppID); err == nil {
+			chat.Application = app
 		}
-		msgCount = contextCount
-		msgsTmp = append(msgsTmp, &helper.ChatMessage{
-			Role:    item.Role,
-			Content: item.Content,
-		})
+	}
+	app := chat.Application
+
+	// 调用方可预先创建 MessageChan 后再开始读取，结束时关闭
+	if stream {
+		if chat.MessageChan == nil {
+			chat.MessageChan = make(chan *Message)
+		}
+		defer close(chat.MessageChan)
+	}
+
+	// 加载应用可用的服务端工具，与请求传入的工具同名时以请求为准
+	var serverTools map[string]*Tool
+	if app != nil {
+		if serverTools, err = chat.Store.AppTools(app.ID); err != nil {
+			chat.Store.Log().Error("load tools error " + err.Error())
+		}
+		for _, item := range chat.Tools {
+			delete(serverTools, item.Function.Name)
+		}
+	}
+
+	// 模型调用服务端工具时执行工具并将结果提交给模型，直到返回最终回复或达到最大轮次
+	maxIterations := app.toolMaxIterations()
+	for i := 0; ; i++ {
+		msg, err = chat.query(stream, app, serverTools, i >= maxIterations)
+		if err != nil || len(msg.ToolCalls) < 1 || len(serverTools) < 1 || i >= maxIterations {
+			return msg, err
+		}
+		if !chat.callServerTools(app, msg, serverTools) {
+			// 存在需由客户端执行的工具
+			return msg, nil
+		}
+		if chat.Context != nil && chat.Context.Err() != nil {
+			return msg, chat.Context.Err()
+		}
+	}
+}
+
+// 执行服务端工具调用，每次调用结果记录为 tool 消息；存在非服务端工具时返回 false
+func (chat *Chat) callServerTools(app *Application, msg *Message, tools map[string]*Tool) bool {
+	chat.Messages = append(chat.Messages, msg)
+	chat.pushStep(msg)
+
+	handled := true
+	for _, call := range msg.ToolCalls {
+		tool, ok := tools[call.Function.Name]
+		if !ok {
+			handled = false
+			continue
+		}
+
+		startAt := time.Now()
+		content, err := tool.Call(chat.Context, app.ID, chat.ID, call)
+		if err != nil {
+			chat.Store.Log().Warn("tool " + tool.Name + " call error " + err.Error())
+			content = "工具调用失败：" + err.Error()
+		}
+		result := &Message{
+			ChatID:     chat.ID,
+			Role:       "tool",
+			Name:       tool.Name,
+			ToolCallID: call.ID,
+			Content:    content,
+			LatencyMs:  time.Since(startAt).Milliseconds(),
+		}
+		if err = chat.Store.Messages.Create(result); err != nil {
+			chat.Store.Log().Error("message create error " + err.Error())
+		}
+		chat.Messages = append(chat.Messages, result)
+		chat.pushStep(result)
+	}
+	return handled
+}
+
+// 流式请求时推送工具调用步骤，回复内容已按分片推送，工具结果仅记录在会话中，均不重复推送内容
+func (chat *Chat) pushStep(msg *Message) {
+	if chat.MessageChan == nil {
+		return
+	}
+	chat.MessageChan <- &Message{
+		ID:         msg.ID,
+		ChatID:     msg.ChatID,
+		Role:       msg.Role,
+		Name:       msg.Name,
+		ToolCalls:  msg.ToolCalls,
+		ToolCallID: msg.ToolCallID,
+	}
+}
+
+// 请求一次上游，final 为 true 时不再允许调用服务端工具
+func (chat *Chat) query(stream bool, app *Application, serverTools map[string]*Tool, final bool) (msg *Message, err error) {
+	model := chat.Model
+	store := chat.Store
+
+	// 预算用尽时不再请求上游
+	if err := store.CheckBudget(app); err != nil {
+		return nil, err
+	}
+
+	// 应用配置的系统提示词
+	var systemMsg *helper.ChatMessage
+	if app != nil && app.SystemPrompt != "" {
+		systemMsg = &helper.ChatMessage{
+			Role:    "system",
+			Content: app.SystemPrompt,
+		}
+	}
+
+	// 计算上下文可用 token 数，为回复预留 max_tokens
+	modelInfo := store.Config.GetModelInfo(model)
+	maxTokens := 0
+	if app != nil {
+		maxTokens = app.MaxTokens
+	}
+	if modelInfo.MaxOutput > 0 && maxTokens > modelInfo.MaxOutput {
+		maxTokens = modelInfo.MaxOutput
+	}
+	reserve := maxTokens
+	if reserve == 0 {
+		reserve = modelInfo.ReplyReserve()
+	}
+	tools := chat.Tools
+	for _, item := range serverTools {
+		tools = append(tools, item.Definition())
+	}
+	tokenLimit := int64(modelInfo.ContextWindow-reserve) - helper.CountToolsTokens(model, tools)
+
+	// 按应用上下文策略处理会话数据
+	msgs, tokenCount, err := chat.buildContext(model, app, systemMsg, tokenLimit)
+	if err != nil {
+		return nil, err
 	}
 
-	// 修正消息顺序
-	var msgs = []*helper.ChatMessage{}
-	for i := len(msgsTmp) - 1; i >= 0; i-- {
-		msgs = append(msgs, msgsTmp[i])
+	// 回复命中敏感词拒绝时中断上游请求，不再为无法返回的内容计费
+	ctx := chat.Context
+	if ctx == nil {
+		ctx = context.Background()
 	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
 	chatReq := helper.ChatRequest{
-		Model:    model,
-		Messages: msgs,
-		User:     helper.Config.SiteName,
+		Model:      model,
+		Messages:   msgs,
+		User:       store.Config.SiteName,
+		Tools:      tools,
+		ToolChoice: chat.ToolChoice,
+		Context:    ctx,
+	}
+	if final && len(serverTools) > 0 {
+		// 达到最大轮次时要求模型直接回复
+		chatReq.ToolChoice = "none"
+	}
+
+	// 使用应用配置的上游服务提供方及模型参数
+	if app != nil {
+		chatReq.Provider = app.Provider
+		chatReq.Temperature = app.Temperature
+		chatReq.TopP = app.TopP
+		chatReq.MaxTokens = maxTokens
 	}
 
 	var res *helper.OpenAIResponse
 
+	// 回复内容敏感词过滤
+	var sensitive *filter.Stream
+	action := filter.ActionLog
+	if app != nil {
+		if m := store.SensitiveMatcher(app.ID); !m.Empty() {
+			action = store.SensitiveAction(app)
+			sensitive = m.NewStream(action == filter.ActionMask)
+		}
+	}
+	rejected := false
+
+	startAt := time.Now()
+	var firstTokenAt time.Time
+
 	if !stream {
 		// 请求 openAi
-		res, err = helper.ChatGptAsk(chatReq)
+		res, err = store.Config.ChatGptAsk(chatReq)
 	} else {
-		chat.MessageChan = make(chan *Message)
 		// 以 stream 模式进行请求
-		res, err = helper.ChatGptAsk(chatReq, func(line *helper.OpenAIResponseStream) {
+		res, err = store.Config.ChatGptAsk(chatReq, func(line *helper.OpenAIResponseStream) {
+			if firstTokenAt.IsZero() {
+				firstTokenAt = time.Now()
+			}
+			if rejected {
+				return
+			}
+
+			content := line.Choices[0].Delta.Content
+			if sensitive != nil {
+				var matches []filter.Match
+				content, matches = sensitive.Write(content)
+				if len(matches) > 0 {
+					store.LogSensitive(app, "assistant", action, matches)
+					// 命中后不再推送后续内容
+					if action == filter.ActionReject {
+						rejected = true
+						cancel()
+						return
+					}
+				}
+				if content == "" && line.Choices[0].Delta.Role == "" {
+					return
+				}
+			}
+
 			message := &Message{
 				ID:      0,
 				ChatID:  chat.ID,
 				Role:    line.Choices[0].Delta.Role,
-				Content: line.Choices[0].Delta.Content,
+				Content: content,
 			}
 			// 将消息推送到MessageChannel中
 			chat.MessageChan <- message
 		})
 
-		close(chat.MessageChan)
+		// 推送过滤器中暂存的剩余内容
+		if sensitive != nil && !rejected {
+			if content := sensitive.Flush(); content != "" {
+				chat.MessageChan <- &Message{ChatID: chat.ID, Content: content}
+			}
+		}
 	}
 
-	if err != nil {
+	// 拒绝后主动中断的请求不视为客户端断开，按已接收的回复计入用量
+	if rejected {
+		if (err != nil && !errors.Is(err, context.Canceled)) || res == nil || len(res.Choices) < 1 {
+			return nil, ErrSensitiveContent
+		}
+		err = nil
+	}
+
+	// 客户端断开时保存已生成的部分回复，并返回取消错误
+	cancelErr := err
+	if err != nil && (!errors.Is(err, context.Canceled) || res == nil || len(res.Choices) < 1) {
 		return nil, err
 	}
 
-	if len(res.Choices) < 1 {
-		logger.Warn("OpenAI CallBack Data unusual " + res.Raw)
+	// 第三方提供方可能返回空响应
+	if res == nil {
+		chat.Store.Log().Warn("OpenAI CallBack Data unusual, empty response")
+		return nil, errors.New("openai api callback choices data error")
+	}
+	if len(res.Choices) < 1 || res.Choices[0].Message == nil {
+		chat.Store.Log().Warn("OpenAI CallBack Data unusual " + res.Raw)
 		return nil, errors.New("openai api callback choices data error")
 	}
 
 	choiceFirst := res.Choices[0]
 	msg = &Message{
-		ChatID:  chat.ID,
-		Raw:     res.Raw,
-		Role:    choiceFirst.Message.Role,
-		Content: choiceFirst.Message.Content,
+		ChatID:    chat.ID,
+		Raw:       res.Raw,
+		Role:      choiceFirst.Message.Role,
+		Content:   choiceFirst.Message.Content,
+		ToolCalls: choiceFirst.Message.ToolCalls,
+	}
+	// 需在敏感词处理前按原始回复计算用量
+	msg.SetUsage(res, model, tokenCount, startAt, firstTokenAt)
+	store.CalcCost(msg, time.Now(), msg.Model, model)
+
+	// 回复被敏感词拦截时上游同样已产生用量，先计入预算
+	store.RecordUsage(app, msg.TotalTokens, msg.Cost, msg.Currency)
+
+	if rejected {
+		return nil, ErrSensitiveContent
+	}
+	if !stream && app != nil {
+		if msg.Content, err = store.FilterContent(app, msg.Content, "assistant"); err != nil {
+			return nil, err
+		}
+	} else if sensitive != nil && action == filter.ActionMask {
+		msg.Content, _ = sensitive.Matcher().Mask(msg.Content)
 	}
 
-	if err = DB.Create(msg).Error; err != nil {
+	if err = store.Messages.Create(msg); err != nil {
 		// fmt.Println("message create error " + err.Error())
-		logger.Error("message create error " + err.Error())
+		chat.Store.Log().Error("message create error " + err.Error())
 	}
 
-	return msg, nil
+	return msg, cancelErr
 }
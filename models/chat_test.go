@@ -0,0 +1,131 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/models/chat_test.go
+ */
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gpt-zmide-server/helper"
+)
+
+const testMockConfig = `
+site_name: test
+provider: mock
+openai:
+    model: gpt-4o-mini
+    base_url: mock://
+`
+
+// 使用内置模拟上游的内存存储及应用
+func newMockStores(t *testing.T) (*Stores, *Application) {
+	t.Helper()
+	config, err := helper.LoadConfig(testMockConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewMemoryStores()
+	s.Config = config
+	app, err := CreateApplication(s.Apps, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, app
+}
+
+// 创建包含 messages 的会话
+func newTestChat(t *testing.T, s *Stores, app *Application, messages ...*Message) *Chat {
+	t.Helper()
+	chat := &Chat{AppID: app.ID, Model: "gpt-4o-mini", Store: s}
+	if err := s.Chats.Create(chat); err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range messages {
+		msg.ChatID = chat.ID
+		if err := s.Messages.Create(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	chat.Messages = messages
+	return chat
+}
+
+// 回复命中拒绝的敏感词后中断上游，不等待生成结束
+func TestQueryRejectCancelsUpstream(t *testing.T) {
+	s, app := newMockStores(t)
+	if _, err := CreateSensitiveWords(s, app.ID, []string{"forbidden"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟上游回显用户消息，每个分片间隔 50 毫秒，完整回复约需 2 秒
+	prompt := "[mock:latency=50] forbidden" + strings.Repeat(" word", 40)
+	chat := newTestChat(t, s, app, &Message{Role: "user", Content: prompt})
+	chat.MessageChan = make(chan *Message)
+	go func() {
+		for msg := range chat.MessageChan {
+			if strings.Contains(msg.Content, "forbidden") {
+				t.Errorf("sensitive content pushed %q", msg.Content)
+			}
+		}
+	}()
+
+	startAt := time.Now()
+	msg, err := chat.QueryChatGPT(true)
+	if !errors.Is(err, ErrSensitiveContent) || msg != nil {
+		t.Fatalf("query msg %+v err %v", msg, err)
+	}
+	if elapsed := time.Since(startAt); elapsed > time.Second {
+		t.Fatalf("query took %v after reject", elapsed)
+	}
+
+	// 已接收部分的用量计入预算
+	usage, err := s.PeriodUsage(app, BudgetPeriodDaily, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Tokens <= 0 {
+		t.Fatalf("usage %+v", usage)
+	}
+}
+
+// 返回空响应的第三方提供方
+type nilProvider struct{}
+
+func (nilProvider) Name() string { return "nil-test" }
+func (nilProvider) Chat(helper.ChatRequest) (*helper.OpenAIResponse, error) {
+	return nil, nil
+}
+func (nilProvider) ChatStream(helper.ChatRequest, func(*helper.OpenAIResponseStream)) (*helper.OpenAIResponse, error) {
+	return nil, nil
+}
+func (nilProvider) ListModels() ([]*helper.ProviderModel, error) { return nil, nil }
+func (nilProvider) Ping() (bool, string)                         { return true, "" }
+
+func TestQueryNilProviderResponse(t *testing.T) {
+	helper.RegisterProvider("nil-test", func(*helper.DefaultConfig) (helper.Provider, error) {
+		return nilProvider{}, nil
+	})
+	s, app := newMockStores(t)
+	app.Provider = "nil-test"
+
+	for _, stream := range []bool{false, true} {
+		chat := newTestChat(t, s, app, &Message{Role: "user", Content: "hello"})
+		chat.Application = app
+		if stream {
+			chat.MessageChan = make(chan *Message)
+			go func() {
+				for range chat.MessageChan {
+				}
+			}()
+		}
+		msg, err := chat.QueryChatGPT(stream)
+		if err == nil || err.Error() != "openai api callback choices data error" || msg != nil {
+			t.Fatalf("stream %v msg %+v err %v", stream, msg, err)
+		}
+	}
+}
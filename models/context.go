@@ -0,0 +1,273 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/models/context.go
+ */
+package models
+
+import (
+	"errors"
+	"gpt-zmide-server/helper"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 会话上下文策略
+const (
+	ContextStrategySlidingWindow = "sliding_window" // 按 token 保留最新的消息
+	ContextStrategyLastN         = "last_n"         // 保留系统提示词及最近 N 条消息
+	ContextStrategySummary       = "summary"        // 将较早的消息总结为摘要
+	ContextStrategyReject        = "reject"         // 不丢弃消息，超出上下文时返回错误
+)
+
+// 摘要请求使用的提示词
+const summaryPrompt = "请将以下对话内容总结为简洁的摘要，保留用户的关键信息、诉求以及已经给出的结论，摘要将作为后续对话的上下文。"
+
+// 摘要在请求上下文中的前缀
+const summaryContextPrefix = "以下是之前对话的摘要：\n"
+
+func IsContextStrategy(strategy string) bool {
+	return strategy == ContextStrategySlidingWindow ||
+		strategy == ContextStrategyLastN ||
+		strategy == ContextStrategySummary ||
+		strategy == ContextStrategyReject
+}
+
+// 应用上下文策略，未配置时使用滑动窗口
+func (app *Application) GetContextStrategy() string {
+	if IsContextStrategy(app.ContextStrategy) {
+		return app.ContextStrategy
+	}
+	return ContextStrategySlidingWindow
+}
+
+func (chat *Chat) toChatMessage(item *Message) *helper.ChatMessage {
+	msg := &helper.ChatMessage{
+		Role:       item.Role,
+		Content:    item.Content,
+		Name:       item.Name,
+		ToolCalls:  item.ToolCalls,
+		ToolCallID: item.ToolCallID,
+	}
+
+	// 带图片的消息按内容片段请求，图片读取失败时忽略
+	if len(item.Images) > 0 {
+		if item.Content != "" {
+			msg.Parts = append(msg.Parts, &helper.ContentPart{Type: "text", Text: item.Content})
+		}
+		for _, ref := range item.Images {
+			url, err := helper.ImageDataURL(chat.Store.Config.GetUploadPath(), ref)
+			if err != nil {
+				chat.Store.Log().Warn("load message image error " + err.Error())
+				continue
+			}
+			msg.Parts = append(msg.Parts, &helper.ContentPart{Type: "image_url", ImageURL: &helper.ImageURL{URL: url}})
+		}
+	}
+	return msg
+}
+
+func summaryChatMessage(summary *Message) *helper.ChatMessage {
+	return &helper.ChatMessage{
+		Role:    "system",
+		Content: summaryContextPrefix + summary.Content,
+	}
+}
+
+// 按应用上下文策略构造请求消息，tokenLimit 为上下文可用 token 数
+func (chat *Chat) buildContext(model string, app *Application, systemMsg *helper.ChatMessage, tokenLimit int64) (msgs []*helper.ChatMessage, tokenCount int64, err error) {
+	strategy := ContextStrategySlidingWindow
+	if app != nil {
+		strategy = app.GetContextStrategy()
+	}
+
+	// 区分摘要与普通消息
+	var summary *Message
+	history := []*Message{}
+	for _, item := range chat.Messages {
+		if item.IsSummary {
+			if summary == nil || item.ID > summary.ID {
+				summary = item
+			}
+			continue
+		}
+		history = append(history, item)
+	}
+
+	if strategy == ContextStrategySummary && summary != nil {
+		// 仅保留最新摘要之后的消息
+		list := []*Message{}
+		for _, item := range history {
+			if item.ID > summary.SummaryUntil {
+				list = append(list, item)
+			}
+		}
+		history = list
+	} else {
+		summary = nil
+	}
+
+	if strategy == ContextStrategyLastN && app.ContextLastN > 0 && len(history) > app.ContextLastN {
+		history = history[len(history)-app.ContextLastN:]
+	}
+
+	baseCount := func() int64 {
+		count := helper.CountChatTokens(model, nil)
+		if systemMsg != nil {
+			count += helper.CountMessageTokens(model, systemMsg)
+		}
+		if summary != nil {
+			count += helper.CountMessageTokens(model, summaryChatMessage(summary))
+		}
+		return count
+	}
+
+	// 超出上下文时将较早的消息总结为摘要
+	if strategy == ContextStrategySummary {
+		total := baseCount()
+		for _, item := range history {
+			total += helper.CountMessageTokens(model, chat.toChatMessage(item))
+		}
+		if total > tokenLimit {
+			newSummary, rest, err := chat.summarize(model, app, summary, history, tokenLimit)
+			if err != nil {
+				chat.Store.Log().Warn("chat#" + strconv.Itoa(int(chat.ID)) + " summarize failed, fallback to sliding window. " + err.Error())
+			} else {
+				summary, history = newSummary, rest
+			}
+		}
+	}
+
+	// 倒序遍历消息记录，按 token 保留最新的消息
+	tokenCount = baseCount()
+	var msgsTmp = []*helper.ChatMessage{}
+	for i := len(history) - 1; i >= 0; i-- {
+		item := chat.toChatMessage(history[i])
+		contextCount := tokenCount + helper.CountMessageTokens(model, item)
+		if contextCount > tokenLimit {
+			if strategy == ContextStrategyReject {
+				return nil, 0, errors.New("消息上下文超过模型 token 限制")
+			}
+			break
+		}
+		tokenCount = contextCount
+		msgsTmp = append(msgsTmp, item)
+	}
+
+	// 工具结果需紧跟发起调用的 assistant 消息，丢弃被截断的工具结果
+	for len(msgsTmp) > 0 && msgsTmp[len(msgsTmp)-1].Role == "tool" {
+		tokenCount -= helper.CountMessageTokens(model, msgsTmp[len(msgsTmp)-1])
+		msgsTmp = msgsTmp[:len(msgsTmp)-1]
+	}
+
+	if len(msgsTmp) < 1 {
+		return nil, 0, errors.New("消息内容超过模型 token 限制")
+	}
+
+	// 修正消息顺序
+	if systemMsg != nil {
+		msgs = append(msgs, systemMsg)
+	}
+	if summary != nil {
+		msgs = append(msgs, summaryChatMessage(summary))
+	}
+	for i := len(msgsTmp) - 1; i >= 0; i-- {
+		msgs = append(msgs, msgsTmp[i])
+	}
+	return msgs, tokenCount, nil
+}
+
+// 将较早的消息（连同上一次摘要）总结为新的摘要并保存，返回新摘要及剩余消息
+func (chat *Chat) summarize(model string, app *Application, summary *Message, history []*Message, tokenLimit int64) (*Message, []*Message, error) {
+	// 保留最近约一半上下文的消息，避免每轮对话都触发摘要
+	keepBudget := tokenLimit / 2
+	split := len(history)
+	var keepCount int64
+	for i := len(history) - 1; i >= 0; i-- {
+		keepCount += helper.CountMessageTokens(model, chat.toChatMessage(history[i]))
+		if keepCount > keepBudget && i < len(history)-1 {
+			break
+		}
+		split = i
+	}
+	if split < 1 {
+		return nil, nil, errors.New("no message to summarize")
+	}
+	older := history[:split]
+
+	// 组装对话记录，超出上下文时丢弃最早的内容
+	lines := []string{}
+	for _, item := range older {
+		line := item.Role + ": " + item.Content
+		if len(item.Images) > 0 {
+			line += strings.Repeat(" [图片]", len(item.Images))
+		}
+		for _, call := range item.ToolCalls {
+			line += " [" + call.Function.Name + "(" + call.Function.Arguments + ")]"
+		}
+		lines = append(lines, line)
+	}
+	promptMsg := &helper.ChatMessage{Role: "system", Content: summaryPrompt}
+	budget := tokenLimit - helper.CountChatTokens(model, []*helper.ChatMessage{promptMsg})
+	if summary != nil {
+		budget -= helper.CountTokens(model, summaryContextPrefix+summary.Content+"\n")
+	}
+	for len(lines) > 1 && helper.CountTokens(model, strings.Join(lines, "\n")) > budget {
+		lines = lines[1:]
+	}
+	transcript := strings.Join(lines, "\n")
+	if summary != nil {
+		transcript = summaryContextPrefix + summary.Content + "\n" + transcript
+	}
+
+	chatReq := helper.ChatRequest{
+		Model: model,
+		Messages: []*helper.ChatMessage{
+			promptMsg,
+			{Role: "user", Content: transcript},
+		},
+		User:    chat.Store.Config.SiteName,
+		Context: chat.Context,
+	}
+	if app != nil {
+		chatReq.Provider = app.Provider
+	}
+
+	res, err := chat.Store.Config.ChatGptAsk(chatReq)
+	if err != nil {
+		return nil, nil, err
+	}
+	if res == nil || len(res.Choices) < 1 || res.Choices[0].Message == nil || res.Choices[0].Message.Content == "" {
+		return nil, nil, errors.New("openai api callback choices data error")
+	}
+
+	newSummary := &Message{
+		ChatID:       chat.ID,
+		Role:         "system",
+		Content:      res.Choices[0].Message.Content,
+		Raw:          res.Raw,
+		IsSummary:    true,
+		SummaryUntil: older[len(older)-1].ID,
+		// 摘要请求同样计入用量
+		Model:            res.Model,
+		RequestID:        res.RequestID,
+		FinishReason:     res.Choices[0].FinishReason,
+		PromptTokens:     res.Usage.PromptTokens,
+		CompletionTokens: res.Usage.CompletionTokens,
+		TotalTokens:      res.Usage.TotalTokens,
+	}
+	if newSummary.TotalTokens == 0 {
+		newSummary.UsageEstimated = true
+		newSummary.PromptTokens = helper.CountChatTokens(model, chatReq.Messages)
+		newSummary.CompletionTokens = helper.CountTokens(model, newSummary.Content)
+		newSummary.TotalTokens = newSummary.PromptTokens + newSummary.CompletionTokens
+	}
+	chat.Store.CalcCost(newSummary, time.Now(), newSummary.Model, model)
+	if err := chat.Store.Messages.Create(newSummary); err != nil {
+		return nil, nil, err
+	}
+	chat.Store.RecordUsage(app, newSummary.TotalTokens, newSummary.Cost, newSummary.Currency)
+
+	return newSummary, history[split:], nil
+}
@@ -0,0 +1,215 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/models/context_test.go
+ */
+package models
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gpt-zmide-server/helper"
+)
+
+const testContextModel = "gpt-4o-mini"
+
+// 每条消息约 20 个 token
+func textMessage(role string, i int) *Message {
+	return &Message{Role: role, Content: "message " + strconv.Itoa(i) + strings.Repeat(" word", 16)}
+}
+
+func conversation(n int) []*Message {
+	list := []*Message{}
+	for i := 0; i < n; i++ {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		list = append(list, textMessage(role, i))
+	}
+	return list
+}
+
+// 保留 messages 中最后 n 条消息需要的 token 数
+func contextTokens(chat *Chat, messages []*Message, n int) int64 {
+	count := helper.CountChatTokens(testContextModel, nil)
+	for _, item := range messages[len(messages)-n:] {
+		count += helper.CountMessageTokens(testContextModel, chat.toChatMessage(item))
+	}
+	return count
+}
+
+// 消息角色及内容前两个词，如 user:message0
+func messageLabel(role, content string) string {
+	fields := strings.Fields(content)
+	if len(fields) > 2 {
+		fields = fields[:2]
+	}
+	return role + ":" + strings.Join(fields, "")
+}
+
+func chatContents(msgs []*helper.ChatMessage) []string {
+	list := []string{}
+	for _, msg := range msgs {
+		list = append(list, messageLabel(msg.Role, msg.Content))
+	}
+	return list
+}
+
+func TestBuildContext(t *testing.T) {
+	toolCall := []*helper.ToolCall{{ID: "call_1", Type: "function", Function: helper.ToolCallFunction{Name: "lookup", Arguments: `{"q":"x"}`}}}
+	withTools := func() []*Message {
+		return []*Message{
+			textMessage("user", 0),
+			{Role: "assistant", ToolCalls: toolCall, Content: "message 1" + strings.Repeat(" call", 40)},
+			{Role: "tool", Name: "lookup", ToolCallID: "call_1", Content: "message 2"},
+			textMessage("assistant", 3),
+			textMessage("user", 4),
+		}
+	}
+
+	cases := []struct {
+		name     string
+		strategy string
+		lastN    int
+		messages []*Message
+		keep     int // tokenLimit 为保留最后 keep 条消息需要的 token 数，为 0 时不限制
+		want     []string
+		wantErr  bool
+	}{
+		{"sliding window keeps newest", ContextStrategySlidingWindow, 0, conversation(6), 3,
+			[]string{"assistant:message3", "user:message4", "assistant:message5"}, false},
+		{"last n truncates", ContextStrategyLastN, 2, conversation(6), 0,
+			[]string{"user:message4", "assistant:message5"}, false},
+		{"last n within limit", ContextStrategyLastN, 10, conversation(3), 0,
+			[]string{"user:message0", "assistant:message1", "user:message2"}, false},
+		{"reject over limit", ContextStrategyReject, 0, conversation(6), 5, nil, true},
+		{"reject within limit", ContextStrategyReject, 0, conversation(2), 2,
+			[]string{"user:message0", "assistant:message1"}, false},
+		// 发起调用的 assistant 消息被截断时丢弃其后的工具结果
+		{"drop trailing tool messages", ContextStrategySlidingWindow, 0, withTools(), 3,
+			[]string{"assistant:message3", "user:message4"}, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s, app := newMockStores(t)
+			app.ContextStrategy = c.strategy
+			app.ContextLastN = c.lastN
+			chat := newTestChat(t, s, app, c.messages...)
+
+			limit := int64(1 << 20)
+			if c.keep > 0 {
+				limit = contextTokens(chat, c.messages, c.keep)
+			}
+			msgs, tokenCount, err := chat.buildContext(testContextModel, app, nil, limit)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("context %v, want error", chatContents(msgs))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := chatContents(msgs); strings.Join(got, ",") != strings.Join(c.want, ",") {
+				t.Fatalf("context %v, want %v", got, c.want)
+			}
+			if want := helper.CountChatTokens(testContextModel, msgs); tokenCount != want {
+				t.Fatalf("token count %d, want %d", tokenCount, want)
+			}
+		})
+	}
+}
+
+func TestBuildContextSummary(t *testing.T) {
+	s, app := newMockStores(t)
+	script := filepath.Join(t.TempDir(), "script.yaml")
+	if err := os.WriteFile(script, []byte("rules:\n  - reply: short summary\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s.Config.Mock.Script = script
+	app.ContextStrategy = ContextStrategySummary
+	messages := conversation(8)
+	chat := newTestChat(t, s, app, messages...)
+	limit := contextTokens(chat, messages, 5)
+
+	// 未超出上下文时不生成摘要
+	short := newTestChat(t, s, app, conversation(4)...)
+	if _, _, err := short.buildContext(testContextModel, app, nil, limit); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := s.Messages.ListByChat(short.ID); len(list) != 4 {
+		t.Fatalf("short chat messages %d", len(list))
+	}
+
+	// 超出上下文时总结较早的消息并保存摘要
+	msgs, _, err := chat.buildContext(testContextModel, app, nil, limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := s.Messages.ListByChat(chat.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var summary *Message
+	for _, item := range list {
+		if item.IsSummary {
+			if summary != nil {
+				t.Fatal("more than one summary")
+			}
+			summary = item
+		}
+	}
+	if summary == nil || summary.Content != "short summary" || summary.SummaryUntil == 0 || summary.TotalTokens == 0 {
+		t.Fatalf("summary %+v", summary)
+	}
+	if msgs[0].Role != "system" || msgs[0].Content != summaryContextPrefix+"short summary" {
+		t.Fatalf("first context message %+v", msgs[0])
+	}
+	for _, msg := range msgs[1:] {
+		if strings.Contains(msg.Content, "message 0 ") {
+			t.Fatalf("summarized message in context %+v", msg)
+		}
+	}
+
+	// 摘要请求计入应用用量
+	usage, err := s.PeriodUsage(app, BudgetPeriodDaily, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Tokens != summary.TotalTokens {
+		t.Fatalf("usage tokens %d, want %d", usage.Tokens, summary.TotalTokens)
+	}
+
+	// 后续请求仅使用摘要之后的消息，不再重复总结
+	next := textMessage("user", 8)
+	next.ChatID = chat.ID
+	if err := s.Messages.Create(next); err != nil {
+		t.Fatal(err)
+	}
+	if chat.Messages, err = s.Messages.ListByChat(chat.ID); err != nil {
+		t.Fatal(err)
+	}
+	msgs, _, err = chat.buildContext(testContextModel, app, nil, limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{messageLabel("system", summaryContextPrefix+"short summary")}
+	for _, item := range chat.Messages {
+		if !item.IsSummary && item.ID > summary.SummaryUntil {
+			want = append(want, messageLabel(item.Role, item.Content))
+		}
+	}
+	if got := chatContents(msgs); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("context %v, want %v", got, want)
+	}
+	if list, _ := s.Messages.ListByChat(chat.ID); len(list) != len(chat.Messages) {
+		t.Fatalf("messages %d after second request, want %d", len(list), len(chat.Messages))
+	}
+}
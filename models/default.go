@@ -10,16 +10,15 @@ import (
 	"errors"
 	"fmt"
 	"gpt-zmide-server/helper"
-	"gpt-zmide-server/helper/logger"
 	"strings"
 	"time"
 
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-var DB *gorm.DB
-
 type BaseModel struct {
 	CreatedAt LocalTime `json:"created_at"`
 	UpdatedAt LocalTime `json:"updated_at"`
@@ -31,71 +30,57 @@ type PaginateForm struct {
 	Index int `form:"page_index"`
 }
 
-func init() {
-	// 是否初始化安装
-	if !helper.IsInitialize() {
-		if err := InitDB(); err != nil {
-			logger.Fatal(err.Error())
-			panic(err.Error())
-		}
+// 按配置创建数据库连接，数据库结构由迁移维护，见 MigrateUp
+func Open(config *helper.DefaultConfig) (*gorm.DB, error) {
+	dialector, err := Dialector(config)
+	if err != nil {
+		return nil, fmt.Errorf("the database is not configured, please modify the app.conf file to configure the database: %w", err)
 	}
-}
 
-func InitDB() error {
-	if DB != nil {
-		return nil
+	db, err := gorm.Open(dialector, &gorm.Config{QueryFields: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect database: %w", err)
 	}
+	if sqlDB, _ := db.DB(); sqlDB != nil {
+		sqlDB.SetMaxOpenConns(0)
+	}
+	return db, nil
+}
 
-	dbUrl, err := helper.Config.GetMysqlUrl()
-	if err != nil || dbUrl == nil {
+// 按配置的数据库类型创建连接
+func Dialector(config *helper.DefaultConfig) (gorm.Dialector, error) {
+	switch config.GetDBDriver() {
+	case helper.DBDriverSqlite:
+		// 等待写锁并启用 WAL，减少并发写入时的 database is locked 错误
+		dsn := config.GetSqlitePath() + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+		return sqlite.Open(dsn), nil
+	case helper.DBDriverPostgres:
+		dsn, err := config.GetPostgresDSN()
 		if err != nil {
-			logger.Error(err.Error())
+			return nil, err
 		}
-		return errors.New("the database is not configured, please modify the app.conf file to configure the database")
-	}
-
-	dsn := helper.Config.Mysql.User + ":" + helper.Config.Mysql.Password + "@tcp(" + dbUrl.Host + ")/" + helper.Config.Mysql.Database + "?charset=utf8&parseTime=True&loc=Local"
-	DB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{QueryFields: true})
-	if db, _ := DB.DB(); db != nil {
-		db.SetMaxOpenConns(0)
-	}
-
-	if err != nil {
-		logger.Error(err.Error())
-		return errors.New("failed to connect database")
-	}
-
-	// Migrate the schema
-	if err == nil && DB != nil {
-		// 执行数据库迁移
-		err = DB.AutoMigrate(
-			&Application{},
-			&Chat{},
-			&Message{},
-		)
-
+		return postgres.Open(dsn), nil
+	case helper.DBDriverMysql:
+		dbUrl, err := config.GetMysqlUrl()
 		if err != nil {
-			// fmt.Println(err.Error())
-			logger.Error(err.Error())
+			return nil, err
 		}
-
+		dsn := config.Mysql.User + ":" + config.Mysql.Password + "@tcp(" + dbUrl.Host + ")/" + config.Mysql.Database + "?charset=utf8&parseTime=True&loc=Local"
+		return mysql.Open(dsn), nil
 	}
-
-	return nil
+	return nil, errors.New("unsupported database driver " + config.DBDriver)
 }
 
-func ModelPaginate(value interface{}, form *PaginateForm) (pageForm *PaginateForm, pageOffset int, pageTotal int) {
+// 按记录总数计算分页偏移及分页总数
+func Paginate(form *PaginateForm, total int64) (pageOffset int, pageTotal int) {
 	// 计算分页查询偏移
 	pageOffset = (form.Index - 1) * form.Limit
 
-	// 计算分页总数
-	var total int64
-	DB.Model(value).Count(&total)
 	pageTotal = int(total) / form.Limit
 	if int(total)%form.Limit != 0 {
 		pageTotal++
 	}
-	return form, pageOffset, pageTotal
+	return pageOffset, pageTotal
 }
 
 type LocalTime struct {
@@ -128,10 +113,30 @@ func (t LocalTime) Value() (driver.Value, error) {
 }
 
 func (t *LocalTime) Scan(v interface{}) error {
-	value, ok := v.(time.Time)
-	if ok {
-		*t = LocalTime{Time: value}
+	if v == nil {
+		*t = LocalTime{}
 		return nil
 	}
+	switch value := v.(type) {
+	case time.Time:
+		// PostgreSQL 等驱动可能返回 UTC 时间，统一转换为本地时间输出
+		*t = LocalTime{Time: value.In(time.Local)}
+		return nil
+	case string:
+		return t.scanString(value)
+	case []byte:
+		return t.scanString(string(value))
+	}
 	return fmt.Errorf("can not convert %v to timestamp", v)
 }
+
+// 部分驱动（如 SQLite）未识别列类型时以字符串返回时间
+func (t *LocalTime) scanString(value string) error {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999-07:00", "2006-01-02 15:04:05.999999999", "2006-01-02 15:04:05"} {
+		if value, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			*t = LocalTime{Time: value}
+			return nil
+		}
+	}
+	return fmt.Errorf("can not convert %v to timestamp", value)
+}
@@ -5,11 +5,68 @@
  */
 package models
 
+import (
+	"gpt-zmide-server/helper"
+	"time"
+)
+
 type Message struct {
 	ID      uint   `gorm:"primaryKey" json:"id"`
 	ChatID  uint   `json:"chat_id"`
 	Role    string `json:"role"`
 	Content string `json:"content"`
 	Raw     string `json:"-"`
+	// 工具调用，assistant 消息记录发起的调用，tool 消息记录对应的调用 ID 及函数名
+	Name       string             `json:"name"`
+	ToolCalls  []*helper.ToolCall `gorm:"serializer:json;type:text" json:"tool_calls"`
+	ToolCallID string             `json:"tool_call_id"`
+	// 消息图片，本地图片为相对保存目录的路径，远程图片为图片地址
+	Images []string `gorm:"serializer:json;type:text" json:"images"`
+	// 上下文摘要，SummaryUntil 为摘要覆盖的最后一条消息 ID
+	IsSummary    bool `json:"is_summary"`
+	SummaryUntil uint `json:"summary_until"`
+	// 上游请求信息，仅回复消息记录
+	Model            string `json:"model"`
+	RequestID        string `json:"request_id"`
+	FinishReason     string `json:"finish_reason"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	TotalTokens      int64  `json:"total_tokens"`
+	UsageEstimated   bool   `json:"usage_estimated"` // 上游未返回用量，由本地计算
+	LatencyMs        int64  `json:"latency_ms"`      // 请求总耗时
+	FirstTokenMs     int64  `json:"first_token_ms"`  // 首个分片耗时
+	// 按写入时生效的模型价格计算的费用
+	Cost     float64 `json:"cost"`
+	Currency string  `json:"currency"`
 	BaseModel
 }
+
+// 根据上游响应记录模型、用量及耗时，上游未返回用量时按 promptTokens 及回复消息（含工具调用）本地计算，费用见 Stores.CalcCost
+func (msg *Message) SetUsage(res *helper.OpenAIResponse, model string, promptTokens int64, startAt, firstTokenAt time.Time) {
+	latency := time.Since(startAt)
+
+	msg.Model = res.Model
+	if msg.Model == "" {
+		msg.Model = model
+	}
+	msg.RequestID = res.RequestID
+	if len(res.Choices) > 0 {
+		msg.FinishReason = res.Choices[0].FinishReason
+	}
+	msg.PromptTokens = res.Usage.PromptTokens
+	msg.CompletionTokens = res.Usage.CompletionTokens
+	msg.TotalTokens = res.Usage.TotalTokens
+	msg.LatencyMs = latency.Milliseconds()
+	msg.FirstTokenMs = latency.Milliseconds()
+	if !firstTokenAt.IsZero() {
+		msg.FirstTokenMs = firstTokenAt.Sub(startAt).Milliseconds()
+	}
+
+	if msg.TotalTokens == 0 {
+		msg.UsageEstimated = true
+		msg.PromptTokens = promptTokens
+		// 按消息计算，仅包含工具调用的回复同样计入函数名及参数
+		msg.CompletionTokens = helper.CountMessageTokens(model, &helper.ChatMessage{Role: msg.Role, Name: msg.Name, Content: msg.Content, ToolCalls: msg.ToolCalls})
+		msg.TotalTokens = msg.PromptTokens + msg.CompletionTokens
+	}
+}
@@ -0,0 +1,36 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/models/message_test.go
+ */
+package models
+
+import (
+	"gpt-zmide-server/helper"
+	"testing"
+	"time"
+)
+
+// 上游未返回用量时，仅包含工具调用的回复按函数名及参数估算
+func TestSetUsageEstimatesToolCalls(t *testing.T) {
+	msg := &Message{
+		Role: "assistant",
+		ToolCalls: []*helper.ToolCall{{
+			ID:       "call_1",
+			Type:     "function",
+			Function: helper.ToolCallFunction{Name: "get_weather", Arguments: `{"city":"Shanghai"}`},
+		}},
+	}
+	msg.SetUsage(&helper.OpenAIResponse{}, "gpt-4o-mini", 10, time.Now(), time.Time{})
+
+	if !msg.UsageEstimated {
+		t.Fatal("usage not estimated")
+	}
+	content := helper.CountTokens("gpt-4o-mini", `get_weather{"city":"Shanghai"}`)
+	if msg.CompletionTokens < content {
+		t.Fatalf("completion tokens %d, want at least %d", msg.CompletionTokens, content)
+	}
+	if msg.TotalTokens != msg.PromptTokens+msg.CompletionTokens || msg.PromptTokens != 10 {
+		t.Fatalf("usage %d + %d = %d", msg.PromptTokens, msg.CompletionTokens, msg.TotalTokens)
+	}
+}
@@ -0,0 +1,206 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/models/migration.go
+ */
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 迁移状态
+const (
+	MigrationPending = "pending"
+	MigrationApplied = "applied"
+	MigrationFailed  = "failed"
+	MigrationUnknown = "unknown" // 数据库中存在但当前程序未定义，通常为更新版本程序执行的迁移
+)
+
+// 存在未执行或执行失败的迁移
+var ErrMigrationPending = errors.New("database migration required")
+
+// 数据库迁移，按 Version 顺序执行，已发布的迁移不可修改，结构变更需新增迁移
+type Migration struct {
+	Version uint
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error // 为 nil 时不可回滚
+}
+
+// 已执行的迁移记录
+type SchemaMigration struct {
+	Version   uint      `gorm:"primaryKey;autoIncrement:false" json:"version"`
+	Name      string    `json:"name"`
+	Status    string    `gorm:"size:16" json:"status"`
+	Error     string    `gorm:"type:text" json:"error"`
+	AppliedAt LocalTime `json:"applied_at"`
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// 迁移执行状态
+type MigrationState struct {
+	Version   uint       `json:"version"`
+	Name      string     `json:"name"`
+	Status    string     `json:"status"`
+	Error     string     `json:"error,omitempty"`
+	AppliedAt *LocalTime `json:"applied_at"`
+}
+
+func init() {
+	sort.SliceStable(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			panic("duplicate migration version " + strconv.Itoa(int(migrations[i].Version)))
+		}
+	}
+}
+
+// 读取迁移记录，按版本号索引
+func migrationRecords(db *gorm.DB) (map[uint]*SchemaMigration, error) {
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, err
+	}
+	var list []*SchemaMigration
+	if err := db.Find(&list).Error; err != nil {
+		return nil, err
+	}
+	records := map[uint]*SchemaMigration{}
+	for _, item := range list {
+		records[item.Version] = item
+	}
+	return records, nil
+}
+
+// 获取所有迁移的执行状态
+func MigrationStatus(db *gorm.DB) ([]*MigrationState, error) {
+	records, err := migrationRecords(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []*MigrationState
+	for _, migration := range migrations {
+		state := &MigrationState{Version: migration.Version, Name: migration.Name, Status: MigrationPending}
+		if record, ok := records[migration.Version]; ok {
+			state.Status, state.Error, state.AppliedAt = record.Status, record.Error, &record.AppliedAt
+			delete(records, migration.Version)
+		}
+		list = append(list, state)
+	}
+	for _, record := range records {
+		list = append(list, &MigrationState{
+			Version:   record.Version,
+			Name:      record.Name,
+			Status:    MigrationUnknown,
+			Error:     record.Error,
+			AppliedAt: &record.AppliedAt,
+		})
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Version < list[j].Version
+	})
+	return list, nil
+}
+
+// 检查数据库结构是否为最新，存在未执行、执行失败或未知的迁移时返回错误
+func CheckMigrations(db *gorm.DB) error {
+	list, err := MigrationStatus(db)
+	if err != nil {
+		return err
+	}
+	for _, state := range list {
+		switch state.Status {
+		case MigrationPending, MigrationFailed:
+			return fmt.Errorf("%w: migration %d_%s is %s", ErrMigrationPending, state.Version, state.Name, state.Status)
+		case MigrationUnknown:
+			return fmt.Errorf("migration %d_%s is not defined in this build, the database may be migrated by a newer version", state.Version, state.Name)
+		}
+	}
+	return nil
+}
+
+// 按顺序执行未完成的迁移，执行失败的迁移会重新执行，遇到错误时停止
+func MigrateUp(db *gorm.DB) (applied []*Migration, err error) {
+	records, err := migrationRecords(db)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, migration := range migrations {
+		if record, ok := records[migration.Version]; ok && record.Status == MigrationApplied {
+			continue
+		}
+
+		err := db.Transaction(migration.Up)
+		if err := saveMigrationRecord(db, migration, err); err != nil {
+			return applied, err
+		}
+		if err != nil {
+			return applied, fmt.Errorf("migration %s failed: %w", migration.id(), err)
+		}
+		applied = append(applied, migration)
+	}
+	return applied, nil
+}
+
+// 按倒序回滚最近 steps 个已执行的迁移
+func MigrateDown(db *gorm.DB, steps int) (reverted []*Migration, err error) {
+	records, err := migrationRecords(db)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+		migration := migrations[i]
+		if record, ok := records[migration.Version]; !ok || record.Status != MigrationApplied {
+			continue
+		}
+		if migration.Down == nil {
+			return reverted, errors.New("migration " + migration.id() + " is irreversible")
+		}
+
+		if err := db.Transaction(migration.Down); err != nil {
+			// 回滚失败时标记为失败，需重新执行 up 修复
+			if err := saveMigrationRecord(db, migration, err); err != nil {
+				return reverted, err
+			}
+			return reverted, fmt.Errorf("migration %s rollback failed: %w", migration.id(), err)
+		}
+		if err := db.Delete(&SchemaMigration{Version: migration.Version}).Error; err != nil {
+			return reverted, err
+		}
+		reverted = append(reverted, migration)
+	}
+	return reverted, nil
+}
+
+// 记录迁移执行结果
+func saveMigrationRecord(db *gorm.DB, migration *Migration, result error) error {
+	record := &SchemaMigration{
+		Version:   migration.Version,
+		Name:      migration.Name,
+		Status:    MigrationApplied,
+		AppliedAt: LocalTime{time.Now()},
+	}
+	if result != nil {
+		record.Status = MigrationFailed
+		record.Error = result.Error()
+	}
+	return db.Save(record).Error
+}
+
+func (migration *Migration) id() string {
+	return strconv.Itoa(int(migration.Version)) + "_" + migration.Name
+}
@@ -0,0 +1,90 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/models/migration_test.go
+ */
+package models
+
+import (
+	"path/filepath"
+	"testing"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"gpt-zmide-server/helper"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	config := &helper.DefaultConfig{DBDriver: helper.DBDriverSqlite}
+	config.Sqlite.Path = filepath.Join(t.TempDir(), "test.db")
+	db, err := Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Logger = logger.Discard
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func TestBackfillContextStrategy(t *testing.T) {
+	db := openTestDB(t)
+	if _, err := MigrateUp(db); err != nil {
+		t.Fatal(err)
+	}
+	if db.Migrator().HasColumn(&v3Application{}, v3FixLongMsgColumn) {
+		t.Fatal("new database has enable_fix_long_msg")
+	}
+
+	// 回滚到迁移 2，模拟由早期版本升级的数据库
+	if _, err := MigrateDown(db, 1); err != nil {
+		t.Fatal(err)
+	}
+	apps := []struct {
+		name       string
+		fixLongMsg uint
+		strategy   string
+		want       string
+	}{
+		{"reject", 1, "", "reject"},
+		{"skip", 0, "", "sliding_window"},
+		{"skip other value", 2, "", "sliding_window"},
+		{"keep strategy", 1, "summary", "summary"},
+	}
+	for _, app := range apps {
+		err := db.Exec("INSERT INTO applications (name, app_secret, app_key, api_key, context_strategy, enable_fix_long_msg) VALUES (?, ?, ?, ?, ?, ?)",
+			app.name, app.name, app.name, app.name, app.strategy, app.fixLongMsg).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := MigrateUp(db); err != nil {
+		t.Fatal(err)
+	}
+	for _, app := range apps {
+		var strategy string
+		db.Raw("SELECT context_strategy FROM applications WHERE name = ?", app.name).Scan(&strategy)
+		if strategy != app.want {
+			t.Fatalf("%s context strategy %q, want %q", app.name, strategy, app.want)
+		}
+	}
+	if db.Migrator().HasColumn(&v3Application{}, v3FixLongMsgColumn) {
+		t.Fatal("enable_fix_long_msg not dropped")
+	}
+
+	// 回滚时恢复字段
+	if _, err := MigrateDown(db, 1); err != nil {
+		t.Fatal(err)
+	}
+	var fixLongMsg uint
+	db.Raw("SELECT enable_fix_long_msg FROM applications WHERE name = ?", "reject").Scan(&fixLongMsg)
+	if fixLongMsg != 1 {
+		t.Fatalf("restored enable_fix_long_msg %d", fixLongMsg)
+	}
+}
@@ -0,0 +1,210 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/models/migration_v1.go
+ */
+package models
+
+// 迁移 1 initial_schema 的表结构快照
+//
+// 与迁移发布时的模型结构一致，不随模型修改，结构变更需新增迁移。
+
+type v1Application struct {
+	ID                   uint   `gorm:"primaryKey"`
+	Name                 string `gorm:"unique"`
+	AppSecret            string `gorm:"unique"`
+	AppKey               string `gorm:"unique;index"`
+	ApiKey               string `gorm:"unique;index"`
+	Status               uint
+	ContextStrategy      string
+	ContextLastN         int
+	MaxToolIterations    int
+	Provider             string
+	SensitiveAction      string
+	DefaultModel         string
+	AllowedModels        string
+	Temperature          float64
+	TopP                 float64
+	MaxTokens            int
+	SystemPrompt         string `gorm:"type:text"`
+	RateLimitRPM         int64
+	RateLimitTPM         int64
+	MaxConcurrentStreams int64
+	MaxImages            int64
+	MaxImageSize         int64
+	DailyTokenBudget     int64
+	MonthlyTokenBudget   int64
+	DailyCostBudget      float64
+	MonthlyCostBudget    float64
+	BudgetAlertPercent   int
+	CreatedAt            LocalTime
+	UpdatedAt            LocalTime
+}
+
+func (v1Application) TableName() string { return "applications" }
+
+type v1Chat struct {
+	ID          uint `gorm:"primaryKey"`
+	AppID       uint
+	Remark      string
+	Messages    []*v1Message   `gorm:"foreignKey:ChatID"`
+	Application *v1Application `gorm:"foreignKey:AppID"`
+	Model       string
+	CreatedAt   LocalTime
+	UpdatedAt   LocalTime
+}
+
+func (v1Chat) TableName() string { return "chats" }
+
+type v1Message struct {
+	ID               uint `gorm:"primaryKey"`
+	ChatID           uint
+	Role             string
+	Content          string
+	Raw              string
+	Name             string
+	ToolCalls        string `gorm:"type:text"`
+	ToolCallID       string
+	Images           string `gorm:"type:text"`
+	IsSummary        bool
+	SummaryUntil     uint
+	Model            string
+	RequestID        string
+	FinishReason     string
+	PromptTokens     int64
+	CompletionTokens int64
+	TotalTokens      int64
+	UsageEstimated   bool
+	LatencyMs        int64
+	FirstTokenMs     int64
+	Cost             float64
+	Currency         string
+	CreatedAt        LocalTime
+	UpdatedAt        LocalTime
+}
+
+func (v1Message) TableName() string { return "messages" }
+
+type v1UpstreamKey struct {
+	ID                uint   `gorm:"primaryKey"`
+	Provider          string `gorm:"index"`
+	Name              string
+	SecretKey         string
+	Weight            int
+	Status            uint
+	SuccessCount      int64
+	ErrorCount        int64
+	ConsecutiveErrors int
+	LastStatus        int
+	LastError         string
+	CooldownUntil     *LocalTime
+	CreatedAt         LocalTime
+	UpdatedAt         LocalTime
+}
+
+func (v1UpstreamKey) TableName() string { return "upstream_keys" }
+
+type v1SensitiveWord struct {
+	ID        uint `gorm:"primaryKey"`
+	AppID     uint `gorm:"index"`
+	Word      string
+	CreatedAt LocalTime
+	UpdatedAt LocalTime
+}
+
+func (v1SensitiveWord) TableName() string { return "sensitive_words" }
+
+type v1ModelPrice struct {
+	ID            uint   `gorm:"primaryKey"`
+	Model         string `gorm:"index"`
+	InputPrice    float64
+	OutputPrice   float64
+	Currency      string
+	EffectiveFrom *LocalTime
+	EffectiveTo   *LocalTime
+	CreatedAt     LocalTime
+	UpdatedAt     LocalTime
+}
+
+func (v1ModelPrice) TableName() string { return "model_prices" }
+
+type v1ApplicationUsage struct {
+	ID          uint   `gorm:"primaryKey"`
+	AppID       uint   `gorm:"uniqueIndex:idx_app_usage_period"`
+	Period      string `gorm:"size:16;uniqueIndex:idx_app_usage_period"`
+	PeriodKey   string `gorm:"size:16;uniqueIndex:idx_app_usage_period"`
+	Tokens      int64
+	Cost        float64
+	SoftAlerted bool
+	HardAlerted bool
+	CreatedAt   LocalTime
+	UpdatedAt   LocalTime
+}
+
+func (v1ApplicationUsage) TableName() string { return "application_usages" }
+
+type v1BudgetAlert struct {
+	ID        uint `gorm:"primaryKey"`
+	AppID     uint `gorm:"index"`
+	Period    string
+	PeriodKey string
+	Kind      string
+	Metric    string
+	Usage     float64
+	Budget    float64
+	CreatedAt LocalTime
+	UpdatedAt LocalTime
+}
+
+func (v1BudgetAlert) TableName() string { return "budget_alerts" }
+
+type v1UsageRecord struct {
+	ID               uint `gorm:"primaryKey"`
+	AppID            uint `gorm:"index"`
+	Kind             string
+	Remark           string
+	Model            string
+	RequestID        string
+	PromptTokens     int64
+	CompletionTokens int64
+	TotalTokens      int64
+	UsageEstimated   bool
+	LatencyMs        int64
+	Cost             float64
+	Currency         string
+	CreatedAt        LocalTime
+	UpdatedAt        LocalTime
+}
+
+func (v1UsageRecord) TableName() string { return "usage_records" }
+
+type v1Tool struct {
+	ID          uint   `gorm:"primaryKey"`
+	Name        string `gorm:"size:64;uniqueIndex"`
+	Description string `gorm:"type:text"`
+	Parameters  string `gorm:"type:text"`
+	URL         string
+	Timeout     int
+	AllowedApps string
+	Status      uint
+	CreatedAt   LocalTime
+	UpdatedAt   LocalTime
+}
+
+func (v1Tool) TableName() string { return "tools" }
+
+// 按创建顺序排列，回滚时倒序删除
+func v1Tables() []interface{} {
+	return []interface{}{
+		&v1Application{},
+		&v1Chat{},
+		&v1Message{},
+		&v1UpstreamKey{},
+		&v1SensitiveWord{},
+		&v1ModelPrice{},
+		&v1ApplicationUsage{},
+		&v1BudgetAlert{},
+		&v1UsageRecord{},
+		&v1Tool{},
+	}
+}
@@ -0,0 +1,55 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/models/migration_v3.go
+ */
+package models
+
+import "gorm.io/gorm"
+
+// 迁移 3 backfill_context_strategy 的表结构快照
+//
+// 早期版本以 enable_fix_long_msg 控制超长上下文：为 1 时返回错误，其他值丢弃较早的消息。
+// 该字段由 AutoMigrate 创建，迁移 1 的快照中没有，仅从早期版本升级的数据库存在。
+
+type v3Application struct {
+	ID               uint `gorm:"primaryKey"`
+	ContextStrategy  string
+	EnableFixLongMsg uint
+}
+
+func (v3Application) TableName() string { return "applications" }
+
+const v3FixLongMsgColumn = "enable_fix_long_msg"
+
+// 按 enable_fix_long_msg 补全未设置的上下文策略，并删除该字段
+func v3BackfillContextStrategy(tx *gorm.DB) error {
+	if !tx.Migrator().HasColumn(&v3Application{}, v3FixLongMsgColumn) {
+		return nil
+	}
+	err := tx.Model(&v3Application{}).
+		Where("(context_strategy IS NULL OR context_strategy = '') AND "+v3FixLongMsgColumn+" = ?", 1).
+		Update("context_strategy", "reject").Error
+	if err != nil {
+		return err
+	}
+	err = tx.Model(&v3Application{}).
+		Where("context_strategy IS NULL OR context_strategy = ''").
+		Update("context_strategy", "sliding_window").Error
+	if err != nil {
+		return err
+	}
+	return tx.Migrator().DropColumn(&v3Application{}, v3FixLongMsgColumn)
+}
+
+// 恢复 enable_fix_long_msg 字段，超出时报错的应用写入 1
+func v3RestoreFixLongMsg(tx *gorm.DB) error {
+	if !tx.Migrator().HasColumn(&v3Application{}, v3FixLongMsgColumn) {
+		if err := tx.Migrator().AddColumn(&v3Application{}, "EnableFixLongMsg"); err != nil {
+			return err
+		}
+	}
+	return tx.Model(&v3Application{}).
+		Where("context_strategy = ?", "reject").
+		Update(v3FixLongMsgColumn, 1).Error
+}
@@ -0,0 +1,80 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/models/migrations.go
+ */
+package models
+
+import "gorm.io/gorm"
+
+// 数据库迁移列表，新增迁移追加到末尾，版本号递增
+// 迁移只能使用迁移文件中的结构快照或 SQL，不能引用会修改的模型结构
+var migrations = []*Migration{
+	{
+		// 初始结构，兼容此前由 AutoMigrate 创建的数据库
+		Version: 1,
+		Name:    "initial_schema",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(v1Tables()...)
+		},
+		Down: func(tx *gorm.DB) error {
+			// 倒序删除，先删除存在外键引用的表
+			tables := v1Tables()
+			for i := len(tables) - 1; i >= 0; i-- {
+				if err := tx.Migrator().DropTable(tables[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 2,
+		Name:    "seed_model_prices",
+		Up:      v2SeedModelPrices,
+		Down: func(tx *gorm.DB) error {
+			// 价格可能已在后台修改，回滚时保留
+			return nil
+		},
+	},
+	{
+		Version: 3,
+		Name:    "backfill_context_strategy",
+		Up:      v3BackfillContextStrategy,
+		Down:    v3RestoreFixLongMsg,
+	},
+}
+
+// 迁移 2 seed_model_prices 写入的默认模型价格
+var v2ModelPrices = []struct {
+	Model       string
+	InputPrice  float64
+	OutputPrice float64
+}{
+	{"gpt-3.5-turbo", 0.0005, 0.0015},
+	{"gpt-4", 0.03, 0.06},
+	{"gpt-4-turbo", 0.01, 0.03},
+	{"gpt-4o", 0.0025, 0.01},
+	{"gpt-4o-mini", 0.00015, 0.0006},
+	{"text-embedding-3-small", 0.00002, 0},
+	{"text-embedding-3-large", 0.00013, 0},
+	{"text-embedding-ada-002", 0.0001, 0},
+}
+
+// 写入默认模型价格，已存在价格时跳过
+func v2SeedModelPrices(tx *gorm.DB) error {
+	var count int64
+	if err := tx.Model(&v1ModelPrice{}).Count(&count).Error; err != nil || count > 0 {
+		return err
+	}
+	prices := make([]*v1ModelPrice, 0, len(v2ModelPrices))
+	for _, item := range v2ModelPrices {
+		prices = append(prices, &v1ModelPrice{
+			Model:       item.Model,
+			InputPrice:  item.InputPrice,
+			OutputPrice: item.OutputPrice,
+			Currency:    "USD",
+		})
+	}
+	return tx.Create(&prices).Error
+}
@@ -0,0 +1,156 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/models/model_price.go
+ */
+package models
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 默认计价货币
+const DefaultCurrency = "USD"
+
+// 模型价格，Model 按前缀匹配，匹配最长的前缀；价格为每 1K token 的价格
+type ModelPrice struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	Model         string     `gorm:"index" json:"model"`
+	InputPrice    float64    `json:"input_price"`
+	OutputPrice   float64    `json:"output_price"`
+	Currency      string     `json:"currency"`
+	EffectiveFrom *LocalTime `json:"effective_from"` // 为空时不限制开始时间
+	EffectiveTo   *LocalTime `json:"effective_to"`   // 为空时长期有效
+	BaseModel
+}
+
+// 校验价格配置
+func (price *ModelPrice) Validate() error {
+	price.Model = strings.ToLower(strings.TrimSpace(price.Model))
+	price.Currency = strings.ToUpper(strings.TrimSpace(price.Currency))
+	if price.Currency == "" {
+		price.Currency = DefaultCurrency
+	}
+	if price.Model == "" {
+		return errors.New("模型不能为空")
+	}
+	if price.InputPrice < 0 || price.OutputPrice < 0 {
+		return errors.New("价格不能为负数")
+	}
+	if price.EffectiveFrom != nil && price.EffectiveTo != nil && !price.EffectiveTo.After(price.EffectiveFrom.Time) {
+		return errors.New("失效时间需晚于生效时间")
+	}
+	return nil
+}
+
+// 指定时间价格是否生效
+func (price *ModelPrice) ActiveAt(at time.Time) bool {
+	if price.EffectiveFrom != nil && !price.EffectiveFrom.IsZero() && at.Before(price.EffectiveFrom.Time) {
+		return false
+	}
+	if price.EffectiveTo != nil && !price.EffectiveTo.IsZero() && !at.Before(price.EffectiveTo.Time) {
+		return false
+	}
+	return true
+}
+
+// 按用量计算费用，保留 6 位小数
+func (price *ModelPrice) Cost(promptTokens, completionTokens int64) float64 {
+	cost := float64(promptTokens)/1000*price.InputPrice + float64(completionTokens)/1000*price.OutputPrice
+	return math.Round(cost*1e6) / 1e6
+}
+
+// 模型价格缓存
+type modelPriceCache struct {
+	sync.RWMutex
+	loaded bool
+	list   []*ModelPrice
+}
+
+// 价格变更后清除缓存
+func (s *Stores) ReloadModelPrices() {
+	cache := s.caches().prices
+	cache.Lock()
+	defer cache.Unlock()
+	cache.loaded = false
+	cache.list = nil
+}
+
+func (s *Stores) loadModelPrices() []*ModelPrice {
+	cache := s.caches().prices
+	cache.RLock()
+	if cache.loaded {
+		list := cache.list
+		cache.RUnlock()
+		return list
+	}
+	cache.RUnlock()
+
+	list, err := s.ModelPrices.List()
+	if err != nil {
+		s.Log().Error("load model prices error " + err.Error())
+		return nil
+	}
+
+	cache.Lock()
+	defer cache.Unlock()
+	cache.loaded = true
+	cache.list = list
+	return list
+}
+
+// 查找模型在指定时间生效的价格，前缀最长者优先，前缀相同时取生效时间最晚的
+func (s *Stores) FindModelPrice(model string, at time.Time) *ModelPrice {
+	model = strings.ToLower(model)
+	var found *ModelPrice
+	for _, item := range s.loadModelPrices() {
+		if !strings.HasPrefix(model, item.Model) || !item.ActiveAt(at) {
+			continue
+		}
+		if found == nil || len(item.Model) > len(found.Model) ||
+			(len(item.Model) == len(found.Model) && effectiveFrom(item).After(effectiveFrom(found))) {
+			found = item
+		}
+	}
+	return found
+}
+
+func effectiveFrom(price *ModelPrice) time.Time {
+	if price.EffectiveFrom == nil {
+		return time.Time{}
+	}
+	return price.EffectiveFrom.Time
+}
+
+// 按顺序查找首个配置了价格的模型的价格，均未配置时返回 nil
+func (s *Stores) findPrice(at time.Time, models ...string) *ModelPrice {
+	for _, model := range models {
+		if model == "" {
+			continue
+		}
+		if price := s.FindModelPrice(model, at); price != nil {
+			return price
+		}
+	}
+	return nil
+}
+
+// 计算消息费用，按顺序使用首个配置了价格的模型，未配置价格时费用为 0
+func (s *Stores) CalcCost(msg *Message, at time.Time, models ...string) {
+	if price := s.findPrice(at, models...); price != nil {
+		msg.Cost = price.Cost(msg.PromptTokens, msg.CompletionTokens)
+		msg.Currency = price.Currency
+	}
+}
+
+// 计算用量记录费用，规则同 CalcCost
+func (s *Stores) CalcRecordCost(record *UsageRecord, at time.Time, models ...string) {
+	if price := s.findPrice(at, models...); price != nil {
+		record.Cost = price.Cost(record.PromptTokens, record.CompletionTokens)
+		record.Currency = price.Currency
+	}
+}
@@ -0,0 +1,96 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/models/ratelimit.go
+ */
+package models
+
+import (
+	"errors"
+	"gpt-zmide-server/helper/ratelimit"
+	"strconv"
+	"time"
+)
+
+var ErrRateLimited = errors.New("请求过于频繁，请稍后再试")
+
+// 应用限流未通过，RetryAfter 为需等待的时间
+type RateLimitError struct {
+	Msg        string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return e.Msg
+}
+
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+func rateLimitKey(app *Application, name string) string {
+	return "app:" + strconv.Itoa(int(app.ID)) + ":" + name
+}
+
+// 应用 token 限流规则
+func tokenRateRule(app *Application) ratelimit.Rule {
+	return ratelimit.Rule{Limit: app.RateLimitTPM, Window: time.Minute}
+}
+
+// 计入一次应用请求，未配置每分钟请求数时返回 nil；限流存储出错时放行
+func (s *Stores) TakeRequest(app *Application) (*ratelimit.Result, error) {
+	if app.RateLimitRPM <= 0 {
+		return nil, nil
+	}
+	result, err := s.Limiter.Take(rateLimitKey(app, "requests"), ratelimit.Rule{Limit: app.RateLimitRPM, Window: time.Minute}, 1)
+	if err != nil {
+		s.Log().Error("rate limit error " + err.Error())
+		return nil, nil
+	}
+	if !result.Allowed {
+		return &result, &RateLimitError{Msg: "请求过于频繁，请稍后再试", RetryAfter: result.RetryAfter}
+	}
+	return &result, nil
+}
+
+// 检查应用每分钟 token 余量，请求完成后由 ChargeTokens 按实际用量扣减
+func (s *Stores) CheckTokens(app *Application) (*ratelimit.Result, error) {
+	if app.RateLimitTPM <= 0 {
+		return nil, nil
+	}
+	result, err := s.Limiter.Take(rateLimitKey(app, "tokens"), tokenRateRule(app), 0)
+	if err != nil {
+		s.Log().Error("rate limit error " + err.Error())
+		return nil, nil
+	}
+	if !result.Allowed {
+		return &result, &RateLimitError{Msg: "token 用量超出限制，请稍后再试", RetryAfter: result.RetryAfter}
+	}
+	return &result, nil
+}
+
+// 按实际用量扣减应用 token 余量
+func (s *Stores) ChargeTokens(app *Application, tokens int64) {
+	if app.RateLimitTPM <= 0 || tokens <= 0 {
+		return
+	}
+	if err := s.Limiter.Charge(rateLimitKey(app, "tokens"), tokenRateRule(app), tokens); err != nil {
+		s.Log().Error("rate limit error " + err.Error())
+	}
+}
+
+// 占用应用并发流式请求名额，返回占用后的并发数；限流存储出错时返回错误，不占用名额
+func (s *Stores) AcquireStream(app *Application) (ok bool, current int64, err error) {
+	ok, current, err = s.Limiter.Acquire(rateLimitKey(app, "streams"), app.MaxConcurrentStreams)
+	if err != nil {
+		s.Log().Error("rate limit error " + err.Error())
+	}
+	return
+}
+
+// 释放应用并发流式请求名额
+func (s *Stores) ReleaseStream(app *Application) {
+	if err := s.Limiter.Release(rateLimitKey(app, "streams")); err != nil {
+		s.Log().Error("rate limit error " + err.Error())
+	}
+}
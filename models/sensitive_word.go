@@ -0,0 +1,138 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/models/sensitive_word.go
+ */
+package models
+
+import (
+	"errors"
+	"gpt-zmide-server/helper/filter"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var ErrSensitiveContent = errors.New("内容包含敏感词")
+
+// 敏感词，AppID 为 0 时全局生效
+type SensitiveWord struct {
+	ID    uint   `gorm:"primaryKey" json:"id"`
+	AppID uint   `gorm:"index" json:"app_id"`
+	Word  string `json:"word"`
+	BaseModel
+}
+
+// 批量添加敏感词，忽略已存在的词
+func CreateSensitiveWords(store *Stores, appID uint, words []string) (list []*SensitiveWord, err error) {
+	exists, err := store.SensitiveWords.List(appID)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, item := range exists {
+		seen[strings.ToLower(item.Word)] = true
+	}
+
+	for _, word := range words {
+		word = strings.TrimSpace(word)
+		if word == "" || seen[strings.ToLower(word)] {
+			continue
+		}
+		seen[strings.ToLower(word)] = true
+		list = append(list, &SensitiveWord{AppID: appID, Word: word})
+	}
+	if len(list) < 1 {
+		return nil, errors.New("敏感词为空或已存在")
+	}
+
+	if err = store.SensitiveWords.Create(list); err != nil {
+		return nil, err
+	}
+	store.ReloadSensitiveWords()
+	return
+}
+
+// 按应用缓存的敏感词匹配器
+type sensitiveMatcherCache struct {
+	sync.RWMutex
+	list map[uint]*filter.Matcher
+}
+
+// 敏感词变更后清除匹配器缓存
+func (s *Stores) ReloadSensitiveWords() {
+	cache := s.caches().sensitive
+	cache.Lock()
+	defer cache.Unlock()
+	cache.list = map[uint]*filter.Matcher{}
+}
+
+// 获取应用敏感词匹配器，包含全局敏感词
+func (s *Stores) SensitiveMatcher(appID uint) *filter.Matcher {
+	cache := s.caches().sensitive
+	cache.RLock()
+	m, ok := cache.list[appID]
+	cache.RUnlock()
+	if ok {
+		return m
+	}
+
+	list, err := s.SensitiveWords.List(0, appID)
+	if err != nil {
+		s.Log().Error("sensitive word load error " + err.Error())
+		return nil
+	}
+	words := make([]string, 0, len(list))
+	for _, item := range list {
+		words = append(words, item.Word)
+	}
+	m = filter.NewMatcher(words)
+
+	cache.Lock()
+	cache.list[appID] = m
+	cache.Unlock()
+	return m
+}
+
+// 应用敏感词处理方式，未配置时使用全局配置
+func (s *Stores) SensitiveAction(app *Application) string {
+	if filter.IsAction(app.SensitiveAction) {
+		return app.SensitiveAction
+	}
+	if s.Config != nil && filter.IsAction(s.Config.Filter.Action) {
+		return s.Config.Filter.Action
+	}
+	return filter.ActionReject
+}
+
+// 过滤应用内容，处理方式为 reject 时命中返回 ErrSensitiveContent
+func (s *Stores) FilterContent(app *Application, content string, source string) (string, error) {
+	m := s.SensitiveMatcher(app.ID)
+	if m.Empty() {
+		return content, nil
+	}
+
+	action := s.SensitiveAction(app)
+	masked, matches := m.Mask(content)
+	if len(matches) < 1 {
+		return content, nil
+	}
+	s.LogSensitive(app, source, action, matches)
+
+	switch action {
+	case filter.ActionReject:
+		return content, ErrSensitiveContent
+	case filter.ActionMask:
+		return masked, nil
+	}
+	return content, nil
+}
+
+// 记录敏感词命中日志
+func (s *Stores) LogSensitive(app *Application, source string, action string, matches []filter.Match) {
+	words := []string{}
+	for _, match := range matches {
+		words = append(words, match.Word)
+	}
+	s.Log().Warn("sensitive word hit app#" + strconv.Itoa(int(app.ID)) + " " + source + " " + action + " [" + strings.Join(words, ",") + "]")
+}
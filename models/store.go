@@ -0,0 +1,773 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/models/store.go
+ */
+package models
+
+import (
+	"errors"
+	"gpt-zmide-server/helper"
+	"gpt-zmide-server/helper/filter"
+	"gpt-zmide-server/helper/ratelimit"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 记录不存在，与 gorm.ErrRecordNotFound 一致便于调用方统一判断
+var ErrNotFound = gorm.ErrRecordNotFound
+
+// 应用存储
+type ApplicationStore interface {
+	List() ([]*Application, error)
+	Get(id uint) (*Application, error)
+	GetByName(name string) (*Application, error)
+	GetByKey(key string) (*Application, error) // 按 app_key 或 api_key 查找
+	Create(app *Application) error
+	// 更新应用非零值字段，columns 为需按列更新（包括零值）的字段，更新后重新加载 app
+	Update(app *Application, columns map[string]interface{}) error
+	Count() (int64, error)
+}
+
+// 会话存储
+type ChatStore interface {
+	Get(id uint) (*Chat, error)
+	List(offset, limit int) ([]*Chat, error) // 按 ID 顺序分页，包含所属应用
+	Create(chat *Chat) error
+	Update(chat *Chat) error // 更新非零值字段
+	Count() (int64, error)
+}
+
+// 消息存储
+type MessageStore interface {
+	Create(msg *Message) error
+	ListByChat(chatID uint) ([]*Message, error) // 按 ID 顺序返回会话消息
+	CountByChat(chatID uint) (int64, error)
+	Count() (int64, error)
+}
+
+// 敏感词存储
+type SensitiveWordStore interface {
+	List(appIDs ...uint) ([]*SensitiveWord, error) // 按 ID 倒序，未指定应用时返回全部
+	Create(list []*SensitiveWord) error
+	Delete(id uint) error
+}
+
+// 模型价格存储
+type ModelPriceStore interface {
+	List() ([]*ModelPrice, error) // 按模型及生效时间倒序
+	Get(id uint) (*ModelPrice, error)
+	Create(price *ModelPrice) error
+	// 更新非零值字段，columns 为需按列更新（包括零值）的字段
+	Update(price *ModelPrice, columns map[string]interface{}) error
+	Delete(id uint) error
+}
+
+// 服务端工具存储
+type ToolStore interface {
+	List() ([]*Tool, error) // 按 ID 倒序
+	ListEnabled() ([]*Tool, error)
+	Get(id uint) (*Tool, error)
+	Create(tool *Tool) error
+	// 更新非零值字段，columns 为需按列更新（包括零值）的字段
+	Update(tool *Tool, columns map[string]interface{}) error
+	Delete(id uint) error
+}
+
+// 上游密钥请求结果
+type UpstreamKeyResult struct {
+	Status        int
+	Success       bool
+	Fault         bool // 计入密钥错误次数
+	LastError     string
+	CooldownUntil *LocalTime // 为空时不修改冷却时间
+}
+
+// 上游密钥存储
+type UpstreamKeyStore interface {
+	List(provider string) ([]*UpstreamKey, error) // provider 为空时返回全部
+	ListEnabled() ([]*UpstreamKey, error)
+	Get(id uint) (*UpstreamKey, error)
+	Create(key *UpstreamKey) error
+	// 更新非零值字段，columns 为需按列更新（包括零值）的字段
+	Update(key *UpstreamKey, columns map[string]interface{}) error
+	// 累加请求结果统计
+	Report(id uint, result *UpstreamKeyResult) error
+}
+
+// 应用周期用量及预算告警存储
+type BudgetStore interface {
+	GetUsage(appID uint, period, periodKey string) (*ApplicationUsage, error) // 不存在时返回零值
+	AddUsage(appID uint, period, periodKey string, tokens int64, cost float64) (*ApplicationUsage, error)
+	// 标记周期用量已告警，已标记时返回 false，硬限制告警同时标记软限制
+	MarkAlerted(id uint, kind string) (bool, error)
+	DeleteUsage(appID uint, period, periodKey string) error
+	CreateAlert(alert *BudgetAlert) error
+	ListAlerts(appID uint, limit int) ([]*BudgetAlert, error) // appID 为 0 时返回全部应用
+}
+
+// 用量统计存储，统计上游请求产生的消息及用量记录，时间为零值时不限制
+type UsageStore interface {
+	Record(record *UsageRecord) error                   // 记录不产生对话消息的上游请求用量
+	Total(start, end time.Time) ([]*UsageStat, error)   // 按货币汇总
+	ByModel(start, end time.Time) ([]*UsageStat, error) // 按模型汇总
+	ByApp(start, end time.Time) ([]*UsageStat, error)   // 按应用汇总
+}
+
+// 存储集合，由路由构建时注入控制器
+type Stores struct {
+	Config  *helper.DefaultConfig // 站点及上游配置，为空时无法请求上游
+	Logger  *zap.Logger           // 为空时不输出日志
+	Limiter ratelimit.Store       // 应用限流状态
+
+	OnBudgetAlert func(alert *BudgetAlert) // 预算告警回调，可用于接入通知渠道
+
+	Apps           ApplicationStore
+	Chats          ChatStore
+	Messages       MessageStore
+	SensitiveWords SensitiveWordStore
+	ModelPrices    ModelPriceStore
+	Tools          ToolStore
+	UpstreamKeys   UpstreamKeyStore
+	Budgets        BudgetStore
+	Usage          UsageStore
+
+	conn      *gormConn // 基于 gorm 的存储共用的数据库连接
+	cacheOnce sync.Once
+	cache     *storeCache
+}
+
+// 存储数据的缓存，数据变更后需调用对应的 Reload 方法
+type storeCache struct {
+	sensitive *sensitiveMatcherCache
+	prices    *modelPriceCache
+	keys      *upstreamKeyPool
+}
+
+func (s *Stores) caches() *storeCache {
+	s.cacheOnce.Do(func() {
+		s.cache = &storeCache{
+			sensitive: &sensitiveMatcherCache{list: map[uint]*filter.Matcher{}},
+			prices:    &modelPriceCache{},
+			keys:      &upstreamKeyPool{stores: s},
+		}
+	})
+	return s.cache
+}
+
+// 日志，未设置时不输出
+func (s *Stores) Log() *zap.Logger {
+	if s.Logger == nil {
+		return zap.NewNop()
+	}
+	return s.Logger
+}
+
+// 设置基于 gorm 的存储使用的数据库连接并刷新缓存，用于安装向导完成后连接数据库
+func (s *Stores) SetDB(db *gorm.DB) {
+	if s.conn == nil {
+		return
+	}
+	s.conn.set(db)
+	s.ReloadSensitiveWords()
+	s.ReloadModelPrices()
+	s.ReloadUpstreamKeys()
+}
+
+// 基于 gorm 的存储，db 为 nil 时需在连接数据库后调用 SetDB（安装完成前数据库尚未连接）
+func NewGormStores(db *gorm.DB) *Stores {
+	conn := &gormConn{db: db}
+	return &Stores{
+		Limiter: ratelimit.NewMemoryStore(),
+		conn:    conn,
+
+		Apps:           &gormApplicationStore{conn},
+		Chats:          &gormChatStore{conn},
+		Messages:       &gormMessageStore{conn},
+		SensitiveWords: &gormSensitiveWordStore{conn},
+		ModelPrices:    &gormModelPriceStore{conn},
+		Tools:          &gormToolStore{conn},
+		UpstreamKeys:   &gormUpstreamKeyStore{conn},
+		Budgets:        &gormBudgetStore{conn},
+		Usage:          &gormUsageStore{conn},
+	}
+}
+
+type gormConn struct {
+	mu sync.RWMutex
+	db *gorm.DB
+}
+
+func (conn *gormConn) set(db *gorm.DB) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	conn.db = db
+}
+
+// 获取数据库连接
+func (conn *gormConn) session() (*gorm.DB, error) {
+	conn.mu.RLock()
+	db := conn.db
+	conn.mu.RUnlock()
+	if db == nil {
+		return nil, errors.New("database is not initialized")
+	}
+	return db, nil
+}
+
+// 更新非零值字段及 columns 中的字段，按列更新后重新加载 value
+func (conn *gormConn) update(value interface{}, columns map[string]interface{}) error {
+	db, err := conn.session()
+	if err != nil {
+		return err
+	}
+	if err := db.Updates(value).Error; err != nil {
+		return err
+	}
+	if len(columns) > 0 {
+		if err := db.Model(value).Updates(columns).Error; err != nil {
+			return err
+		}
+		return db.First(value).Error
+	}
+	return nil
+}
+
+type gormApplicationStore struct {
+	*gormConn
+}
+
+func (s *gormApplicationStore) List() (list []*Application, err error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+	err = db.Find(&list).Error
+	return
+}
+
+func (s *gormApplicationStore) Get(id uint) (*Application, error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+	app := &Application{}
+	if err := db.First(app, id).Error; err != nil {
+		return nil, err
+	}
+	return app, nil
+}
+
+func (s *gormApplicationStore) GetByName(name string) (*Application, error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+	app := &Application{}
+	if err := db.Where("name = ?", name).First(app).Error; err != nil {
+		return nil, err
+	}
+	return app, nil
+}
+
+func (s *gormApplicationStore) GetByKey(key string) (*Application, error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+	app := &Application{}
+	if err := db.Where("app_key = ?", key).Or("api_key = ?", key).First(app).Error; err != nil {
+		return nil, err
+	}
+	return app, nil
+}
+
+func (s *gormApplicationStore) Create(app *Application) error {
+	db, err := s.session()
+	if err != nil {
+		return err
+	}
+	return db.Create(app).Error
+}
+
+func (s *gormApplicationStore) Update(app *Application, columns map[string]interface{}) error {
+	return s.update(app, columns)
+}
+
+func (s *gormApplicationStore) Count() (count int64, err error) {
+	db, err := s.session()
+	if err != nil {
+		return 0, err
+	}
+	err = db.Model(&Application{}).Count(&count).Error
+	return
+}
+
+type gormChatStore struct {
+	*gormConn
+}
+
+func (s *gormChatStore) Get(id uint) (*Chat, error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+	chat := &Chat{}
+	if err := db.First(chat, id).Error; err != nil {
+		return nil, err
+	}
+	return chat, nil
+}
+
+func (s *gormChatStore) List(offset, limit int) (list []*Chat, err error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+	err = db.Limit(limit).Offset(offset).Preload("Application").Find(&list).Error
+	return
+}
+
+func (s *gormChatStore) Create(chat *Chat) error {
+	db, err := s.session()
+	if err != nil {
+		return err
+	}
+	return db.Create(chat).Error
+}
+
+func (s *gormChatStore) Update(chat *Chat) error {
+	db, err := s.session()
+	if err != nil {
+		return err
+	}
+	return db.Updates(chat).Error
+}
+
+func (s *gormChatStore) Count() (count int64, err error) {
+	db, err := s.session()
+	if err != nil {
+		return 0, err
+	}
+	err = db.Model(&Chat{}).Count(&count).Error
+	return
+}
+
+type gormMessageStore struct {
+	*gormConn
+}
+
+func (s *gormMessageStore) Create(msg *Message) error {
+	db, err := s.session()
+	if err != nil {
+		return err
+	}
+	return db.Create(msg).Error
+}
+
+func (s *gormMessageStore) ListByChat(chatID uint) (list []*Message, err error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+	err = db.Where("chat_id = ?", chatID).Order("id asc").Find(&list).Error
+	return
+}
+
+func (s *gormMessageStore) CountByChat(chatID uint) (count int64, err error) {
+	db, err := s.session()
+	if err != nil {
+		return 0, err
+	}
+	err = db.Model(&Message{}).Where("chat_id = ?", chatID).Count(&count).Error
+	return
+}
+
+func (s *gormMessageStore) Count() (count int64, err error) {
+	db, err := s.session()
+	if err != nil {
+		return 0, err
+	}
+	err = db.Model(&Message{}).Count(&count).Error
+	return
+}
+
+type gormSensitiveWordStore struct {
+	*gormConn
+}
+
+func (s *gormSensitiveWordStore) List(appIDs ...uint) (list []*SensitiveWord, err error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+	query := db.Order("id desc")
+	if len(appIDs) > 0 {
+		query = query.Where("app_id IN ?", appIDs)
+	}
+	err = query.Find(&list).Error
+	return
+}
+
+func (s *gormSensitiveWordStore) Create(list []*SensitiveWord) error {
+	db, err := s.session()
+	if err != nil {
+		return err
+	}
+	return db.Create(&list).Error
+}
+
+func (s *gormSensitiveWordStore) Delete(id uint) error {
+	db, err := s.session()
+	if err != nil {
+		return err
+	}
+	return db.Delete(&SensitiveWord{}, id).Error
+}
+
+type gormModelPriceStore struct {
+	*gormConn
+}
+
+func (s *gormModelPriceStore) List() (list []*ModelPrice, err error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+	err = db.Order("model ASC, effective_from DESC").Find(&list).Error
+	return
+}
+
+func (s *gormModelPriceStore) Get(id uint) (*ModelPrice, error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+	price := &ModelPrice{}
+	if err := db.First(price, id).Error; err != nil {
+		return nil, err
+	}
+	return price, nil
+}
+
+func (s *gormModelPriceStore) Create(price *ModelPrice) error {
+	db, err := s.session()
+	if err != nil {
+		return err
+	}
+	return db.Create(price).Error
+}
+
+func (s *gormModelPriceStore) Update(price *ModelPrice, columns map[string]interface{}) error {
+	return s.update(price, columns)
+}
+
+func (s *gormModelPriceStore) Delete(id uint) error {
+	db, err := s.session()
+	if err != nil {
+		return err
+	}
+	return db.Delete(&ModelPrice{}, id).Error
+}
+
+type gormToolStore struct {
+	*gormConn
+}
+
+func (s *gormToolStore) List() (list []*Tool, err error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+	err = db.Order("id desc").Find(&list).Error
+	return
+}
+
+func (s *gormToolStore) ListEnabled() (list []*Tool, err error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+	err = db.Where("status = ?", 1).Find(&list).Error
+	return
+}
+
+func (s *gormToolStore) Get(id uint) (*Tool, error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+	tool := &Tool{}
+	if err := db.First(tool, id).Error; err != nil {
+		return nil, err
+	}
+	return tool, nil
+}
+
+func (s *gormToolStore) Create(tool *Tool) error {
+	db, err := s.session()
+	if err != nil {
+		return err
+	}
+	return db.Create(tool).Error
+}
+
+func (s *gormToolStore) Update(tool *Tool, columns map[string]interface{}) error {
+	return s.update(tool, columns)
+}
+
+func (s *gormToolStore) Delete(id uint) error {
+	db, err := s.session()
+	if err != nil {
+		return err
+	}
+	return db.Delete(&Tool{}, id).Error
+}
+
+type gormUpstreamKeyStore struct {
+	*gormConn
+}
+
+func (s *gormUpstreamKeyStore) List(provider string) (list []*UpstreamKey, err error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+	if provider != "" {
+		db = db.Where("provider = ?", provider)
+	}
+	err = db.Find(&list).Error
+	return
+}
+
+func (s *gormUpstreamKeyStore) ListEnabled() (list []*UpstreamKey, err error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+	err = db.Where("status = ?", 1).Find(&list).Error
+	return
+}
+
+func (s *gormUpstreamKeyStore) Get(id uint) (*UpstreamKey, error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+	key := &UpstreamKey{}
+	if err := db.First(key, id).Error; err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (s *gormUpstreamKeyStore) Create(key *UpstreamKey) error {
+	db, err := s.session()
+	if err != nil {
+		return err
+	}
+	return db.Create(key).Error
+}
+
+func (s *gormUpstreamKeyStore) Update(key *UpstreamKey, columns map[string]interface{}) error {
+	return s.update(key, columns)
+}
+
+func (s *gormUpstreamKeyStore) Report(id uint, result *UpstreamKeyResult) error {
+	db, err := s.session()
+	if err != nil {
+		return err
+	}
+	updates := map[string]interface{}{"last_status": result.Status}
+	if result.Success {
+		updates["success_count"] = gorm.Expr("success_count + 1")
+		updates["consecutive_errors"] = 0
+		updates["last_error"] = ""
+	} else if result.Fault {
+		updates["error_count"] = gorm.Expr("error_count + 1")
+		updates["consecutive_errors"] = gorm.Expr("consecutive_errors + 1")
+		updates["last_error"] = result.LastError
+	}
+	if result.CooldownUntil != nil {
+		updates["cooldown_until"] = result.CooldownUntil
+	}
+	return db.Model(&UpstreamKey{ID: id}).Updates(updates).Error
+}
+
+type gormBudgetStore struct {
+	*gormConn
+}
+
+func (s *gormBudgetStore) GetUsage(appID uint, period, periodKey string) (*ApplicationUsage, error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+	usage := &ApplicationUsage{AppID: appID, Period: period, PeriodKey: periodKey}
+	err = db.Where(usage).Limit(1).Find(usage).Error
+	return usage, err
+}
+
+func (s *gormBudgetStore) AddUsage(appID uint, period, periodKey string, tokens int64, cost float64) (*ApplicationUsage, error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+	usage := &ApplicationUsage{AppID: appID, Period: period, PeriodKey: periodKey}
+	increase := func() (int64, error) {
+		res := db.Model(&ApplicationUsage{}).Where(usage).Updates(map[string]interface{}{
+			"tokens": gorm.Expr("tokens + ?", tokens),
+			"cost":   gorm.Expr("cost + ?", cost),
+		})
+		return res.RowsAffected, res.Error
+	}
+
+	affected, err := increase()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		created := &ApplicationUsage{AppID: appID, Period: period, PeriodKey: periodKey, Tokens: tokens, Cost: cost}
+		if err = db.Create(created).Error; err != nil {
+			// 并发创建时唯一索引冲突，改为累加
+			if _, err = increase(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err = db.Where(usage).First(usage).Error; err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+func (s *gormBudgetStore) MarkAlerted(id uint, kind string) (bool, error) {
+	db, err := s.session()
+	if err != nil {
+		return false, err
+	}
+	// 通过条件更新保证并发时只标记一次
+	flags := map[string]interface{}{"soft_alerted": true}
+	column := "soft_alerted"
+	if kind == BudgetAlertHard {
+		flags["hard_alerted"] = true
+		column = "hard_alerted"
+	}
+	res := db.Model(&ApplicationUsage{}).Where("id = ? AND "+column+" = ?", id, false).Updates(flags)
+	return res.RowsAffected > 0, res.Error
+}
+
+func (s *gormBudgetStore) DeleteUsage(appID uint, period, periodKey string) error {
+	db, err := s.session()
+	if err != nil {
+		return err
+	}
+	return db.Where("app_id = ? AND period = ? AND period_key = ?", appID, period, periodKey).
+		Delete(&ApplicationUsage{}).Error
+}
+
+func (s *gormBudgetStore) CreateAlert(alert *BudgetAlert) error {
+	db, err := s.session()
+	if err != nil {
+		return err
+	}
+	return db.Create(alert).Error
+}
+
+func (s *gormBudgetStore) ListAlerts(appID uint, limit int) (list []*BudgetAlert, err error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+	query := db.Order("id DESC").Limit(limit)
+	if appID != 0 {
+		query = query.Where("app_id = ?", appID)
+	}
+	err = query.Find(&list).Error
+	return
+}
+
+type gormUsageStore struct {
+	*gormConn
+}
+
+func (s *gormUsageStore) Record(record *UsageRecord) error {
+	db, err := s.session()
+	if err != nil {
+		return err
+	}
+	return db.Create(record).Error
+}
+
+// 按时间范围筛选 table 中的记录
+func usageRange(query *gorm.DB, table string, start, end time.Time) *gorm.DB {
+	if !start.IsZero() {
+		query = query.Where(table+".created_at >= ?", start)
+	}
+	if !end.IsZero() {
+		query = query.Where(table+".created_at < ?", end)
+	}
+	return query
+}
+
+// 分别汇总上游请求产生的消息（回复及摘要）及用量记录后合并，group 为 table 对应的分组字段
+func (s *gormUsageStore) stat(start, end time.Time, fields, group func(table string) string) ([]*UsageStat, error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+	var messages, records []*UsageStat
+	err = usageRange(db.Model(&Message{}), "messages", start, end).
+		Where(usageMessageWhere, "assistant", true).
+		Select(fields("messages") + usageStatFields("messages")).
+		Joins("LEFT JOIN chats ON chats.id = messages.chat_id").
+		Joins("LEFT JOIN applications ON applications.id = chats.app_id").
+		Group(group("messages")).
+		Scan(&messages).Error
+	if err != nil {
+		return nil, err
+	}
+	err = usageRange(db.Model(&UsageRecord{}), "usage_records", start, end).
+		Select(fields("usage_records") + usageStatFields("usage_records")).
+		Joins("LEFT JOIN applications ON applications.id = usage_records.app_id").
+		Group(group("usage_records")).
+		Scan(&records).Error
+	if err != nil {
+		return nil, err
+	}
+	return sortUsageByCost(mergeUsageStats(messages, records)), nil
+}
+
+// 记录所属应用字段，消息通过对话关联应用
+func usageAppColumn(table string) string {
+	if table == "messages" {
+		return "chats.app_id"
+	}
+	return table + ".app_id"
+}
+
+func (s *gormUsageStore) Total(start, end time.Time) ([]*UsageStat, error) {
+	return s.stat(start, end,
+		func(table string) string { return "" },
+		func(table string) string { return table + ".currency" })
+}
+
+func (s *gormUsageStore) ByModel(start, end time.Time) ([]*UsageStat, error) {
+	return s.stat(start, end,
+		func(table string) string { return table + ".model AS model, " },
+		func(table string) string { return table + ".model, " + table + ".currency" })
+}
+
+func (s *gormUsageStore) ByApp(start, end time.Time) ([]*UsageStat, error) {
+	return s.stat(start, end,
+		func(table string) string {
+			return usageAppColumn(table) + " AS app_id, applications.name AS app_name, "
+		},
+		func(table string) string {
+			return usageAppColumn(table) + ", applications.name, " + table + ".currency"
+		})
+}
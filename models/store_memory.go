@@ -0,0 +1,798 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/models/store_memory.go
+ */
+package models
+
+import (
+	"context"
+	"errors"
+	"gpt-zmide-server/helper/ratelimit"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm/schema"
+)
+
+// 基于内存的存储，用于测试及无需持久化的扩展，重启后数据丢失
+func NewMemoryStores() *Stores {
+	apps := &memoryApplicationStore{rows: map[uint]*Application{}}
+	chats := &memoryChatStore{apps: apps, rows: map[uint]*Chat{}}
+	messages := &memoryMessageStore{rows: map[uint]*Message{}}
+	return &Stores{
+		Limiter: ratelimit.NewMemoryStore(),
+
+		Apps:           apps,
+		Chats:          chats,
+		Messages:       messages,
+		SensitiveWords: &memorySensitiveWordStore{rows: map[uint]*SensitiveWord{}},
+		ModelPrices:    &memoryModelPriceStore{rows: map[uint]*ModelPrice{}},
+		Tools:          &memoryToolStore{rows: map[uint]*Tool{}},
+		UpstreamKeys:   &memoryUpstreamKeyStore{rows: map[uint]*UpstreamKey{}},
+		Budgets:        &memoryBudgetStore{usages: map[uint]*ApplicationUsage{}},
+		Usage:          &memoryUsageStore{apps: apps, chats: chats, messages: messages},
+	}
+}
+
+var schemaCache = &sync.Map{}
+
+// 按 gorm 规则更新字段：src 非零值字段及 columns 中的字段（按列名）写入 dst
+func updateFields(dst, src interface{}, columns map[string]interface{}) error {
+	s, err := schema.Parse(dst, schemaCache, schema.NamingStrategy{})
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	dstValue, srcValue := reflect.ValueOf(dst).Elem(), reflect.ValueOf(src).Elem()
+	for _, field := range s.Fields {
+		if field.DBName == "" || field.PrimaryKey {
+			continue
+		}
+		if value, isZero := field.ValueOf(ctx, srcValue); !isZero {
+			if err := field.Set(ctx, dstValue, value); err != nil {
+				return err
+			}
+		}
+	}
+	for column, value := range columns {
+		field := s.LookUpField(column)
+		if field == nil {
+			return errors.New("unknown column " + column)
+		}
+		if err := field.Set(ctx, dstValue, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type memoryApplicationStore struct {
+	mu     sync.RWMutex
+	rows   map[uint]*Application
+	lastID uint
+}
+
+func (s *memoryApplicationStore) find(match func(app *Application) bool) (*Application, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, row := range s.rows {
+		if match(row) {
+			app := *row
+			return &app, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memoryApplicationStore) List() ([]*Application, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]*Application, 0, len(s.rows))
+	for _, row := range s.rows {
+		app := *row
+		list = append(list, &app)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (s *memoryApplicationStore) Get(id uint) (*Application, error) {
+	return s.find(func(app *Application) bool { return app.ID == id })
+}
+
+func (s *memoryApplicationStore) GetByName(name string) (*Application, error) {
+	return s.find(func(app *Application) bool { return app.Name == name })
+}
+
+func (s *memoryApplicationStore) GetByKey(key string) (*Application, error) {
+	return s.find(func(app *Application) bool { return app.AppKey == key || app.ApiKey == key })
+}
+
+func (s *memoryApplicationStore) Create(app *Application) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if app.ID == 0 {
+		s.lastID++
+		app.ID = s.lastID
+	} else if _, ok := s.rows[app.ID]; ok {
+		return errors.New("duplicate application id")
+	} else if app.ID > s.lastID {
+		s.lastID = app.ID
+	}
+	now := LocalTime{time.Now()}
+	app.CreatedAt, app.UpdatedAt = now, now
+	row := *app
+	s.rows[app.ID] = &row
+	return nil
+}
+
+func (s *memoryApplicationStore) Update(app *Application, columns map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	row, ok := s.rows[app.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	updated := *row
+	if err := updateFields(&updated, app, columns); err != nil {
+		return err
+	}
+	updated.UpdatedAt = LocalTime{time.Now()}
+	s.rows[app.ID] = &updated
+	*app = updated
+	return nil
+}
+
+func (s *memoryApplicationStore) Count() (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return int64(len(s.rows)), nil
+}
+
+type memoryChatStore struct {
+	apps   *memoryApplicationStore
+	mu     sync.RWMutex
+	rows   map[uint]*Chat
+	lastID uint
+}
+
+// 仅保存会话字段，不保存关联数据及请求状态
+func storedChat(chat *Chat) *Chat {
+	return &Chat{
+		ID:        chat.ID,
+		AppID:     chat.AppID,
+		Remark:    chat.Remark,
+		Model:     chat.Model,
+		BaseModel: chat.BaseModel,
+	}
+}
+
+func (s *memoryChatStore) Get(id uint) (*Chat, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	row, ok := s.rows[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return storedChat(row), nil
+}
+
+func (s *memoryChatStore) List(offset, limit int) ([]*Chat, error) {
+	s.mu.RLock()
+	list := make([]*Chat, 0, len(s.rows))
+	for _, row := range s.rows {
+		list = append(list, storedChat(row))
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	if offset >= len(list) {
+		return []*Chat{}, nil
+	}
+	list = list[offset:]
+	if limit >= 0 && limit < len(list) {
+		list = list[:limit]
+	}
+	for _, chat := range list {
+		if app, err := s.apps.Get(chat.AppID); err == nil {
+			chat.Application = app
+		}
+	}
+	return list, nil
+}
+
+func (s *memoryChatStore) Create(chat *Chat) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if chat.ID == 0 {
+		s.lastID++
+		chat.ID = s.lastID
+	} else if _, ok := s.rows[chat.ID]; ok {
+		return errors.New("duplicate chat id")
+	} else if chat.ID > s.lastID {
+		s.lastID = chat.ID
+	}
+	now := LocalTime{time.Now()}
+	chat.CreatedAt, chat.UpdatedAt = now, now
+	s.rows[chat.ID] = storedChat(chat)
+	return nil
+}
+
+func (s *memoryChatStore) Update(chat *Chat) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	row, ok := s.rows[chat.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	updated := storedChat(row)
+	if err := updateFields(updated, storedChat(chat), nil); err != nil {
+		return err
+	}
+	updated.UpdatedAt = LocalTime{time.Now()}
+	s.rows[chat.ID] = updated
+	chat.UpdatedAt = updated.UpdatedAt
+	return nil
+}
+
+func (s *memoryChatStore) Count() (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return int64(len(s.rows)), nil
+}
+
+type memoryMessageStore struct {
+	mu     sync.RWMutex
+	rows   map[uint]*Message
+	lastID uint
+}
+
+func (s *memoryMessageStore) Create(msg *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if msg.ID == 0 {
+		s.lastID++
+		msg.ID = s.lastID
+	} else if _, ok := s.rows[msg.ID]; ok {
+		return errors.New("duplicate message id")
+	} else if msg.ID > s.lastID {
+		s.lastID = msg.ID
+	}
+	now := LocalTime{time.Now()}
+	msg.CreatedAt, msg.UpdatedAt = now, now
+	row := *msg
+	s.rows[msg.ID] = &row
+	return nil
+}
+
+func (s *memoryMessageStore) ListByChat(chatID uint) ([]*Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := []*Message{}
+	for _, row := range s.rows {
+		if row.ChatID == chatID {
+			msg := *row
+			list = append(list, &msg)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (s *memoryMessageStore) CountByChat(chatID uint) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var count int64
+	for _, row := range s.rows {
+		if row.ChatID == chatID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *memoryMessageStore) Count() (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return int64(len(s.rows)), nil
+}
+
+type memorySensitiveWordStore struct {
+	mu     sync.RWMutex
+	rows   map[uint]*SensitiveWord
+	lastID uint
+}
+
+func (s *memorySensitiveWordStore) List(appIDs ...uint) ([]*SensitiveWord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := []*SensitiveWord{}
+	for _, row := range s.rows {
+		match := len(appIDs) < 1
+		for _, id := range appIDs {
+			match = match || row.AppID == id
+		}
+		if match {
+			word := *row
+			list = append(list, &word)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID > list[j].ID })
+	return list, nil
+}
+
+func (s *memorySensitiveWordStore) Create(list []*SensitiveWord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := LocalTime{time.Now()}
+	for _, word := range list {
+		s.lastID++
+		word.ID = s.lastID
+		word.CreatedAt, word.UpdatedAt = now, now
+		row := *word
+		s.rows[word.ID] = &row
+	}
+	return nil
+}
+
+func (s *memorySensitiveWordStore) Delete(id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.rows, id)
+	return nil
+}
+
+type memoryModelPriceStore struct {
+	mu     sync.RWMutex
+	rows   map[uint]*ModelPrice
+	lastID uint
+}
+
+func (s *memoryModelPriceStore) List() ([]*ModelPrice, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]*ModelPrice, 0, len(s.rows))
+	for _, row := range s.rows {
+		price := *row
+		list = append(list, &price)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Model != list[j].Model {
+			return list[i].Model < list[j].Model
+		}
+		return effectiveFrom(list[i]).After(effectiveFrom(list[j]))
+	})
+	return list, nil
+}
+
+func (s *memoryModelPriceStore) Get(id uint) (*ModelPrice, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	row, ok := s.rows[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	price := *row
+	return &price, nil
+}
+
+func (s *memoryModelPriceStore) Create(price *ModelPrice) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	price.ID = s.lastID
+	now := LocalTime{time.Now()}
+	price.CreatedAt, price.UpdatedAt = now, now
+	row := *price
+	s.rows[price.ID] = &row
+	return nil
+}
+
+func (s *memoryModelPriceStore) Update(price *ModelPrice, columns map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	row, ok := s.rows[price.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	updated := *row
+	if err := updateFields(&updated, price, columns); err != nil {
+		return err
+	}
+	updated.UpdatedAt = LocalTime{time.Now()}
+	s.rows[price.ID] = &updated
+	*price = updated
+	return nil
+}
+
+func (s *memoryModelPriceStore) Delete(id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.rows, id)
+	return nil
+}
+
+type memoryToolStore struct {
+	mu     sync.RWMutex
+	rows   map[uint]*Tool
+	lastID uint
+}
+
+func (s *memoryToolStore) list(match func(tool *Tool) bool) []*Tool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := []*Tool{}
+	for _, row := range s.rows {
+		if match(row) {
+			tool := *row
+			list = append(list, &tool)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID > list[j].ID })
+	return list
+}
+
+func (s *memoryToolStore) List() ([]*Tool, error) {
+	return s.list(func(tool *Tool) bool { return true }), nil
+}
+
+func (s *memoryToolStore) ListEnabled() ([]*Tool, error) {
+	return s.list(func(tool *Tool) bool { return tool.Status == 1 }), nil
+}
+
+func (s *memoryToolStore) Get(id uint) (*Tool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	row, ok := s.rows[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	tool := *row
+	return &tool, nil
+}
+
+// 工具名唯一
+func (s *memoryToolStore) checkName(tool *Tool) error {
+	for _, row := range s.rows {
+		if row.ID != tool.ID && row.Name == tool.Name {
+			return errors.New("duplicate tool name " + tool.Name)
+		}
+	}
+	return nil
+}
+
+func (s *memoryToolStore) Create(tool *Tool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkName(tool); err != nil {
+		return err
+	}
+	s.lastID++
+	tool.ID = s.lastID
+	now := LocalTime{time.Now()}
+	tool.CreatedAt, tool.UpdatedAt = now, now
+	row := *tool
+	s.rows[tool.ID] = &row
+	return nil
+}
+
+func (s *memoryToolStore) Update(tool *Tool, columns map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	row, ok := s.rows[tool.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	updated := *row
+	if err := updateFields(&updated, tool, columns); err != nil {
+		return err
+	}
+	if err := s.checkName(&updated); err != nil {
+		return err
+	}
+	updated.UpdatedAt = LocalTime{time.Now()}
+	s.rows[tool.ID] = &updated
+	*tool = updated
+	return nil
+}
+
+func (s *memoryToolStore) Delete(id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.rows, id)
+	return nil
+}
+
+type memoryUpstreamKeyStore struct {
+	mu     sync.RWMutex
+	rows   map[uint]*UpstreamKey
+	lastID uint
+}
+
+func (s *memoryUpstreamKeyStore) list(match func(key *UpstreamKey) bool) []*UpstreamKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := []*UpstreamKey{}
+	for _, row := range s.rows {
+		if match(row) {
+			key := *row
+			list = append(list, &key)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+func (s *memoryUpstreamKeyStore) List(provider string) ([]*UpstreamKey, error) {
+	return s.list(func(key *UpstreamKey) bool { return provider == "" || key.Provider == provider }), nil
+}
+
+func (s *memoryUpstreamKeyStore) ListEnabled() ([]*UpstreamKey, error) {
+	return s.list(func(key *UpstreamKey) bool { return key.Status == 1 }), nil
+}
+
+func (s *memoryUpstreamKeyStore) Get(id uint) (*UpstreamKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	row, ok := s.rows[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	key := *row
+	return &key, nil
+}
+
+func (s *memoryUpstreamKeyStore) Create(key *UpstreamKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	key.ID = s.lastID
+	now := LocalTime{time.Now()}
+	key.CreatedAt, key.UpdatedAt = now, now
+	row := *key
+	s.rows[key.ID] = &row
+	return nil
+}
+
+func (s *memoryUpstreamKeyStore) Update(key *UpstreamKey, columns map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	row, ok := s.rows[key.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	updated := *row
+	if err := updateFields(&updated, key, columns); err != nil {
+		return err
+	}
+	updated.UpdatedAt = LocalTime{time.Now()}
+	s.rows[key.ID] = &updated
+	*key = updated
+	return nil
+}
+
+func (s *memoryUpstreamKeyStore) Report(id uint, result *UpstreamKeyResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	row, ok := s.rows[id]
+	if !ok {
+		return ErrNotFound
+	}
+	row.LastStatus = result.Status
+	if result.Success {
+		row.SuccessCount++
+		row.ConsecutiveErrors = 0
+		row.LastError = ""
+	} else if result.Fault {
+		row.ErrorCount++
+		row.ConsecutiveErrors++
+		row.LastError = result.LastError
+	}
+	if result.CooldownUntil != nil {
+		row.CooldownUntil = result.CooldownUntil
+	}
+	row.UpdatedAt = LocalTime{time.Now()}
+	return nil
+}
+
+type memoryBudgetStore struct {
+	mu          sync.Mutex
+	usages      map[uint]*ApplicationUsage
+	alerts      []*BudgetAlert
+	lastUsageID uint
+}
+
+func (s *memoryBudgetStore) findUsage(appID uint, period, periodKey string) *ApplicationUsage {
+	for _, row := range s.usages {
+		if row.AppID == appID && row.Period == period && row.PeriodKey == periodKey {
+			return row
+		}
+	}
+	return nil
+}
+
+func (s *memoryBudgetStore) GetUsage(appID uint, period, periodKey string) (*ApplicationUsage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if row := s.findUsage(appID, period, periodKey); row != nil {
+		usage := *row
+		return &usage, nil
+	}
+	return &ApplicationUsage{AppID: appID, Period: period, PeriodKey: periodKey}, nil
+}
+
+func (s *memoryBudgetStore) AddUsage(appID uint, period, periodKey string, tokens int64, cost float64) (*ApplicationUsage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := LocalTime{time.Now()}
+	row := s.findUsage(appID, period, periodKey)
+	if row == nil {
+		s.lastUsageID++
+		row = &ApplicationUsage{ID: s.lastUsageID, AppID: appID, Period: period, PeriodKey: periodKey}
+		row.CreatedAt = now
+		s.usages[row.ID] = row
+	}
+	row.Tokens += tokens
+	row.Cost += cost
+	row.UpdatedAt = now
+	usage := *row
+	return &usage, nil
+}
+
+func (s *memoryBudgetStore) MarkAlerted(id uint, kind string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	row, ok := s.usages[id]
+	if !ok {
+		return false, nil
+	}
+	if kind == BudgetAlertHard {
+		if row.HardAlerted {
+			return false, nil
+		}
+		row.SoftAlerted, row.HardAlerted = true, true
+		return true, nil
+	}
+	if row.SoftAlerted {
+		return false, nil
+	}
+	row.SoftAlerted = true
+	return true, nil
+}
+
+func (s *memoryBudgetStore) DeleteUsage(appID uint, period, periodKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if row := s.findUsage(appID, period, periodKey); row != nil {
+		delete(s.usages, row.ID)
+	}
+	return nil
+}
+
+func (s *memoryBudgetStore) CreateAlert(alert *BudgetAlert) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	alert.ID = uint(len(s.alerts) + 1)
+	now := LocalTime{time.Now()}
+	alert.CreatedAt, alert.UpdatedAt = now, now
+	row := *alert
+	s.alerts = append(s.alerts, &row)
+	return nil
+}
+
+func (s *memoryBudgetStore) ListAlerts(appID uint, limit int) ([]*BudgetAlert, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := []*BudgetAlert{}
+	for i := len(s.alerts) - 1; i >= 0 && (limit < 0 || len(list) < limit); i-- {
+		if appID == 0 || s.alerts[i].AppID == appID {
+			alert := *s.alerts[i]
+			list = append(list, &alert)
+		}
+	}
+	return list, nil
+}
+
+type memoryUsageStore struct {
+	apps     *memoryApplicationStore
+	chats    *memoryChatStore
+	messages *memoryMessageStore
+
+	mu      sync.RWMutex
+	records []*UsageRecord
+	lastID  uint
+}
+
+func (s *memoryUsageStore) Record(record *UsageRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	record.ID = s.lastID
+	now := LocalTime{Time: time.Now()}
+	record.CreatedAt, record.UpdatedAt = now, now
+	row := *record
+	s.records = append(s.records, &row)
+	return nil
+}
+
+// 统计行，消息及用量记录统一转换后汇总
+type usageRow struct {
+	appID     uint
+	createdAt time.Time
+	stat      UsageStat
+}
+
+// 上游请求产生的消息（回复及摘要）及用量记录，消息在前，各自按 ID 排序
+func (s *memoryUsageStore) rows() []*usageRow {
+	s.messages.mu.RLock()
+	messages := make([]*Message, 0, len(s.messages.rows))
+	for _, row := range s.messages.rows {
+		messages = append(messages, row)
+	}
+	s.messages.mu.RUnlock()
+	sort.Slice(messages, func(i, j int) bool { return messages[i].ID < messages[j].ID })
+
+	rows := []*usageRow{}
+	for _, msg := range messages {
+		if !isUsageMessage(msg) {
+			continue
+		}
+		row := &usageRow{createdAt: msg.CreatedAt.Time, stat: UsageStat{
+			Model: msg.Model, Currency: msg.Currency, Requests: 1,
+			PromptTokens: msg.PromptTokens, CompletionTokens: msg.CompletionTokens, TotalTokens: msg.TotalTokens, Cost: msg.Cost,
+		}}
+		if chat, err := s.chats.Get(msg.ChatID); err == nil {
+			row.appID = chat.AppID
+		}
+		rows = append(rows, row)
+	}
+
+	s.mu.RLock()
+	for _, record := range s.records {
+		rows = append(rows, &usageRow{appID: record.AppID, createdAt: record.CreatedAt.Time, stat: UsageStat{
+			Model: record.Model, Currency: record.Currency, Requests: 1,
+			PromptTokens: record.PromptTokens, CompletionTokens: record.CompletionTokens, TotalTokens: record.TotalTokens, Cost: record.Cost,
+		}})
+	}
+	s.mu.RUnlock()
+	return rows
+}
+
+// 按 key 汇总时间范围内的用量，返回顺序与首次出现顺序一致
+func (s *memoryUsageStore) stat(start, end time.Time, key func(row *usageRow) *UsageStat) []*UsageStat {
+	items := []*UsageStat{}
+	for _, row := range s.rows() {
+		if (!start.IsZero() && row.createdAt.Before(start)) ||
+			(!end.IsZero() && !row.createdAt.Before(end)) {
+			continue
+		}
+		item := row.stat
+		group := key(row)
+		item.AppID, item.AppName, item.Model = group.AppID, group.AppName, group.Model
+		items = append(items, &item)
+	}
+	return mergeUsageStats(items)
+}
+
+func (s *memoryUsageStore) Total(start, end time.Time) ([]*UsageStat, error) {
+	return s.stat(start, end, func(row *usageRow) *UsageStat { return &UsageStat{} }), nil
+}
+
+func (s *memoryUsageStore) ByModel(start, end time.Time) ([]*UsageStat, error) {
+	list := s.stat(start, end, func(row *usageRow) *UsageStat { return &UsageStat{Model: row.stat.Model} })
+	return sortUsageByCost(list), nil
+}
+
+func (s *memoryUsageStore) ByApp(start, end time.Time) ([]*UsageStat, error) {
+	list := s.stat(start, end, func(row *usageRow) *UsageStat {
+		stat := &UsageStat{AppID: row.appID}
+		if app, err := s.apps.Get(row.appID); err == nil {
+			stat.AppName = app.Name
+		}
+		return stat
+	})
+	return sortUsageByCost(list), nil
+}
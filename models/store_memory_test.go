@@ -0,0 +1,258 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/models/store_memory_test.go
+ */
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// 内存存储与 gorm 存储行为一致，同一组用例分别在两者上运行
+func eachStores(t *testing.T, run func(t *testing.T, s *Stores)) {
+	t.Run("memory", func(t *testing.T) {
+		run(t, NewMemoryStores())
+	})
+	t.Run("gorm", func(t *testing.T) {
+		db := openTestDB(t)
+		if _, err := MigrateUp(db); err != nil {
+			t.Fatal(err)
+		}
+		run(t, NewGormStores(db))
+	})
+}
+
+func TestApplicationStore(t *testing.T) {
+	eachStores(t, func(t *testing.T, s *Stores) {
+		app, err := CreateApplication(s.Apps, "first")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if app.ID == 0 || app.Status != 1 {
+			t.Fatalf("created app %+v", app)
+		}
+		if _, err := CreateApplication(s.Apps, "first"); err == nil {
+			t.Fatal("duplicate application name accepted")
+		}
+
+		found, err := s.Apps.GetByKey(app.ApiKey)
+		if err != nil || found.ID != app.ID {
+			t.Fatalf("get by api key %+v %v", found, err)
+		}
+		if _, err := s.Apps.Get(app.ID + 100); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("get missing app error %v", err)
+		}
+
+		// 返回副本，修改不影响已保存数据
+		found.Name = "changed"
+		if stored, _ := s.Apps.Get(app.ID); stored.Name != "first" {
+			t.Fatalf("stored name %q", stored.Name)
+		}
+
+		// 更新非零值字段，零值需通过 columns 指定
+		update := &Application{ID: app.ID}
+		update.DefaultModel = "gpt-4o"
+		if err = s.Apps.Update(update, nil); err != nil {
+			t.Fatal(err)
+		}
+		err = s.Apps.Update(&Application{ID: app.ID}, map[string]interface{}{"status": uint(0)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored, _ := s.Apps.Get(app.ID)
+		if stored.DefaultModel != "gpt-4o" || stored.Status != 0 || stored.Name != "first" {
+			t.Fatalf("updated app %+v", stored)
+		}
+
+		if _, err := CreateApplication(s.Apps, "second"); err != nil {
+			t.Fatal(err)
+		}
+		list, _ := s.Apps.List()
+		if count, _ := s.Apps.Count(); count != 2 || len(list) != 2 || list[0].ID != app.ID {
+			t.Fatalf("list %d apps, count %d", len(list), count)
+		}
+	})
+}
+
+func TestChatMessageStore(t *testing.T) {
+	eachStores(t, func(t *testing.T, s *Stores) {
+		app, err := CreateApplication(s.Apps, "app")
+		if err != nil {
+			t.Fatal(err)
+		}
+		chats := []*Chat{}
+		for i := 0; i < 3; i++ {
+			chat := &Chat{AppID: app.ID, Model: "gpt-4o-mini"}
+			if err := s.Chats.Create(chat); err != nil {
+				t.Fatal(err)
+			}
+			chats = append(chats, chat)
+		}
+
+		// 分页按 ID 顺序并包含所属应用
+		list, err := s.Chats.List(1, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != 1 || list[0].ID != chats[1].ID || list[0].Application == nil || list[0].Application.Name != "app" {
+			t.Fatalf("chat page %+v", list)
+		}
+
+		if err := s.Chats.Update(&Chat{ID: chats[0].ID, Remark: "renamed"}); err != nil {
+			t.Fatal(err)
+		}
+		if chat, _ := s.Chats.Get(chats[0].ID); chat.Remark != "renamed" || chat.Model != "gpt-4o-mini" {
+			t.Fatalf("updated chat %+v", chat)
+		}
+
+		for _, role := range []string{"user", "assistant", "user"} {
+			if err := s.Messages.Create(&Message{ChatID: chats[0].ID, Role: role}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		s.Messages.Create(&Message{ChatID: chats[1].ID, Role: "user"})
+
+		messages, err := s.Messages.ListByChat(chats[0].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(messages) != 3 || messages[1].Role != "assistant" || messages[0].ID > messages[2].ID {
+			t.Fatalf("chat messages %+v", messages)
+		}
+		if count, _ := s.Messages.CountByChat(chats[0].ID); count != 3 {
+			t.Fatalf("chat message count %d", count)
+		}
+		if count, _ := s.Messages.Count(); count != 4 {
+			t.Fatalf("message count %d", count)
+		}
+	})
+}
+
+func TestBudgetStore(t *testing.T) {
+	eachStores(t, func(t *testing.T, s *Stores) {
+		if usage, err := s.Budgets.GetUsage(1, BudgetPeriodDaily, "20261017"); err != nil || usage.ID != 0 || usage.Tokens != 0 {
+			t.Fatalf("empty usage %+v %v", usage, err)
+		}
+		s.Budgets.AddUsage(1, BudgetPeriodDaily, "20261017", 10, 0.5)
+		usage, err := s.Budgets.AddUsage(1, BudgetPeriodDaily, "20261017", 5, 0.25)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if usage.Tokens != 15 || usage.Cost != 0.75 {
+			t.Fatalf("accumulated usage %+v", usage)
+		}
+
+		// 每个周期每种提醒只发送一次，超限提醒同时标记预警
+		if ok, _ := s.Budgets.MarkAlerted(usage.ID, BudgetAlertSoft); !ok {
+			t.Fatal("soft alert not marked")
+		}
+		if ok, _ := s.Budgets.MarkAlerted(usage.ID, BudgetAlertSoft); ok {
+			t.Fatal("soft alert marked twice")
+		}
+		if ok, _ := s.Budgets.MarkAlerted(usage.ID, BudgetAlertHard); !ok {
+			t.Fatal("hard alert not marked")
+		}
+
+		if err := s.Budgets.DeleteUsage(1, BudgetPeriodDaily, "20261017"); err != nil {
+			t.Fatal(err)
+		}
+		if usage, _ := s.Budgets.GetUsage(1, BudgetPeriodDaily, "20261017"); usage.Tokens != 0 {
+			t.Fatalf("usage after delete %+v", usage)
+		}
+	})
+}
+
+// 费用预算只累加 DefaultCurrency 的费用，其他币种仅计入 token
+func TestRecordUsageCurrency(t *testing.T) {
+	s := NewMemoryStores()
+	app := &Application{ID: 1}
+	app.DailyCostBudget = 1
+	s.RecordUsage(app, 10, 0.5, DefaultCurrency)
+	s.RecordUsage(app, 20, 3, "CNY")
+
+	usage, err := s.PeriodUsage(app, BudgetPeriodDaily, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Tokens != 30 || usage.Cost != 0.5 {
+		t.Fatalf("usage %+v", usage)
+	}
+	if err := s.CheckBudget(app); err != nil {
+		t.Fatalf("check budget %v", err)
+	}
+}
+
+// 预算告警只回调产生告警的存储实例
+func TestBudgetAlertPerStores(t *testing.T) {
+	var first, second []*BudgetAlert
+	s1, s2 := NewMemoryStores(), NewMemoryStores()
+	s1.OnBudgetAlert = func(alert *BudgetAlert) { first = append(first, alert) }
+	s2.OnBudgetAlert = func(alert *BudgetAlert) { second = append(second, alert) }
+
+	app := &Application{ID: 1}
+	app.DailyTokenBudget = 10
+	s1.RecordUsage(app, 20, 0, "")
+
+	if len(first) != 1 || first[0].Kind != BudgetAlertHard || len(second) != 0 {
+		t.Fatalf("alerts first %+v second %+v", first, second)
+	}
+}
+
+func TestUsageStore(t *testing.T) {
+	eachStores(t, func(t *testing.T, s *Stores) {
+		first, _ := CreateApplication(s.Apps, "first")
+		second, _ := CreateApplication(s.Apps, "second")
+		chat := &Chat{AppID: first.ID}
+		s.Chats.Create(chat)
+
+		// 仅统计带用量的回复及摘要，用户消息、工具结果及系统提示词不计入
+		for _, msg := range []*Message{
+			{Role: "user", Content: "hello"},
+			{Role: "assistant", Model: "gpt-4o", PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15, Cost: 0.2, Currency: "USD"},
+			{Role: "tool", LatencyMs: 3},
+			{Role: "system", IsSummary: true, Model: "gpt-4o", PromptTokens: 20, CompletionTokens: 10, TotalTokens: 30, Cost: 0.3, Currency: "USD"},
+			{Role: "system", Content: "prompt"},
+		} {
+			msg.ChatID = chat.ID
+			if err := s.Messages.Create(msg); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// 向量请求只记录用量
+		err := s.Usage.Record(&UsageRecord{AppID: second.ID, Kind: UsageKindEmbedding, Model: "text-embedding-3-small", PromptTokens: 8, TotalTokens: 8, Cost: 0.5, Currency: "USD"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		total, err := s.Usage.Total(time.Time{}, time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(total) != 1 || total[0].Requests != 3 || total[0].TotalTokens != 53 || total[0].CompletionTokens != 15 {
+			t.Fatalf("total %+v", total)
+		}
+
+		byModel, _ := s.Usage.ByModel(time.Time{}, time.Time{})
+		if len(byModel) != 2 || byModel[0].Model != "gpt-4o" || byModel[0].Requests != 2 || byModel[1].Model != "text-embedding-3-small" {
+			t.Fatalf("by model %+v", byModel)
+		}
+
+		byApp, _ := s.Usage.ByApp(time.Time{}, time.Time{})
+		if len(byApp) != 2 || byApp[0].AppID != first.ID || byApp[0].AppName != "first" || byApp[0].TotalTokens != 45 ||
+			byApp[1].AppID != second.ID || byApp[1].AppName != "second" || byApp[1].TotalTokens != 8 {
+			t.Fatalf("by app %+v", byApp)
+		}
+
+		// 时间范围为左闭右开
+		now := time.Now()
+		if list, _ := s.Usage.Total(now.Add(-time.Hour), now.Add(time.Hour)); len(list) != 1 || list[0].Requests != 3 {
+			t.Fatalf("total in range %+v", list)
+		}
+		if list, _ := s.Usage.Total(now.Add(time.Hour), time.Time{}); len(list) != 0 {
+			t.Fatalf("total after range %+v", list)
+		}
+	})
+}
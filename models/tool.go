@@ -0,0 +1,190 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/models/tool.go
+ */
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"gpt-zmide-server/helper"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// 服务端工具默认超时时间（秒）及最大超时时间
+const (
+	defaultToolTimeout = 10
+	maxToolTimeout     = 120
+)
+
+// 未配置时服务端工具最大调用轮次
+const defaultMaxToolIterations = 5
+
+// 工具返回结果最大长度，超出部分截断
+const maxToolResultSize = 16 * 1024
+
+var toolNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// 服务端工具，模型发起调用时由服务端以 POST 请求 URL 执行，响应内容作为工具结果
+type Tool struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	Name        string `gorm:"size:64;uniqueIndex" json:"name"`
+	Description string `gorm:"type:text" json:"description"`
+	Parameters  string `gorm:"type:text" json:"parameters"` // JSON Schema
+	URL         string `json:"url"`
+	Timeout     int    `json:"timeout"`      // 超时时间（秒），为 0 时使用 10
+	AllowedApps string `json:"allowed_apps"` // 允许调用的应用 ID，多个以英文逗号分隔，为空时所有应用可用
+	Status      uint   `json:"status"`       // 1 为启用
+	BaseModel
+}
+
+// 工具请求体
+type ToolCallRequest struct {
+	ToolCallID string          `json:"tool_call_id"`
+	Name       string          `json:"name"`
+	Arguments  json.RawMessage `json:"arguments"`
+	AppID      uint            `json:"app_id"`
+	ChatID     uint            `json:"chat_id"`
+}
+
+// 校验工具配置
+func (tool *Tool) Validate() error {
+	tool.Name = strings.TrimSpace(tool.Name)
+	tool.URL = strings.TrimSpace(tool.URL)
+	if !toolNameRegexp.MatchString(tool.Name) {
+		return errors.New("工具名仅支持字母、数字、下划线及中划线，长度不超过 64")
+	}
+	if u, err := url.Parse(tool.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("工具地址需为 http 或 https 地址")
+	}
+	if tool.Timeout < 0 || tool.Timeout > maxToolTimeout {
+		return errors.New("超时时间取值范围为 0 ~ " + strconv.Itoa(maxToolTimeout))
+	}
+
+	tool.Parameters = strings.TrimSpace(tool.Parameters)
+	if tool.Parameters != "" {
+		var schema map[string]interface{}
+		if err := json.Unmarshal([]byte(tool.Parameters), &schema); err != nil {
+			return errors.New("参数需为 JSON Schema 对象")
+		}
+	}
+
+	ids := []string{}
+	for _, item := range strings.Split(tool.AllowedApps, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		if _, err := strconv.ParseUint(item, 10, 32); err != nil {
+			return errors.New("应用 ID 格式错误")
+		}
+		ids = append(ids, item)
+	}
+	tool.AllowedApps = strings.Join(ids, ",")
+	return nil
+}
+
+// 应用是否允许调用工具
+func (tool *Tool) AllowApp(appID uint) bool {
+	if tool.AllowedApps == "" {
+		return true
+	}
+	id := strconv.Itoa(int(appID))
+	for _, item := range strings.Split(tool.AllowedApps, ",") {
+		if item == id {
+			return true
+		}
+	}
+	return false
+}
+
+// 转换为请求上游的工具定义
+func (tool *Tool) Definition() *helper.Tool {
+	def := &helper.Tool{
+		Type: "function",
+		Function: helper.ToolFunction{
+			Name:        tool.Name,
+			Description: tool.Description,
+		},
+	}
+	if tool.Parameters != "" {
+		def.Function.Parameters = json.RawMessage(tool.Parameters)
+	}
+	return def
+}
+
+// 执行工具调用，返回响应内容
+func (tool *Tool) Call(ctx context.Context, appID, chatID uint, call *helper.ToolCall) (string, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	timeout := tool.Timeout
+	if timeout <= 0 {
+		timeout = defaultToolTimeout
+	}
+
+	// 参数不是合法 JSON 时按字符串传递
+	arguments := json.RawMessage(call.Function.Arguments)
+	if !json.Valid(arguments) {
+		arguments, _ = json.Marshal(call.Function.Arguments)
+	}
+
+	resp, err := resty.New().SetTimeout(time.Duration(timeout)*time.Second).R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(&ToolCallRequest{
+			ToolCallID: call.ID,
+			Name:       tool.Name,
+			Arguments:  arguments,
+			AppID:      appID,
+			ChatID:     chatID,
+		}).
+		Post(tool.URL)
+	if err != nil {
+		return "", err
+	}
+	if !resp.IsSuccess() {
+		return "", errors.New("tool " + tool.Name + " response status " + resp.Status())
+	}
+
+	result := resp.String()
+	if len(result) > maxToolResultSize {
+		result = result[:maxToolResultSize]
+		for !utf8.ValidString(result) {
+			result = result[:len(result)-1]
+		}
+	}
+	return result, nil
+}
+
+// 获取应用可用的服务端工具，按工具名索引
+func (s *Stores) AppTools(appID uint) (map[string]*Tool, error) {
+	list, err := s.Tools.ListEnabled()
+	if err != nil {
+		return nil, err
+	}
+	tools := map[string]*Tool{}
+	for _, item := range list {
+		if item.AllowApp(appID) {
+			tools[item.Name] = item
+		}
+	}
+	return tools, nil
+}
+
+// 服务端工具最大调用轮次
+func (app *Application) toolMaxIterations() int {
+	if app == nil || app.MaxToolIterations <= 0 {
+		return defaultMaxToolIterations
+	}
+	return app.MaxToolIterations
+}
@@ -0,0 +1,238 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/models/upstream_key.go
+ */
+package models
+
+import (
+	"errors"
+	"gpt-zmide-server/helper"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// 限流后默认冷却时间
+	upstreamKeyRateLimitCooldown = time.Minute
+	// 密钥失效后冷却时间
+	upstreamKeyAuthCooldown = 30 * time.Minute
+	// 连续错误达到次数后冷却
+	upstreamKeyMaxErrors      = 3
+	upstreamKeyErrorCooldown  = 30 * time.Second
+	upstreamKeyReloadInterval = 30 * time.Second
+)
+
+// 上游密钥
+type UpstreamKey struct {
+	ID                uint       `gorm:"primaryKey" json:"id"`
+	Provider          string     `gorm:"index" json:"provider"`
+	Name              string     `json:"name"`
+	SecretKey         string     `json:"-"`
+	Weight            int        `json:"weight"`
+	Status            uint       `json:"status"` // 1 启用 2 禁用
+	SuccessCount      int64      `json:"success_count"`
+	ErrorCount        int64      `json:"error_count"`
+	ConsecutiveErrors int        `json:"consecutive_errors"`
+	LastStatus        int        `json:"last_status"`
+	LastError         string     `json:"last_error"`
+	CooldownUntil     *LocalTime `json:"cooldown_until"`
+	BaseModel
+}
+
+// 脱敏后的密钥，用于后台展示
+func (key *UpstreamKey) MaskSecretKey() string {
+	if len(key.SecretKey) <= 8 {
+		return "****"
+	}
+	return key.SecretKey[:3] + "****" + key.SecretKey[len(key.SecretKey)-4:]
+}
+
+// 是否处于冷却中
+func (key *UpstreamKey) IsCooling(now time.Time) bool {
+	return key.CooldownUntil != nil && key.CooldownUntil.After(now)
+}
+
+// 创建上游密钥
+func CreateUpstreamKey(store *Stores, provider string, name string, secretKey string, weight int) (key *UpstreamKey, err error) {
+	if provider == "" || secretKey == "" {
+		return nil, errors.New("提供方或密钥不得为空")
+	}
+	if weight <= 0 {
+		weight = 1
+	}
+
+	key = &UpstreamKey{
+		Provider:  strings.ToLower(provider),
+		Name:      name,
+		SecretKey: secretKey,
+		Weight:    weight,
+		Status:    1,
+	}
+	if err = store.UpstreamKeys.Create(key); err != nil {
+		return nil, err
+	}
+	store.ReloadUpstreamKeys()
+	return
+}
+
+// 更新上游密钥后刷新密钥池
+func (s *Stores) ReloadUpstreamKeys() {
+	s.caches().keys.Reload()
+}
+
+// 上游密钥池，供上游服务提供方选取密钥
+func (s *Stores) KeyPool() helper.KeyPool {
+	return s.caches().keys
+}
+
+type upstreamKeyEntry struct {
+	key     UpstreamKey
+	current int
+}
+
+// 基于存储的上游密钥池，按权重平滑轮询
+type upstreamKeyPool struct {
+	stores   *Stores
+	mu       sync.Mutex
+	entries  map[string][]*upstreamKeyEntry
+	loadedAt time.Time
+}
+
+// 标记密钥池需要重新加载
+func (pool *upstreamKeyPool) Reload() {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pool.loadedAt = time.Time{}
+}
+
+func (pool *upstreamKeyPool) load() {
+	if !pool.loadedAt.IsZero() && time.Since(pool.loadedAt) < upstreamKeyReloadInterval {
+		return
+	}
+
+	keys, err := pool.stores.UpstreamKeys.ListEnabled()
+	if err != nil {
+		pool.stores.Log().Error("upstream key load error " + err.Error())
+		return
+	}
+
+	// 保留已有的轮询进度
+	current := map[uint]int{}
+	for _, list := range pool.entries {
+		for _, entry := range list {
+			current[entry.key.ID] = entry.current
+		}
+	}
+
+	entries := map[string][]*upstreamKeyEntry{}
+	for _, key := range keys {
+		entries[key.Provider] = append(entries[key.Provider], &upstreamKeyEntry{key: *key, current: current[key.ID]})
+	}
+	pool.entries = entries
+	pool.loadedAt = time.Now()
+}
+
+func (pool *upstreamKeyPool) Pick(provider string) (*helper.PoolKey, error) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.load()
+	list := pool.entries[provider]
+	if len(list) < 1 {
+		return nil, nil
+	}
+
+	now := time.Now()
+	var best *upstreamKeyEntry
+	total := 0
+	for _, entry := range list {
+		if entry.key.IsCooling(now) {
+			continue
+		}
+		weight := entry.key.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		entry.current += weight
+		total += weight
+		if best == nil || entry.current > best.current {
+			best = entry
+		}
+	}
+
+	if best == nil {
+		return nil, errors.New("no available upstream key for " + provider)
+	}
+	best.current -= total
+
+	return &helper.PoolKey{
+		ID:        best.key.ID,
+		Provider:  best.key.Provider,
+		SecretKey: best.key.SecretKey,
+	}, nil
+}
+
+func (pool *upstreamKeyPool) Report(poolKey *helper.PoolKey, statusCode int, retryAfter time.Duration, err error) {
+	if poolKey == nil {
+		return
+	}
+
+	result := &UpstreamKeyResult{Status: statusCode}
+	result.Success = err == nil && statusCode >= 200 && statusCode < 300
+	// 仅网络错误、鉴权、限流及服务端错误计入密钥错误
+	result.Fault = err != nil || statusCode == 401 || statusCode == 403 || statusCode == 429 || statusCode >= 500
+	var cooldown time.Duration
+
+	switch {
+	case statusCode == 429:
+		cooldown = upstreamKeyRateLimitCooldown
+		if retryAfter > 0 {
+			cooldown = retryAfter
+		}
+	case statusCode == 401 || statusCode == 403:
+		cooldown = upstreamKeyAuthCooldown
+	}
+
+	pool.mu.Lock()
+	var entry *upstreamKeyEntry
+	for _, item := range pool.entries[poolKey.Provider] {
+		if item.key.ID == poolKey.ID {
+			entry = item
+			break
+		}
+	}
+
+	if result.Success {
+		if entry != nil {
+			entry.key.ConsecutiveErrors = 0
+		}
+	} else if result.Fault {
+		result.LastError = "http status " + strconv.Itoa(statusCode)
+		if err != nil {
+			result.LastError = err.Error()
+		}
+
+		if entry != nil {
+			entry.key.ConsecutiveErrors++
+			if cooldown == 0 && entry.key.ConsecutiveErrors >= upstreamKeyMaxErrors {
+				cooldown = upstreamKeyErrorCooldown
+			}
+		}
+	}
+
+	if cooldown > 0 {
+		result.CooldownUntil = &LocalTime{Time: time.Now().Add(cooldown)}
+		if entry != nil {
+			entry.key.CooldownUntil = result.CooldownUntil
+		}
+		pool.stores.Log().Warn("upstream key " + poolKey.Provider + "#" + strconv.Itoa(int(poolKey.ID)) + " cooldown " + cooldown.String())
+	}
+	pool.mu.Unlock()
+
+	if err := pool.stores.UpstreamKeys.Report(poolKey.ID, result); err != nil {
+		pool.stores.Log().Error("upstream key report error " + err.Error())
+	}
+}
@@ -0,0 +1,92 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/models/usage.go
+ */
+package models
+
+import "sort"
+
+// 不产生对话消息的上游请求类型
+const UsageKindEmbedding = "embedding"
+
+// 不产生对话消息的上游请求用量（如向量），对话用量记录在回复消息中
+type UsageRecord struct {
+	ID     uint   `gorm:"primaryKey" json:"id"`
+	AppID  uint   `gorm:"index" json:"app_id"`
+	Kind   string `json:"kind"`
+	Remark string `json:"remark"` // 请求路径
+	// 上游请求信息
+	Model            string `json:"model"`
+	RequestID        string `json:"request_id"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	TotalTokens      int64  `json:"total_tokens"`
+	UsageEstimated   bool   `json:"usage_estimated"` // 上游未返回用量，由本地计算
+	LatencyMs        int64  `json:"latency_ms"`
+	// 按写入时生效的模型价格计算的费用
+	Cost     float64 `json:"cost"`
+	Currency string  `json:"currency"`
+	BaseModel
+}
+
+// 用量统计
+type UsageStat struct {
+	AppID            uint    `json:"app_id,omitempty"`
+	AppName          string  `json:"app_name,omitempty"`
+	Model            string  `json:"model,omitempty"`
+	Currency         string  `json:"currency"`
+	Requests         int64   `json:"requests"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// 用量汇总字段，table 为 messages 或 usage_records
+func usageStatFields(table string) string {
+	return table + ".currency AS currency, COUNT(*) AS requests, " +
+		"SUM(" + table + ".prompt_tokens) AS prompt_tokens, SUM(" + table + ".completion_tokens) AS completion_tokens, " +
+		"SUM(" + table + ".total_tokens) AS total_tokens, SUM(" + table + ".cost) AS cost"
+}
+
+// 上游请求产生的消息（回复及摘要）的筛选条件，不含用户消息、工具结果及系统提示词
+const usageMessageWhere = "(messages.role = ? OR messages.is_summary = ?) AND messages.total_tokens > 0"
+
+// 是否为上游请求产生的消息，与 usageMessageWhere 一致
+func isUsageMessage(msg *Message) bool {
+	return (msg.Role == "assistant" || msg.IsSummary) && msg.TotalTokens > 0
+}
+
+// 合并消息及用量记录的统计，应用、模型及货币相同的合并为一项
+func mergeUsageStats(lists ...[]*UsageStat) []*UsageStat {
+	type key struct {
+		appID    uint
+		model    string
+		currency string
+	}
+	list := []*UsageStat{}
+	index := map[key]*UsageStat{}
+	for _, items := range lists {
+		for _, item := range items {
+			k := key{item.AppID, item.Model, item.Currency}
+			stat, ok := index[k]
+			if !ok {
+				stat = &UsageStat{AppID: item.AppID, AppName: item.AppName, Model: item.Model, Currency: item.Currency}
+				index[k] = stat
+				list = append(list, stat)
+			}
+			stat.Requests += item.Requests
+			stat.PromptTokens += item.PromptTokens
+			stat.CompletionTokens += item.CompletionTokens
+			stat.TotalTokens += item.TotalTokens
+			stat.Cost += item.Cost
+		}
+	}
+	return list
+}
+
+func sortUsageByCost(list []*UsageStat) []*UsageStat {
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Cost > list[j].Cost })
+	return list
+}
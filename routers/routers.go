@@ -7,32 +7,49 @@ package routers
 
 import (
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 
 	"gpt-zmide-server/controllers"
 	"gpt-zmide-server/controllers/apis"
 	"gpt-zmide-server/middleware"
+	"gpt-zmide-server/models"
 )
 
-func BuildRouter(r *gin.Engine) *gin.Engine {
+// 注册路由，connected 为安装向导连接数据库后的回调
+func BuildRouter(r *gin.Engine, store *models.Stores, connected func(db *gorm.DB)) *gin.Engine {
 	// Disable Console Color
 	// gin.DisableConsoleColor()
 
 	r.GET("/", new(controllers.Index).Index)
-	r.GET("/install", middleware.InstallMiddleware(), new(controllers.Install).Index)
-	r.POST("/install/config", middleware.InstallMiddleware(), new(controllers.Install).Config)
+	ctlInstall := &controllers.Install{Store: store, Connected: connected}
+	r.GET("/install", middleware.InstallMiddleware(store.Config), ctlInstall.Index)
+	r.POST("/install/config", middleware.InstallMiddleware(store.Config), ctlInstall.Config)
 
-	r.GET("/admin", middleware.BasicAuth(), new(controllers.Admin).Index)
+	r.GET("/admin", middleware.BasicAuth(store.Config), new(controllers.Admin).Index)
 	r.GET("/admin/signout", new(controllers.Admin).SignOut)
 
 	// r.GET("/test", new(controllers.InstallController).Test) // 测试路由
 
+	// 兼容 OpenAI 协议的网关接口
+	apisCtlGateway := &apis.Gateway{Store: store}
+	gateway := r.Group("/v1", middleware.BasicAuthGateway(store.Apps), middleware.RateLimitOpen(store))
+	{
+		gateway.GET("/models", apisCtlGateway.Models)
+		gateway.POST("/chat/completions", middleware.StreamLimitOpen(store), apisCtlGateway.ChatCompletions)
+		gateway.POST("/embeddings", apisCtlGateway.Embeddings)
+	}
+
 	api := r.Group("/api")
 	{
 
-		apisCtlApp := new(apis.Application)
-		apisCtlOpen := new(apis.Open)
-		apisCtlConfig := new(apis.Config)
-		apisCtlChat := new(apis.Chat)
+		apisCtlApp := &apis.Application{Store: store}
+		apisCtlOpen := &apis.Open{Store: store}
+		apisCtlConfig := &apis.Config{Store: store}
+		apisCtlChat := &apis.Chat{Store: store}
+		apisCtlUpstreamKey := &apis.UpstreamKey{Store: store}
+		apisCtlSensitiveWord := &apis.SensitiveWord{Store: store}
+		apisCtlModelPrice := &apis.ModelPrice{Store: store}
+		apisCtlTool := &apis.Tool{Store: store}
 
 		notDefault := func(ctx *gin.Context) {
 			apis.APIDefaultController.Fail(ctx, "404 route not found.")
@@ -42,13 +59,15 @@ func BuildRouter(r *gin.Engine) *gin.Engine {
 		api.Any("/:route/*no", notDefault)
 
 		// 开放接口
-		openApis := api.Group("/open", middleware.BasicAuthOpen())
+		openApis := api.Group("/open", middleware.BasicAuthOpen(store.Apps), middleware.RateLimitOpen(store))
 		openApis.POST("/", apisCtlOpen.Index)
 		openApis.POST("/query", apisCtlOpen.Query)
-		openApis.POST("/chat", apisCtlOpen.Chat)
-		openApis.POST("/chat/raw", apisCtlOpen.ChatRaw)
+		openApis.POST("/chat", middleware.StreamLimitOpen(store), apisCtlOpen.Chat)
+		openApis.POST("/chat/raw", middleware.StreamLimitOpen(store), apisCtlOpen.ChatRaw)
+		openApis.GET("/ws", middleware.StreamLimitOpen(store), apisCtlOpen.WebSocket)
+		openApis.POST("/embeddings", apisCtlOpen.Embeddings)
 
-		adminApis := api.Group("/admin", middleware.BasicAuthAdmin())
+		adminApis := api.Group("/admin", middleware.BasicAuthAdmin(store.Config))
 
 		// 系统配置
 		adminConfig := adminApis.Group("/config")
@@ -59,16 +78,45 @@ func BuildRouter(r *gin.Engine) *gin.Engine {
 		adminConfig.POST("/system/config", apisCtlConfig.ConfigInfoSave)
 		adminConfig.GET("/system/log", apisCtlConfig.GetSystemLogs)
 
+		// 上游密钥池
+		adminConfig.GET("/keys", apisCtlUpstreamKey.Index)
+		adminConfig.POST("/keys/create", apisCtlUpstreamKey.Create)
+		adminConfig.POST("/keys/:id/update", apisCtlUpstreamKey.Update)
+		adminConfig.POST("/keys/:id/reset", apisCtlUpstreamKey.Reset)
+
+		// 模型价格表
+		adminConfig.GET("/prices", apisCtlModelPrice.Index)
+		adminConfig.POST("/prices/create", apisCtlModelPrice.Create)
+		adminConfig.POST("/prices/:id/update", apisCtlModelPrice.Update)
+		adminConfig.POST("/prices/:id/delete", apisCtlModelPrice.Delete)
+
 		// 后台管理应用接口
 		adminApp := adminApis.Group("/application")
 		adminApp.GET("/", apisCtlApp.Index)
 		adminApp.POST("/create", apisCtlApp.Create)
 		adminApp.POST("/:id/update", apisCtlApp.Update)
 		adminApp.POST("/:id/apikey/reset", apisCtlApp.RestApiKey)
+		adminApp.GET("/:id/budget", apisCtlApp.Budget)
+		adminApp.POST("/:id/budget/reset", apisCtlApp.ResetBudget)
+		adminApp.GET("/budget/alerts", apisCtlApp.BudgetAlerts)
 
 		// 后台管理应用接口
 		adminChat := adminApis.Group("/chat")
 		adminChat.GET("/", apisCtlChat.Index)
+		adminChat.GET("/:id/messages", apisCtlChat.Messages)
+
+		// 敏感词管理
+		adminFilter := adminApis.Group("/filter")
+		adminFilter.GET("/", apisCtlSensitiveWord.Index)
+		adminFilter.POST("/create", apisCtlSensitiveWord.Create)
+		adminFilter.POST("/:id/delete", apisCtlSensitiveWord.Delete)
+
+		// 服务端工具管理
+		adminTool := adminApis.Group("/tool")
+		adminTool.GET("/", apisCtlTool.Index)
+		adminTool.POST("/create", apisCtlTool.Create)
+		adminTool.POST("/:id/update", apisCtlTool.Update)
+		adminTool.POST("/:id/delete", apisCtlTool.Delete)
 	}
 
 	return r
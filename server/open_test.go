@@ -0,0 +1,195 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/server/open_test.go
+ */
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"gpt-zmide-server/models"
+)
+
+// SSE 事件
+type sseEvent struct {
+	Event string
+	Data  string
+}
+
+// 开放接口响应
+type openResponse struct {
+	Code int             `json:"code"`
+	Msg  string          `json:"msg"`
+	Data json.RawMessage `json:"data"`
+}
+
+// 创建实例及应用，返回应用的 API Key
+func newOpenApp(t *testing.T) (*App, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	app := newTestApp(t)
+	application, err := models.CreateApplication(app.Store.Apps, "open")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return app, application.ApiKey
+}
+
+func postForm(app *App, path, apiKey string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	w := httptest.NewRecorder()
+	app.Handler().ServeHTTP(w, req)
+	return w
+}
+
+// 解析 SSE 响应，忽略心跳注释
+func readEvents(t *testing.T, body string) []*sseEvent {
+	t.Helper()
+	var events []*sseEvent
+	event := &sseEvent{}
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if event.Event != "" {
+				events = append(events, event)
+			}
+			event = &sseEvent{}
+		case strings.HasPrefix(line, "event: "):
+			event.Event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.Data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	if len(events) < 1 {
+		t.Fatalf("no sse events in %q", body)
+	}
+	return events
+}
+
+// 解析消息事件中的消息
+func eventMessage(t *testing.T, event *sseEvent) *models.Message {
+	t.Helper()
+	var res struct {
+		Data *models.Message `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(event.Data), &res); err != nil || res.Data == nil {
+		t.Fatalf("decode message event %q: %v", event.Data, err)
+	}
+	return res.Data
+}
+
+// 对话流式输出：内容分片及最终消息均为 message 事件，以 done 事件结束
+func chatStream(t *testing.T, app *App, apiKey, content string) (text string, last *models.Message, events []*sseEvent) {
+	t.Helper()
+	w := postForm(app, "/api/open/chat", apiKey, url.Values{"content": {content}})
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("chat status %d content type %q body %q", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+	events = readEvents(t, w.Body.String())
+	if events[len(events)-1].Event != "done" {
+		t.Fatalf("last event %q, want done", events[len(events)-1].Event)
+	}
+	for _, event := range events {
+		if event.Event != "message" {
+			continue
+		}
+		last = eventMessage(t, event)
+		text += last.Content
+	}
+	return
+}
+
+func TestOpenQuery(t *testing.T) {
+	app, apiKey := newOpenApp(t)
+
+	w := postForm(app, "/api/open/query", apiKey, url.Values{"content": {"hello world"}})
+	var res openResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Code != 200 {
+		t.Fatalf("query code %d msg %q", res.Code, res.Msg)
+	}
+	var msg models.Message
+	if err := json.Unmarshal(res.Data, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Role != "assistant" || !strings.Contains(msg.Content, "hello world") {
+		t.Fatalf("reply %s %q", msg.Role, msg.Content)
+	}
+	if msg.FinishReason != "stop" || msg.TotalTokens != msg.PromptTokens+msg.CompletionTokens || msg.CompletionTokens < 1 || msg.UsageEstimated {
+		t.Fatalf("reply usage %+v", msg)
+	}
+}
+
+func TestOpenChatStream(t *testing.T) {
+	app, apiKey := newOpenApp(t)
+
+	text, last, events := chatStream(t, app, apiKey, "hello stream")
+	for _, event := range events {
+		if event.Event == "error" {
+			t.Fatalf("unexpected error event %q", event.Data)
+		}
+	}
+	if !strings.Contains(text, "hello stream") {
+		t.Fatalf("streamed content %q", text)
+	}
+	// 最后一条消息为保存后的回复，不重复输出内容，上游在最后一个分片返回用量
+	if last.ID == 0 || last.Content != "" || last.FinishReason != "stop" || last.CompletionTokens < 1 || last.UsageEstimated {
+		t.Fatalf("final message %+v", last)
+	}
+}
+
+func TestOpenChatStreamTruncated(t *testing.T) {
+	app, apiKey := newOpenApp(t)
+
+	// 上游输出 2 个分片后断开连接，已推送的内容保留，随后以 error 事件结束
+	text, _, events := chatStream(t, app, apiKey, "[mock:truncate=2] one two three four five")
+	if text == "" || strings.Contains(text, "five") {
+		t.Fatalf("truncated content %q", text)
+	}
+	if failed := events[len(events)-2]; failed.Event != "error" || !strings.Contains(failed.Data, "EOF") {
+		t.Fatalf("events before done %+v", failed)
+	}
+}
+
+func TestOpenUpstreamError(t *testing.T) {
+	app, apiKey := newOpenApp(t)
+
+	for _, status := range []string{"429", "500"} {
+		t.Run(status, func(t *testing.T) {
+			content := "[mock:" + status + "] hello"
+			w := postForm(app, "/api/open/query", apiKey, url.Values{"content": {content}})
+			var res openResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if res.Code == 200 || !strings.Contains(res.Msg, status) {
+				t.Fatalf("query code %d msg %q", res.Code, res.Msg)
+			}
+
+			// 流式请求以 error 事件返回上游错误
+			w = postForm(app, "/api/open/chat", apiKey, url.Values{"content": {content}})
+			events := readEvents(t, w.Body.String())
+			if len(events) != 2 || events[0].Event != "error" || events[1].Event != "done" {
+				t.Fatalf("chat events %+v", events)
+			}
+			if !strings.Contains(events[0].Data, status) {
+				t.Fatalf("error event %q", events[0].Data)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/server/server.go
+ */
+package server
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"gpt-zmide-server/helper"
+	"gpt-zmide-server/helper/logger"
+	"gpt-zmide-server/models"
+	"gpt-zmide-server/routers"
+)
+
+// 创建服务的参数，除 Config 外均可为空
+type Options struct {
+	Config     *helper.DefaultConfig // 服务配置，由本实例独占使用，不应在多个 App 之间共用
+	ConfigPath string                // 安装向导及后台保存配置的文件路径，为空时使用 Config 读取时的路径
+	DB         *gorm.DB              // 数据库连接，为空时按配置连接（未完成安装时不连接）
+	Logger     *zap.Logger           // 日志，为空时输出到标准输出及 ./debug.log
+	HttpClient *http.Client          // 请求上游使用的基础客户端，为空使用默认客户端
+	Stores     *models.Stores        // 存储，为空使用基于 DB 的存储
+	Router     *gin.Engine           // 注册路由的 gin 实例，为空时创建
+	Views      fs.FS                 // 页面模板，文件位于根目录，为空时页面路由不可用
+	Assets     fs.FS                 // 前端静态资源，挂载于 /assets
+	Dev        bool                  // 前端调试模式，从 ./views 读取模板并代理 vite 开发服务
+	SkipCheck  bool                  // 跳过数据库迁移检查，用于执行迁移命令
+
+	OnBudgetAlert func(alert *models.BudgetAlert) // 应用预算告警回调，可用于接入通知渠道
+}
+
+// 服务容器，持有配置、数据库、日志、上游客户端及路由
+//
+// 依赖均经由实例传递给存储及控制器，不修改包级变量，
+// 同一进程内可同时运行多个 App，多个实例时应分别指定 Logger 避免写入同一日志文件。
+type App struct {
+	Config     *helper.DefaultConfig
+	DB         *gorm.DB // 未完成安装时为空，安装向导连接数据库后更新
+	Logger     *zap.Logger
+	HttpClient *http.Client
+	Store      *models.Stores
+	Router     *gin.Engine
+
+	ownDB  bool // 数据库连接由本实例创建，关闭时一并关闭
+	mu     sync.Mutex
+	server *http.Server
+}
+
+// 按参数创建服务
+func New(opts Options) (*App, error) {
+	if opts.Config == nil {
+		return nil, errors.New("config is required")
+	}
+
+	app := &App{
+		Config:     opts.Config,
+		DB:         opts.DB,
+		Logger:     opts.Logger,
+		HttpClient: opts.HttpClient,
+		Store:      opts.Stores,
+		Router:     opts.Router,
+	}
+	if app.Logger == nil {
+		app.Logger = logger.New(logger.LOG_FILE_PATH)
+	}
+	if opts.ConfigPath != "" {
+		app.Config.SetPath(opts.ConfigPath)
+	}
+	if app.HttpClient != nil {
+		app.Config.SetHttpClient(app.HttpClient)
+	}
+
+	// 已完成安装时连接数据库
+	if app.DB == nil && !app.Config.IsInitialize() {
+		db, err := models.Open(app.Config)
+		if err != nil {
+			return nil, err
+		}
+		app.DB, app.ownDB = db, true
+	}
+
+	// 存在未执行或执行失败的数据库迁移时拒绝启动
+	if app.DB != nil && !opts.SkipCheck {
+		if err := models.CheckMigrations(app.DB); err != nil {
+			app.Close()
+			return nil, err
+		}
+	}
+
+	if app.Store == nil {
+		app.Store = models.NewGormStores(app.DB)
+	}
+	if app.Store.Config == nil {
+		app.Store.Config = app.Config
+	}
+	if app.Store.Logger == nil {
+		app.Store.Logger = app.Logger
+	}
+	if opts.OnBudgetAlert != nil {
+		app.Store.OnBudgetAlert = opts.OnBudgetAlert
+	}
+	// 上游请求优先使用存储中的密钥池
+	app.Store.Config.SetKeyPool(app.Store.KeyPool())
+
+	if app.Router == nil {
+		app.Router = gin.Default()
+	}
+	if err := app.setupViews(opts); err != nil {
+		app.Close()
+		return nil, err
+	}
+	routers.BuildRouter(app.Router, app.Store, app.connected)
+
+	return app, nil
+}
+
+// 安装向导连接数据库后由本实例接管连接
+func (app *App) connected(db *gorm.DB) {
+	app.mu.Lock()
+	prev, own := app.DB, app.ownDB
+	app.DB, app.ownDB = db, true
+	app.mu.Unlock()
+
+	app.Store.SetDB(db)
+	if own && prev != nil && prev != db {
+		if sqlDB, err := prev.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}
+}
+
+// 服务 http 处理器，用于嵌入其他服务
+func (app *App) Handler() http.Handler {
+	return app.Router
+}
+
+// 监听地址，未配置时使用 0.0.0.0:8091
+func (app *App) Addr() string {
+	if app.Config.Host == "" {
+		return "0.0.0.0:8091"
+	}
+	return net.JoinHostPort(app.Config.Host, strconv.Itoa(app.Config.Port))
+}
+
+// 监听配置地址并处理请求，调用 Shutdown 后返回 nil
+func (app *App) Run() error {
+	app.mu.Lock()
+	if app.server != nil {
+		app.mu.Unlock()
+		return errors.New("server is already running")
+	}
+	app.server = &http.Server{Addr: app.Addr(), Handler: app.Router}
+	server := app.server
+	app.mu.Unlock()
+
+	app.Logger.Info("gpt-zmide-server start up, listening and serving HTTP on http://" + server.Addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// 停止处理请求并关闭数据库连接
+func (app *App) Shutdown(ctx context.Context) error {
+	app.mu.Lock()
+	server := app.server
+	app.server = nil
+	app.mu.Unlock()
+
+	var err error
+	if server != nil {
+		err = server.Shutdown(ctx)
+	}
+	if closeErr := app.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// 关闭本实例创建的数据库连接，传入的连接由调用方关闭
+func (app *App) Close() error {
+	app.mu.Lock()
+	db, own := app.DB, app.ownDB
+	app.ownDB = false
+	app.mu.Unlock()
+
+	if !own || db == nil {
+		return nil
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
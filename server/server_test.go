@@ -0,0 +1,163 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/server/server_test.go
+ */
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"gpt-zmide-server/helper"
+	"gpt-zmide-server/models"
+)
+
+const testConfig = `
+site_name: test
+provider: mock
+admin_user:
+    user: admin
+    password: 21232f297a57a5a743894a0e4a801fc3
+db_driver: sqlite
+openai:
+    model: gpt-4o-mini
+    base_url: mock://
+`
+
+// 创建使用独立 SQLite 数据库的服务
+func newTestApp(t *testing.T) *App {
+	t.Helper()
+	dir := t.TempDir()
+	config, err := helper.LoadConfig(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Sqlite.Path = filepath.Join(dir, "test.db")
+
+	db, err := models.Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := models.MigrateUp(db); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	app, err := New(Options{
+		Config:     config,
+		ConfigPath: filepath.Join(dir, "app.conf"),
+		DB:         db,
+		Logger:     zap.NewNop(),
+		Router:     gin.New(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { app.Close() })
+	return app
+}
+
+func query(t *testing.T, app *App, apiKey string) (int, string) {
+	t.Helper()
+	form := url.Values{"content": {"hello"}}
+	req := httptest.NewRequest(http.MethodPost, "/api/open/query", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	w := httptest.NewRecorder()
+	app.Handler().ServeHTTP(w, req)
+
+	var res struct {
+		Code int `json:"code"`
+		Data struct {
+			Content string `json:"content"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("decode response %q: %v", w.Body.String(), err)
+	}
+	return res.Code, res.Data.Content
+}
+
+func TestMultipleApps(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	first, second := newTestApp(t), newTestApp(t)
+
+	firstApp, err := models.CreateApplication(first.Store.Apps, "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondApp, err := models.CreateApplication(second.Store.Apps, "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 应用只存在于各自实例的数据库中
+	if code, content := query(t, first, firstApp.ApiKey); code != 200 || content == "" {
+		t.Fatalf("first app query code %d content %q", code, content)
+	}
+	if code, content := query(t, second, secondApp.ApiKey); code != 200 || content == "" {
+		t.Fatalf("second app query code %d content %q", code, content)
+	}
+	if code, _ := query(t, second, firstApp.ApiKey); code == 200 {
+		t.Fatal("second server accepted api key of first server")
+	}
+
+	// 关闭一个实例不影响另一个实例
+	if err := first.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := query(t, second, secondApp.ApiKey); code != 200 {
+		t.Fatalf("second app query code %d after first closed", code)
+	}
+}
+
+func TestInstallConnect(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config, err := helper.LoadConfig(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.DBDriver = ""
+	app, err := New(Options{Config: config, ConfigPath: filepath.Join(t.TempDir(), "app.conf"), Logger: zap.NewNop(), Router: gin.New()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if app.DB != nil {
+		t.Fatal("database connected before installation")
+	}
+
+	// 安装向导连接数据库后由实例接管并在关闭时关闭
+	config.DBDriver = helper.DBDriverSqlite
+	config.Sqlite.Path = filepath.Join(t.TempDir(), "test.db")
+	db, err := models.Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := models.MigrateUp(db); err != nil {
+		t.Fatal(err)
+	}
+	app.connected(db)
+	if _, err := models.CreateApplication(app.Store.Apps, "app"); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Close(); err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	if err := sqlDB.Ping(); err == nil {
+		t.Fatal("database not closed")
+	}
+}
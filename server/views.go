@@ -0,0 +1,113 @@
+/*
+ * @Author: Bin
+ * @Date: 2026-10-17
+ * @FilePath: /gpt-zmide-server/server/views.go
+ */
+package server
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// 前端开发服务地址
+const viteDevServer = "http://localhost:5173"
+
+// 配置页面模板及静态文件路由
+func (app *App) setupViews(opts Options) error {
+	r := app.Router
+	if opts.Dev {
+		app.setupDevViews()
+		return nil
+	}
+
+	if opts.Views != nil {
+		templ, err := template.New("").ParseFS(opts.Views, "*")
+		if err != nil {
+			return err
+		}
+		r.SetHTMLTemplate(templ)
+	}
+	if opts.Assets != nil {
+		r.StaticFS("/assets", http.FS(opts.Assets))
+	}
+	return nil
+}
+
+// 前端调试模式，注入前端调试代码并反向代理代码目录
+func (app *App) setupDevViews() {
+	r := app.Router
+	var templ = template.New("")
+	templDir, err := template.ParseGlob("./views/*")
+	if err == nil {
+		for _, item := range templDir.Templates() {
+			document, err := goquery.NewDocumentFromReader(strings.NewReader(item.Tree.Root.String()))
+			if err == nil {
+				headStr := document.Find("head")
+				nodeItem := newScriptDevNode()
+				headStr.AddBack().Get(0).AppendChild(&nodeItem)
+			}
+
+			templItem := template.Must(templ.Parse(renderNode(document.AddBack().Get(0))))
+			app.Logger.Debug("解析 html " + item.Name())
+			templ.AddParseTree(item.Name(), templItem.Tree)
+		}
+	}
+	r.SetHTMLTemplate(templ)
+
+	proxyHandle := func(c *gin.Context) {
+		remote, err := url.Parse(viteDevServer)
+		if err != nil {
+			panic(err)
+		}
+		proxy := httputil.NewSingleHostReverseProxy(remote)
+		proxy.ServeHTTP(c.Writer, c.Request)
+	}
+	r.Any("/src/*name", proxyHandle)
+	r.Any("/@id/*name", proxyHandle)
+	r.Any("/node_modules/*name", proxyHandle)
+	r.Any("/@vite/*name", proxyHandle)
+	r.Any("/@react-refresh", proxyHandle)
+}
+
+func renderNode(n *html.Node) string {
+	var buf bytes.Buffer
+	w := io.Writer(&buf)
+	html.Render(w, n)
+	return buf.String()
+}
+
+func newScriptDevNode() html.Node {
+	scriptDev := html.Node{
+		Type:     html.ElementNode,
+		Data:     "script",
+		DataAtom: atom.Body,
+		Attr: []html.Attribute{
+			{
+				Key: "type",
+				Val: "module",
+			},
+		},
+	}
+	scriptDev.AppendChild(&html.Node{
+		Type: html.TextNode,
+		Data: `
+		import RefreshRuntime from '/@react-refresh'
+		RefreshRuntime.injectIntoGlobalHook(window)
+		window.$RefreshReg$ = () => {}
+		window.$RefreshSig$ = () => (type) => type
+		window.__vite_plugin_react_preamble_installed__ = true
+		`,
+	})
+	return scriptDev
+}
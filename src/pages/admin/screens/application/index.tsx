@@ -9,6 +9,13 @@ import { IconQuestionCircle } from '@arco-design/web-react/icon'
 import useAxios from 'axios-hooks';
 import { axios } from '@/apis';
 
+const contextStrategies: { [key: string]: string } = {
+    sliding_window: '滑动窗口',
+    last_n: '最近 N 条',
+    summary: '摘要',
+    reject: '超出时报错',
+}
+
 type createAppConfigType = {
     visible: boolean,
     id?: number,
@@ -35,12 +42,21 @@ export default function index() {
             dataIndex: 'api_key',
         },
         {
-            title: <Tooltip content='OpenAI 接口对 gpt-3.5 消息上下文有 4600 字数限制，启用修复长消息的话，当会话消息字数超过限制会自动忽略旧消息，只发送最新消息内容'>
-                长消息<IconQuestionCircle />
+            title: <Tooltip content='会话消息超过模型上下文 token 限制时的处理方式：滑动窗口只发送最新的消息，最近 N 条只发送系统提示词及最近 N 条消息，摘要会将较早的消息总结为摘要后发送，超出时报错会保留全部消息并返回错误'>
+                上下文策略<IconQuestionCircle />
             </Tooltip>,
-            dataIndex: 'enable_fix_long_msg',
-            render: (enable_fix_long_msg) => {
-                return enable_fix_long_msg === 1 ? <Tag color='green'>启用</Tag> : <Tag color='red'>禁用</Tag>
+            dataIndex: 'context_strategy',
+            render: (context_strategy, item) => {
+                if (context_strategy === 'last_n') {
+                    return <Tag color='arcoblue'>{`${contextStrategies.last_n}/${item?.context_last_n || '-'}`}</Tag>
+                }
+                if (context_strategy === 'summary') {
+                    return <Tag color='purple'>{contextStrategies.summary}</Tag>
+                }
+                if (context_strategy === 'reject') {
+                    return <Tag color='orange'>{contextStrategies.reject}</Tag>
+                }
+                return <Tag color='green'>{contextStrategies.sliding_window}</Tag>
             }
         },
         {
@@ -81,8 +97,8 @@ export default function index() {
                                     return updateAppStatus(item.id, item.status)
                                 }
 
-                                if (key == 'long_message') {
-                                    return updateAppStatus(item.id, undefined, item.enable_fix_long_msg)
+                                if (key.startsWith('context_strategy/')) {
+                                    return updateAppContextStrategy(item.id, key.replace('context_strategy/', ''), item.context_last_n)
                                 }
 
                                 if (key == 'reset_apikey') {
@@ -90,7 +106,11 @@ export default function index() {
                                 }
                             }}>
                                 <Menu.Item key='status'>{item?.status === 1 ? '禁用' : '启用'}</Menu.Item>
-                                <Menu.Item key='long_message'>{item?.enable_fix_long_msg === 1 ? '禁用/长消息' : '启用/长消息'}</Menu.Item>
+                                <Menu.SubMenu key='context_strategy' title='上下文策略'>
+                                    {Object.entries(contextStrategies).map(([strategy, label]) => (
+                                        <Menu.Item key={`context_strategy/${strategy}`}>{label}</Menu.Item>
+                                    ))}
+                                </Menu.SubMenu>
                                 <Menu.Item key='reset_apikey'>重置API_KEY</Menu.Item>
                             </Menu>
                         }
@@ -167,7 +187,7 @@ export default function index() {
     }
 
     // 更新应用状态
-    const updateAppStatus = (id: number, status?: number, fix_long_msg?: number) => {
+    const updateAppStatus = (id: number, status?: number) => {
         if (!id || id < 1) {
             Message.warning('应用异常。')
             return
@@ -177,10 +197,27 @@ export default function index() {
         if (status !== undefined) {
             formData.append("status", status === 1 ? '2' : '1')
         }
-        if (fix_long_msg != undefined) {
-            formData.append("fix_long_msg", fix_long_msg === 1 ? '2' : '1')
+
+        postAppUpdate(id, formData)
+    }
+
+    // 更新应用上下文策略
+    const updateAppContextStrategy = (id: number, strategy: string, last_n?: number) => {
+        if (!id || id < 1) {
+            Message.warning('应用异常。')
+            return
+        }
+
+        const formData = new FormData();
+        formData.append("context_strategy", strategy)
+        if (strategy === 'last_n' && !last_n) {
+            formData.append("context_last_n", '20')
         }
 
+        postAppUpdate(id, formData)
+    }
+
+    const postAppUpdate = (id: number, formData: FormData) => {
         axios.post(`/api/admin/application/${id}/update`, formData).then((response) => {
             const { code, msg, data } = response.data
             if (code !== 200) {
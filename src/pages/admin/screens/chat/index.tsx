@@ -8,17 +8,79 @@ import React from 'react'
 import {
     Table,
     TableColumnProps,
-    Button
+    Button,
+    Drawer,
+    Message,
+    Tag
 } from '@arco-design/web-react'
 import useAxios from 'axios-hooks';
 import { axios } from '@/apis';
 
+// 消息角色
+const messageRoles: { [key: string]: string } = {
+    system: '系统',
+    user: '用户',
+    assistant: '助手',
+    tool: '工具',
+}
+
 export default function index() {
 
     const [{ data, error, loading }, refresh] = useAxios({
         url: "/api/admin/chat/"
     })
 
+    const [messages, setMessages] = React.useState<{ visible: boolean, chatID?: number, list?: any[] }>({ visible: false })
+
+    // 查看会话消息记录，包含工具调用步骤
+    const showMessages = (id: number) => {
+        axios.get(`/api/admin/chat/${id}/messages`).then((response) => {
+            const { code, msg, data } = response.data
+            if (code !== 200) {
+                Message.info(`请求失败，${msg || code}`)
+                return
+            }
+            setMessages({ visible: true, chatID: id, list: data })
+        }).catch(err => {
+            Message.info(`请求失败，${err.message || '请稍后重试'}`)
+        })
+    }
+
+    const messageColumns: TableColumnProps[] = [
+        {
+            title: '角色',
+            dataIndex: 'role',
+            width: 80,
+            render: (role) => <Tag>{messageRoles[role] || role}</Tag>
+        },
+        {
+            title: '内容',
+            dataIndex: 'content',
+            render: (content, item) => {
+                return <>
+                    {item.tool_calls?.map((call: any) => (
+                        <div key={call.id}>
+                            <Tag color='arcoblue'>调用 {call.function?.name}</Tag> {call.function?.arguments}
+                        </div>
+                    ))}
+                    {item.role === 'tool' && <Tag color='green'>{item.name || item.tool_call_id}</Tag>}
+                    {item.images?.length > 0 && <Tag color='orange'>图片 {item.images.length}</Tag>}
+                    <div style={{ whiteSpace: 'pre-wrap' }}>{content}</div>
+                </>
+            }
+        },
+        {
+            title: 'Token',
+            dataIndex: 'total_tokens',
+            width: 80,
+        },
+        {
+            title: '创建时间',
+            dataIndex: 'created_at',
+            width: 180,
+        },
+    ];
+
     const columns: TableColumnProps[] = [
         {
             title: 'ID',
@@ -48,7 +110,7 @@ export default function index() {
                 return item ? <>
                     <Button
                         type='text'
-                        disabled={true}
+                        onClick={() => showMessages(id)}
                     >
                         消息记录
                     </Button>
@@ -82,6 +144,21 @@ export default function index() {
                     },
                 }}
             />
+
+            <Drawer
+                width={800}
+                title={`会话 #${messages.chatID || ''} 消息记录`}
+                visible={messages.visible}
+                footer={null}
+                onCancel={() => setMessages({ ...messages, visible: false })}
+            >
+                <Table
+                    rowKey='id'
+                    columns={messageColumns}
+                    data={messages.list}
+                    pagination={false}
+                />
+            </Drawer>
         </div>
     )
 }
@@ -4,7 +4,7 @@
  * @FilePath: /gpt-zmide-server/src/pages/install/App.tsx
  */
 import React, { ReactElement } from 'react'
-import { Layout, Steps, Divider, Button, Form, Input, Result, Message } from '@arco-design/web-react';
+import { Layout, Steps, Divider, Button, Form, Input, Result, Message, Radio } from '@arco-design/web-react';
 
 import { Footer } from '@/components'
 import { Header } from './components'
@@ -186,7 +186,8 @@ export default function App() {
             title: "配置数据库",
             view: (props: StepViewProps) => {
                 const { fromData = {}, setFromData = () => { }, onStepPrevious = () => { }, onStepNext = () => { } } = props;
-                const forms: { label: string, field: string, example?: string }[] = [
+                const driver = fromData.db_driver || 'mysql'
+                const mysqlForms: { label: string, field: string, example?: string }[] = [
                     {
                         label: 'MySql 数据库地址',
                         field: 'mysql_host',
@@ -212,8 +213,62 @@ export default function App() {
                         example: 'gpt_zmide_server'
                     }
                 ]
+                const sqliteForms: { label: string, field: string, example?: string }[] = [
+                    {
+                        label: 'SQLite 数据库文件路径（留空保存在配置文件所在目录）',
+                        field: 'sqlite_path',
+                        example: './gpt_zmide_server.db'
+                    }
+                ]
+                const postgresForms: { label: string, field: string, example?: string }[] = [
+                    {
+                        label: 'PostgreSQL 数据库地址',
+                        field: 'postgres_host',
+                        example: '127.0.0.1'
+                    },
+                    {
+                        label: 'PostgreSQL 数据库端口',
+                        field: 'postgres_port',
+                        example: '5432'
+                    },
+                    {
+                        label: 'PostgreSQL 数据库用户名',
+                        field: 'postgres_user',
+                        example: 'postgres'
+                    },
+                    {
+                        label: 'PostgreSQL 数据库密码',
+                        field: 'postgres_password',
+                    },
+                    {
+                        label: 'PostgreSQL 数据库名称',
+                        field: 'postgres_database',
+                        example: 'gpt_zmide_server'
+                    },
+                    {
+                        label: 'PostgreSQL SSL 模式',
+                        field: 'postgres_ssl_mode',
+                        example: 'disable / require / verify-full'
+                    }
+                ]
+                const forms = { sqlite: sqliteForms, postgres: postgresForms }[driver as string] || mysqlForms
 
                 return <Form autoComplete='off' layout="vertical" >
+                    <Form.Item label='数据库类型'>
+                        <Radio.Group
+                            type='button'
+                            value={driver}
+                            onChange={(value) => {
+                                setFromData({
+                                    ...fromData,
+                                    db_driver: value,
+                                })
+                            }}>
+                            <Radio value='mysql'>MySql</Radio>
+                            <Radio value='postgres'>PostgreSQL</Radio>
+                            <Radio value='sqlite'>SQLite</Radio>
+                        </Radio.Group>
+                    </Form.Item>
                     {
                         forms.map((item, index) =>
                             <Form.Item key={`${item.field}_form_item_${index}`} label={item.label}>